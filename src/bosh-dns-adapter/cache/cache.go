@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock"
+)
+
+const (
+	cacheHits      = "DNSCacheHits"
+	cacheMisses    = "DNSCacheMisses"
+	cacheStaleHits = "DNSCacheStaleHits"
+)
+
+//go:generate counterfeiter -o fakes/resolver.go --fake-name Resolver . Resolver
+type Resolver interface {
+	Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error)
+}
+
+//go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
+type MetricsSender interface {
+	IncrementCounter(string)
+}
+
+// Cache remembers the hosts the service discovery controller returned for
+// each name, or that it did not know the name. Once an entry expires it is
+// fetched again, but while the controller is failing the expired entry is
+// served for up to maxStale.
+type Cache struct {
+	resolver      Resolver
+	ttl           time.Duration
+	negativeTTL   time.Duration
+	maxStale      time.Duration
+	maxEntries    int
+	clock         clock.Clock
+	metricsSender MetricsSender
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+type entry struct {
+	name      string
+	hosts     []sdcclient.Host
+	unknown   bool
+	fetchedAt time.Time
+	expired   bool
+}
+
+// New returns a cache that keeps answers for ttl, and the answer that a name
+// is not known for the usually shorter negativeTTL, so that a new instance
+// can be found soon after it registers.
+func New(resolver Resolver, ttl, negativeTTL, maxStale time.Duration, maxEntries int, clock clock.Clock, metricsSender MetricsSender) *Cache {
+	return &Cache{
+		resolver:      resolver,
+		ttl:           ttl,
+		negativeTTL:   negativeTTL,
+		maxStale:      maxStale,
+		maxEntries:    maxEntries,
+		clock:         clock,
+		metricsSender: metricsSender,
+		entries:       map[string]*list.Element{},
+		recent:        list.New(),
+	}
+}
+
+func (c *Cache) Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error) {
+	name := cacheKey(infrastructureName)
+
+	cached, found := c.get(name)
+	if found && !cached.expired && c.clock.Since(cached.fetchedAt) < c.ttlOf(cached) {
+		c.metricsSender.IncrementCounter(cacheHits)
+		return cached.answer()
+	}
+
+	hosts, err := c.resolver.Hosts(ctx, infrastructureName)
+	if err == sdcclient.ErrUnknownHostname {
+		c.metricsSender.IncrementCounter(cacheMisses)
+		c.set(name, nil, true)
+		return nil, err
+	}
+	if err != nil {
+		if found && c.clock.Since(cached.fetchedAt) < c.ttlOf(cached)+c.maxStale {
+			c.metricsSender.IncrementCounter(cacheStaleHits)
+			return cached.answer()
+		}
+		return nil, err
+	}
+
+	c.metricsSender.IncrementCounter(cacheMisses)
+	c.set(name, hosts, false)
+	return hosts, nil
+}
+
+// Expire marks the entry for the name as expired so that the next lookup
+// fetches it again. It is still served if that fetch fails.
+func (c *Cache) Expire(infrastructureName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[cacheKey(infrastructureName)]; ok {
+		element.Value.(*entry).expired = true
+	}
+}
+
+func (c *Cache) ExpireAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, element := range c.entries {
+		element.Value.(*entry).expired = true
+	}
+}
+
+func (c *Cache) GetEntries() (float64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return float64(len(c.entries)), nil
+}
+
+func (c *Cache) get(name string) (entry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[name]
+	if !ok {
+		return entry{}, false
+	}
+
+	c.recent.MoveToFront(element)
+	return *element.Value.(*entry), true
+}
+
+func (c *Cache) set(name string, hosts []sdcclient.Host, unknown bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	newEntry := &entry{name: name, hosts: hosts, unknown: unknown, fetchedAt: c.clock.Now()}
+	if element, ok := c.entries[name]; ok {
+		element.Value = newEntry
+		c.recent.MoveToFront(element)
+		return
+	}
+
+	c.entries[name] = c.recent.PushFront(newEntry)
+	if c.maxEntries > 0 && c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).name)
+	}
+}
+
+func (c *Cache) ttlOf(e entry) time.Duration {
+	if e.unknown || len(e.hosts) == 0 {
+		return c.negativeTTL
+	}
+	return c.ttl
+}
+
+func (e entry) answer() ([]sdcclient.Host, error) {
+	if e.unknown {
+		return nil, sdcclient.ErrUnknownHostname
+	}
+	return shuffled(e.hosts), nil
+}
+
+// cacheKey matches the fully qualified hostnames the controller uses, so that
+// its change events find the entry.
+func cacheKey(name string) string {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+func shuffled(hosts []sdcclient.Host) []sdcclient.Host {
+	result := make([]sdcclient.Host, len(hosts))
+	for i, j := range rand.Perm(len(hosts)) {
+		result[i] = hosts[j]
+	}
+	return result
+}
@@ -0,0 +1,173 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "bosh-dns-adapter/cache"
+	"bosh-dns-adapter/cache/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		resolver      *fakes.Resolver
+		metricsSender *fakes.MetricsSender
+		fakeClock     *fakeclock.FakeClock
+		cache         *Cache
+		hosts         []sdcclient.Host
+		ctx           context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		resolver = &fakes.Resolver{}
+		metricsSender = &fakes.MetricsSender{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		hosts = []sdcclient.Host{{IP: "192.168.0.1"}, {IP: "192.168.0.2"}}
+		resolver.HostsReturns(hosts, nil)
+
+		cache = New(resolver, 5*time.Second, time.Second, 60*time.Second, 2, fakeClock, metricsSender)
+	})
+
+	counters := func() []string {
+		names := []string{}
+		for i := 0; i < metricsSender.IncrementCounterCallCount(); i++ {
+			names = append(names, metricsSender.IncrementCounterArgsForCall(i))
+		}
+		return names
+	}
+
+	It("fetches names it has not seen", func() {
+		Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(Equal(hosts))
+		Expect(resolver.HostsCallCount()).To(Equal(1))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+		Expect(counters()).To(Equal([]string{"DNSCacheMisses"}))
+	})
+
+	It("serves names from the cache until the ttl passes", func() {
+		cache.Hosts(ctx, "app-id.apps.internal.")
+
+		fakeClock.Increment(4 * time.Second)
+		Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(hosts))
+		Expect(resolver.HostsCallCount()).To(Equal(1))
+
+		fakeClock.Increment(2 * time.Second)
+		Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(hosts))
+		Expect(resolver.HostsCallCount()).To(Equal(2))
+
+		Expect(counters()).To(Equal([]string{"DNSCacheMisses", "DNSCacheHits", "DNSCacheMisses"}))
+	})
+
+	It("treats names with and without the trailing dot as the same", func() {
+		cache.Hosts(ctx, "app-id.apps.internal")
+		cache.Hosts(ctx, "app-id.apps.internal.")
+		Expect(resolver.HostsCallCount()).To(Equal(1))
+	})
+
+	Context("when the service discovery controller does not know the name", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns(nil, sdcclient.ErrUnknownHostname)
+		})
+
+		It("remembers that until the negative ttl passes", func() {
+			_, err := cache.Hosts(ctx, "app-id.apps.internal.")
+			Expect(err).To(Equal(sdcclient.ErrUnknownHostname))
+
+			_, err = cache.Hosts(ctx, "app-id.apps.internal.")
+			Expect(err).To(Equal(sdcclient.ErrUnknownHostname))
+			Expect(resolver.HostsCallCount()).To(Equal(1))
+
+			resolver.HostsReturns(hosts, nil)
+			fakeClock.Increment(time.Second)
+			Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(Equal(hosts))
+			Expect(counters()).To(Equal([]string{"DNSCacheMisses", "DNSCacheHits", "DNSCacheMisses"}))
+		})
+	})
+
+	Context("when the service discovery controller has no instances for the name", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns([]sdcclient.Host{}, nil)
+		})
+
+		It("remembers that until the negative ttl passes", func() {
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(BeEmpty())
+			Expect(resolver.HostsCallCount()).To(Equal(1))
+
+			resolver.HostsReturns(hosts, nil)
+			fakeClock.Increment(time.Second)
+			Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(Equal(hosts))
+		})
+	})
+
+	Context("when the service discovery controller fails", func() {
+		BeforeEach(func() {
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			resolver.HostsReturns(nil, errors.New("potato"))
+		})
+
+		It("serves the expired answer until it is too stale", func() {
+			fakeClock.Increment(6 * time.Second)
+			Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(hosts))
+			Expect(counters()).To(ContainElement("DNSCacheStaleHits"))
+
+			fakeClock.Increment(60 * time.Second)
+			_, err := cache.Hosts(ctx, "app-id.apps.internal.")
+			Expect(err).To(MatchError("potato"))
+		})
+
+		It("returns the error for names it has not seen", func() {
+			_, err := cache.Hosts(ctx, "other.apps.internal.")
+			Expect(err).To(MatchError("potato"))
+		})
+	})
+
+	Describe("Expire", func() {
+		It("fetches the name again on the next lookup", func() {
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			cache.Expire("app-id.apps.internal.")
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			Expect(resolver.HostsCallCount()).To(Equal(2))
+		})
+
+		It("still serves the expired answer when the fetch fails", func() {
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			cache.Expire("app-id.apps.internal.")
+			resolver.HostsReturns(nil, errors.New("potato"))
+			Expect(cache.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(hosts))
+		})
+	})
+
+	Describe("ExpireAll", func() {
+		It("fetches every name again on the next lookup", func() {
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			cache.Hosts(ctx, "other.apps.internal.")
+			cache.ExpireAll()
+			cache.Hosts(ctx, "app-id.apps.internal.")
+			cache.Hosts(ctx, "other.apps.internal.")
+			Expect(resolver.HostsCallCount()).To(Equal(4))
+		})
+	})
+
+	It("evicts the least recently used name when it is full", func() {
+		cache.Hosts(ctx, "a.apps.internal.")
+		cache.Hosts(ctx, "b.apps.internal.")
+		cache.Hosts(ctx, "a.apps.internal.")
+		cache.Hosts(ctx, "c.apps.internal.")
+		Expect(cache.GetEntries()).To(Equal(2.0))
+		Expect(resolver.HostsCallCount()).To(Equal(3))
+
+		cache.Hosts(ctx, "a.apps.internal.")
+		Expect(resolver.HostsCallCount()).To(Equal(3))
+
+		cache.Hosts(ctx, "b.apps.internal.")
+		Expect(resolver.HostsCallCount()).To(Equal(4))
+	})
+})
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	watchWait          = 5 * time.Second
+	watchRetryInterval = 5 * time.Second
+)
+
+//go:generate counterfeiter -o fakes/watch_client.go --fake-name WatchClient . WatchClient
+type WatchClient interface {
+	CurrentRevision(ctx context.Context) (uint64, error)
+	Watch(ctx context.Context, since uint64, wait time.Duration) (uint64, []string, error)
+}
+
+// Watcher expires cache entries as the service discovery controller reports
+// changes to their hostnames. Whenever it loses track of the changes, it
+// expires every entry.
+type Watcher struct {
+	client WatchClient
+	cache  *Cache
+	clock  clock.Clock
+	logger lager.Logger
+}
+
+func NewWatcher(client WatchClient, cache *Cache, clock clock.Clock, logger lager.Logger) *Watcher {
+	return &Watcher{
+		client: client,
+		cache:  cache,
+		clock:  clock,
+		logger: logger,
+	}
+}
+
+func (w *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.watch(ctx)
+		close(stopped)
+	}()
+
+	close(ready)
+
+	<-signals
+	cancel()
+	<-stopped
+	return nil
+}
+
+func (w *Watcher) watch(ctx context.Context) {
+	var revision uint64
+	synced := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !synced {
+			currentRevision, err := w.client.CurrentRevision(ctx)
+			if err != nil {
+				w.logger.Error("get-current-revision-failed", err)
+				if !w.wait(ctx) {
+					return
+				}
+				continue
+			}
+
+			w.cache.ExpireAll()
+			revision = currentRevision
+			synced = true
+			continue
+		}
+
+		newRevision, hostnames, err := w.client.Watch(ctx, revision, watchWait)
+		if err == sdcclient.ErrRevisionUnavailable {
+			w.logger.Info("watch-revision-unavailable", lager.Data{"revision": revision})
+			synced = false
+			continue
+		}
+		if err != nil {
+			w.logger.Error("watch-failed", err)
+			synced = false
+			if !w.wait(ctx) {
+				return
+			}
+			continue
+		}
+
+		for _, hostname := range hostnames {
+			w.cache.Expire(hostname)
+		}
+		revision = newRevision
+	}
+}
+
+func (w *Watcher) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-w.clock.After(watchRetryInterval):
+		return true
+	}
+}
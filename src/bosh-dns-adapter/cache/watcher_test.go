@@ -0,0 +1,116 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	. "bosh-dns-adapter/cache"
+	"bosh-dns-adapter/cache/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		resolver    *fakes.Resolver
+		watchClient *fakes.WatchClient
+		fakeClock   *fakeclock.FakeClock
+		cache       *Cache
+		watcher     *Watcher
+		process     ifrit.Process
+		changes     chan []string
+	)
+
+	BeforeEach(func() {
+		resolver = &fakes.Resolver{}
+		resolver.HostsReturns([]sdcclient.Host{{IP: "192.168.0.1"}}, nil)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		cache = New(resolver, time.Hour, time.Hour, 0, 0, fakeClock, &fakes.MetricsSender{})
+
+		changes = make(chan []string)
+		watchClient = &fakes.WatchClient{}
+		watchClient.CurrentRevisionReturns(7, nil)
+		watchClient.WatchStub = func(ctx context.Context, since uint64, wait time.Duration) (uint64, []string, error) {
+			select {
+			case hostnames := <-changes:
+				return since + 1, hostnames, nil
+			case <-time.After(10 * time.Millisecond):
+				return since, []string{}, nil
+			}
+		}
+
+		watcher = NewWatcher(watchClient, cache, fakeClock, lagertest.NewTestLogger("test"))
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Invoke(watcher)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("watches from the current revision", func() {
+		Eventually(watchClient.WatchCallCount).Should(BeNumerically(">", 0))
+		_, since, wait := watchClient.WatchArgsForCall(0)
+		Expect(since).To(Equal(uint64(7)))
+		Expect(wait).To(Equal(5 * time.Second))
+	})
+
+	It("expires the hostnames that changed", func() {
+		Eventually(watchClient.WatchCallCount).Should(BeNumerically(">", 0))
+		cache.Hosts(context.Background(), "app-id.apps.internal.")
+		cache.Hosts(context.Background(), "other.apps.internal.")
+
+		changes <- []string{"app-id.apps.internal."}
+		Eventually(func() uint64 {
+			_, since, _ := watchClient.WatchArgsForCall(watchClient.WatchCallCount() - 1)
+			return since
+		}).Should(Equal(uint64(8)))
+
+		cache.Hosts(context.Background(), "app-id.apps.internal.")
+		cache.Hosts(context.Background(), "other.apps.internal.")
+		Expect(resolver.HostsCallCount()).To(Equal(3))
+	})
+
+	Context("when the revision is no longer available", func() {
+		BeforeEach(func() {
+			watch := watchClient.WatchStub
+			failed := false
+			watchClient.WatchStub = func(ctx context.Context, since uint64, wait time.Duration) (uint64, []string, error) {
+				if !failed {
+					failed = true
+					return 0, nil, sdcclient.ErrRevisionUnavailable
+				}
+				return watch(ctx, since, wait)
+			}
+		})
+
+		It("expires everything and starts again from the current revision", func() {
+			Eventually(watchClient.CurrentRevisionCallCount).Should(Equal(2))
+		})
+	})
+
+	Context("when the current revision cannot be fetched", func() {
+		BeforeEach(func() {
+			watchClient.CurrentRevisionReturnsOnCall(0, 0, errors.New("potato"))
+		})
+
+		It("retries after a while", func() {
+			Eventually(watchClient.CurrentRevisionCallCount).Should(Equal(1))
+			Consistently(watchClient.CurrentRevisionCallCount).Should(Equal(1))
+
+			fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+			Eventually(watchClient.CurrentRevisionCallCount).Should(Equal(2))
+			Eventually(watchClient.WatchCallCount).Should(BeNumerically(">", 0))
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+
+	"bosh-dns-adapter/sdcclient"
+)
+
+const lookupsCoalesced = "DNSLookupsCoalesced"
+
+//go:generate counterfeiter -o fakes/resolver.go --fake-name Resolver . Resolver
+type Resolver interface {
+	Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error)
+}
+
+//go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
+type MetricsSender interface {
+	IncrementCounter(string)
+}
+
+// Coalescer shares a single lookup between everyone asking for the same name
+// while it is in flight, so that a burst of identical queries makes one
+// request to the service discovery controller.
+type Coalescer struct {
+	resolver      Resolver
+	metricsSender MetricsSender
+
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done  chan struct{}
+	hosts []sdcclient.Host
+	err   error
+}
+
+func New(resolver Resolver, metricsSender MetricsSender) *Coalescer {
+	return &Coalescer{
+		resolver:      resolver,
+		metricsSender: metricsSender,
+		calls:         map[string]*call{},
+	}
+}
+
+// Hosts waits for the shared lookup until ctx is done. The shared lookup
+// itself is not tied to any one caller's context, so a caller giving up does
+// not fail it for the others.
+func (c *Coalescer) Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error) {
+	c.mutex.Lock()
+	inFlight, found := c.calls[infrastructureName]
+	if !found {
+		inFlight = &call{done: make(chan struct{})}
+		c.calls[infrastructureName] = inFlight
+		go c.lookup(infrastructureName, inFlight)
+	}
+	c.mutex.Unlock()
+
+	if found {
+		c.metricsSender.IncrementCounter(lookupsCoalesced)
+	}
+
+	select {
+	case <-inFlight.done:
+		if inFlight.err != nil {
+			return nil, inFlight.err
+		}
+		hosts := make([]sdcclient.Host, len(inFlight.hosts))
+		copy(hosts, inFlight.hosts)
+		return hosts, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Coalescer) lookup(infrastructureName string, inFlight *call) {
+	inFlight.hosts, inFlight.err = c.resolver.Hosts(context.Background(), infrastructureName)
+
+	c.mutex.Lock()
+	delete(c.calls, infrastructureName)
+	c.mutex.Unlock()
+
+	close(inFlight.done)
+}
@@ -0,0 +1,114 @@
+package coalesce_test
+
+import (
+	"context"
+	"errors"
+
+	. "bosh-dns-adapter/coalesce"
+	"bosh-dns-adapter/coalesce/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coalescer", func() {
+	var (
+		resolver      *fakes.Resolver
+		metricsSender *fakes.MetricsSender
+		coalescer     *Coalescer
+		release       chan struct{}
+		hosts         []sdcclient.Host
+	)
+
+	type result struct {
+		hosts []sdcclient.Host
+		err   error
+	}
+
+	lookup := func(ctx context.Context, name string) chan result {
+		results := make(chan result, 1)
+		go func() {
+			hosts, err := coalescer.Hosts(ctx, name)
+			results <- result{hosts: hosts, err: err}
+		}()
+		return results
+	}
+
+	BeforeEach(func() {
+		resolver = &fakes.Resolver{}
+		metricsSender = &fakes.MetricsSender{}
+		release = make(chan struct{})
+		hosts = []sdcclient.Host{{IP: "192.168.0.1"}}
+		resolver.HostsStub = func(ctx context.Context, name string) ([]sdcclient.Host, error) {
+			<-release
+			return hosts, nil
+		}
+
+		coalescer = New(resolver, metricsSender)
+	})
+
+	It("shares one lookup between concurrent lookups for the same name", func() {
+		first := lookup(context.Background(), "app-id.apps.internal.")
+		Eventually(resolver.HostsCallCount).Should(Equal(1))
+		second := lookup(context.Background(), "app-id.apps.internal.")
+		Eventually(metricsSender.IncrementCounterCallCount).Should(Equal(1))
+
+		close(release)
+		Eventually(first).Should(Receive(Equal(result{hosts: hosts})))
+		Eventually(second).Should(Receive(Equal(result{hosts: hosts})))
+
+		Expect(resolver.HostsCallCount()).To(Equal(1))
+		Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("DNSLookupsCoalesced"))
+	})
+
+	It("looks up different names separately", func() {
+		first := lookup(context.Background(), "app-id.apps.internal.")
+		second := lookup(context.Background(), "other.apps.internal.")
+		Eventually(resolver.HostsCallCount).Should(Equal(2))
+
+		close(release)
+		Eventually(first).Should(Receive())
+		Eventually(second).Should(Receive())
+		Expect(metricsSender.IncrementCounterCallCount()).To(Equal(0))
+	})
+
+	It("looks the name up again once the lookup has finished", func() {
+		close(release)
+		Eventually(lookup(context.Background(), "app-id.apps.internal.")).Should(Receive())
+		Eventually(lookup(context.Background(), "app-id.apps.internal.")).Should(Receive())
+		Expect(resolver.HostsCallCount()).To(Equal(2))
+	})
+
+	It("shares errors", func() {
+		resolver.HostsStub = func(ctx context.Context, name string) ([]sdcclient.Host, error) {
+			<-release
+			return nil, errors.New("potato")
+		}
+
+		first := lookup(context.Background(), "app-id.apps.internal.")
+		Eventually(resolver.HostsCallCount).Should(Equal(1))
+		second := lookup(context.Background(), "app-id.apps.internal.")
+		Eventually(metricsSender.IncrementCounterCallCount).Should(Equal(1))
+
+		close(release)
+		Eventually(first).Should(Receive(Equal(result{err: errors.New("potato")})))
+		Eventually(second).Should(Receive(Equal(result{err: errors.New("potato")})))
+	})
+
+	Context("when a caller gives up", func() {
+		It("returns to that caller without failing the lookup for the others", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			first := lookup(ctx, "app-id.apps.internal.")
+			Eventually(resolver.HostsCallCount).Should(Equal(1))
+			second := lookup(context.Background(), "app-id.apps.internal.")
+
+			cancel()
+			Eventually(first).Should(Receive(Equal(result{err: context.Canceled})))
+			Consistently(second).ShouldNot(Receive())
+
+			close(release)
+			Eventually(second).Should(Receive(Equal(result{hosts: hosts})))
+		})
+	})
+})
@@ -3,6 +3,10 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
 	"gopkg.in/validator.v2"
 )
 
@@ -18,6 +22,51 @@ type Config struct {
 	MetricsEmitSeconds                int    `json:"metrics_emit_seconds" validate:"min=1"`
 	LogLevelAddress                   string `json:"log_level_address" validate:"nonzero"`
 	LogLevelPort                      int    `json:"log_level_port" validate:"min=1"`
+	DNSAddress                        string `json:"dns_address"`
+	DNSPort                           int    `json:"dns_port" validate:"min=0,max=65535"`
+	DoHAddress                        string `json:"doh_address"`
+	DoHPort                           int    `json:"doh_port" validate:"min=0,max=65535"`
+	DoHServerCert                     string `json:"doh_server_cert"`
+	DoHServerKey                      string `json:"doh_server_key"`
+	CacheTTLSeconds                   int    `json:"cache_ttl_seconds" validate:"min=0"`
+	CacheNegativeTTLSeconds           int    `json:"cache_negative_ttl_seconds" validate:"min=0"`
+	CacheMaxStaleSeconds              int    `json:"cache_max_stale_seconds" validate:"min=0"`
+	CacheMaxEntries                   int    `json:"cache_max_entries" validate:"min=0"`
+
+	ServiceDiscoveryControllerAddresses          []string `json:"service_discovery_controller_addresses"`
+	ServiceDiscoveryControllerHealthCheckSeconds int      `json:"service_discovery_controller_health_check_seconds" validate:"min=0"`
+
+	ServiceDiscoveryControllerQueryTimeoutMs         int `json:"service_discovery_controller_query_timeout_ms" validate:"min=0"`
+	ServiceDiscoveryControllerBreakerFailures        int `json:"service_discovery_controller_breaker_failures" validate:"min=0"`
+	ServiceDiscoveryControllerBreakerCooldownSeconds int `json:"service_discovery_controller_breaker_cooldown_seconds" validate:"min=0"`
+
+	ReplicaEnabled             bool `json:"replica_enabled"`
+	ReplicaMaxStalenessSeconds int  `json:"replica_max_staleness_seconds" validate:"min=0"`
+
+	Domains []Domain `json:"domains"`
+
+	OverlayNetwork string `json:"overlay_network"`
+}
+
+// Domain is an internal domain the adapter answers for. Names in it are looked
+// up on its own service discovery controller instances, or on the top level
+// ones when it has none.
+type Domain struct {
+	Domain                              string   `json:"domain" validate:"nonzero"`
+	ServiceDiscoveryControllerAddresses []string `json:"service_discovery_controller_addresses"`
+	ServiceDiscoveryControllerPort      string   `json:"service_discovery_controller_port"`
+	RecordTypes                         []string `json:"record_types"`
+	TTLSeconds                          int      `json:"ttl_seconds" validate:"min=0"`
+	NegativeTTLSeconds                  int      `json:"negative_ttl_seconds" validate:"min=0"`
+}
+
+// DefaultDomain is answered for when no domains are configured.
+const DefaultDomain = "apps.internal."
+
+var supportedRecordTypes = map[string]bool{
+	"A":    true,
+	"AAAA": true,
+	"SRV":  true,
 }
 
 func NewConfig(configJSON []byte) (*Config, error) {
@@ -32,5 +81,87 @@ func NewConfig(configJSON []byte) (*Config, error) {
 		return nil, fmt.Errorf("invalid config: %s", err)
 	}
 
+	if err = validateDomains(adapterConfig.Domains); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	if err = validateOverlayNetwork(adapterConfig.OverlayNetwork); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	if err = validateDoH(adapterConfig); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
 	return adapterConfig, err
 }
+
+// InternalDomains returns the configured domains, or DefaultDomain on the top
+// level service discovery controller instances when there are none.
+func (c *Config) InternalDomains() []Domain {
+	if len(c.Domains) == 0 {
+		return []Domain{{Domain: DefaultDomain}}
+	}
+	return c.Domains
+}
+
+// ReverseDomain returns the in-addr.arpa. domain that PTR queries for the
+// overlay network are answered for, widened to whole octets, or "" when no
+// overlay network is configured.
+func (c *Config) ReverseDomain() string {
+	_, network, err := net.ParseCIDR(c.OverlayNetwork)
+	if err != nil {
+		return ""
+	}
+
+	ones, _ := network.Mask.Size()
+	ip := network.IP.To4()
+	labels := []string{}
+	for i := ones/8 - 1; i >= 0; i-- {
+		labels = append(labels, strconv.Itoa(int(ip[i])))
+	}
+	return strings.Join(append(labels, "in-addr.arpa."), ".")
+}
+
+func validateOverlayNetwork(overlayNetwork string) error {
+	if overlayNetwork == "" {
+		return nil
+	}
+
+	_, network, err := net.ParseCIDR(overlayNetwork)
+	if err != nil || network.IP.To4() == nil {
+		return fmt.Errorf("OverlayNetwork: invalid IPv4 CIDR %s", overlayNetwork)
+	}
+	return nil
+}
+
+func validateDoH(adapterConfig *Config) error {
+	if adapterConfig.DoHPort == 0 {
+		return nil
+	}
+	if adapterConfig.DoHServerCert == "" {
+		return fmt.Errorf("DoHServerCert: required when DoHPort is set")
+	}
+	if adapterConfig.DoHServerKey == "" {
+		return fmt.Errorf("DoHServerKey: required when DoHPort is set")
+	}
+	return nil
+}
+
+func validateDomains(domains []Domain) error {
+	seen := map[string]bool{}
+	for i, domain := range domains {
+		name := strings.ToLower(strings.TrimSuffix(domain.Domain, ".") + ".")
+		if seen[name] {
+			return fmt.Errorf("Domains[%d].Domain: duplicate domain %s", i, domain.Domain)
+		}
+		seen[name] = true
+
+		for _, recordType := range domain.RecordTypes {
+			if !supportedRecordTypes[recordType] {
+				return fmt.Errorf("Domains[%d].RecordTypes: unsupported record type %s", i, recordType)
+			}
+		}
+	}
+	return nil
+}
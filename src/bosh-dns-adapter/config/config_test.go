@@ -24,8 +24,36 @@ var _ = Describe("Config", func() {
 				"metrics_emit_seconds": 6,
 				"metron_port": 8080,
 				"log_level_address": "log-level-address",
-				"log_level_port": 9090
-
+				"log_level_port": 9090,
+				"dns_address": "127.0.0.2",
+				"dns_port": 53,
+				"doh_address": "127.0.0.3",
+				"doh_port": 8443,
+				"doh_server_cert": "doh_server.crt",
+				"doh_server_key": "doh_server.key",
+				"cache_ttl_seconds": 5,
+				"cache_negative_ttl_seconds": 1,
+				"cache_max_stale_seconds": 300,
+				"cache_max_entries": 1000,
+				"service_discovery_controller_addresses": ["10.0.0.1", "10.0.0.2"],
+				"service_discovery_controller_health_check_seconds": 5,
+				"service_discovery_controller_query_timeout_ms": 1500,
+				"service_discovery_controller_breaker_failures": 3,
+				"service_discovery_controller_breaker_cooldown_seconds": 20,
+				"replica_enabled": true,
+				"replica_max_staleness_seconds": 45,
+				"domains": [
+					{"domain": "apps.internal."},
+					{
+						"domain": "svc.internal.",
+						"service_discovery_controller_addresses": ["10.0.1.1"],
+						"service_discovery_controller_port": "8054",
+						"record_types": ["A", "AAAA"],
+						"ttl_seconds": 30,
+						"negative_ttl_seconds": 15
+					}
+				],
+				"overlay_network": "10.255.0.0/16"
 			}`)
 
 			parsedConfig, err := NewConfig(configJSON)
@@ -43,9 +71,50 @@ var _ = Describe("Config", func() {
 			Expect(parsedConfig.MetronPort).To(Equal(8080))
 			Expect(parsedConfig.LogLevelAddress).To(Equal("log-level-address"))
 			Expect(parsedConfig.LogLevelPort).To(Equal(9090))
+			Expect(parsedConfig.DNSAddress).To(Equal("127.0.0.2"))
+			Expect(parsedConfig.DNSPort).To(Equal(53))
+			Expect(parsedConfig.DoHAddress).To(Equal("127.0.0.3"))
+			Expect(parsedConfig.DoHPort).To(Equal(8443))
+			Expect(parsedConfig.DoHServerCert).To(Equal("doh_server.crt"))
+			Expect(parsedConfig.DoHServerKey).To(Equal("doh_server.key"))
+			Expect(parsedConfig.CacheTTLSeconds).To(Equal(5))
+			Expect(parsedConfig.CacheNegativeTTLSeconds).To(Equal(1))
+			Expect(parsedConfig.CacheMaxStaleSeconds).To(Equal(300))
+			Expect(parsedConfig.CacheMaxEntries).To(Equal(1000))
+			Expect(parsedConfig.ServiceDiscoveryControllerAddresses).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(parsedConfig.ServiceDiscoveryControllerHealthCheckSeconds).To(Equal(5))
+			Expect(parsedConfig.ServiceDiscoveryControllerQueryTimeoutMs).To(Equal(1500))
+			Expect(parsedConfig.ServiceDiscoveryControllerBreakerFailures).To(Equal(3))
+			Expect(parsedConfig.ServiceDiscoveryControllerBreakerCooldownSeconds).To(Equal(20))
+			Expect(parsedConfig.ReplicaEnabled).To(BeTrue())
+			Expect(parsedConfig.ReplicaMaxStalenessSeconds).To(Equal(45))
+			Expect(parsedConfig.Domains).To(Equal([]Domain{
+				{Domain: "apps.internal."},
+				{
+					Domain:                              "svc.internal.",
+					ServiceDiscoveryControllerAddresses: []string{"10.0.1.1"},
+					ServiceDiscoveryControllerPort:      "8054",
+					RecordTypes:                         []string{"A", "AAAA"},
+					TTLSeconds:                          30,
+					NegativeTTLSeconds:                  15,
+				},
+			}))
+			Expect(parsedConfig.OverlayNetwork).To(Equal("10.255.0.0/16"))
+			Expect(parsedConfig.ReverseDomain()).To(Equal("255.10.in-addr.arpa."))
 		})
 	})
 
+	DescribeTable("ReverseDomain",
+		func(overlayNetwork string, reverseDomain string) {
+			adapterConfig := &Config{OverlayNetwork: overlayNetwork}
+			Expect(adapterConfig.ReverseDomain()).To(Equal(reverseDomain))
+		},
+		Entry("no overlay network", "", ""),
+		Entry("a network on an octet boundary", "10.255.0.0/16", "255.10.in-addr.arpa."),
+		Entry("a network within an octet", "10.255.128.0/20", "255.10.in-addr.arpa."),
+		Entry("a network of whole addresses", "10.255.1.0/24", "1.255.10.in-addr.arpa."),
+	)
+
 	Context("when constructed with invalid JSON", func() {
 		It("returns an error", func() {
 			configJSON := []byte(`garbage`)
@@ -93,6 +162,27 @@ var _ = Describe("Config", func() {
 		Entry("invalid ca_cert", "ca_cert", "", "CACert: zero value"),
 		Entry("invalid log_level_address", "log_level_address", "", "LogLevelAddress: zero value"),
 		Entry("invalid log_level_port", "log_level_port", -2, "LogLevelPort: less than min"),
+		Entry("invalid dns_port", "dns_port", -2, "DNSPort: less than min"),
+		Entry("invalid dns_port", "dns_port", 65536, "DNSPort: greater than max"),
+		Entry("invalid doh_port", "doh_port", -2, "DoHPort: less than min"),
+		Entry("invalid doh_port", "doh_port", 65536, "DoHPort: greater than max"),
+		Entry("doh_port without doh_server_cert", "doh_port", 8443, "DoHServerCert: required when DoHPort is set"),
+		Entry("invalid cache_ttl_seconds", "cache_ttl_seconds", -1, "CacheTTLSeconds: less than min"),
+		Entry("invalid cache_negative_ttl_seconds", "cache_negative_ttl_seconds", -1, "CacheNegativeTTLSeconds: less than min"),
+		Entry("invalid cache_max_stale_seconds", "cache_max_stale_seconds", -1, "CacheMaxStaleSeconds: less than min"),
+		Entry("invalid cache_max_entries", "cache_max_entries", -1, "CacheMaxEntries: less than min"),
+		Entry("invalid service_discovery_controller_health_check_seconds", "service_discovery_controller_health_check_seconds", -1, "ServiceDiscoveryControllerHealthCheckSeconds: less than min"),
+		Entry("invalid service_discovery_controller_query_timeout_ms", "service_discovery_controller_query_timeout_ms", -1, "ServiceDiscoveryControllerQueryTimeoutMs: less than min"),
+		Entry("invalid service_discovery_controller_breaker_failures", "service_discovery_controller_breaker_failures", -1, "ServiceDiscoveryControllerBreakerFailures: less than min"),
+		Entry("invalid service_discovery_controller_breaker_cooldown_seconds", "service_discovery_controller_breaker_cooldown_seconds", -1, "ServiceDiscoveryControllerBreakerCooldownSeconds: less than min"),
+		Entry("invalid replica_max_staleness_seconds", "replica_max_staleness_seconds", -1, "ReplicaMaxStalenessSeconds: less than min"),
+		Entry("missing domain", "domains", []map[string]interface{}{{"ttl_seconds": 5}}, "Domains[0].Domain: zero value"),
+		Entry("invalid domain ttl_seconds", "domains", []map[string]interface{}{{"domain": "apps.internal.", "ttl_seconds": -1}}, "Domains[0].TTLSeconds: less than min"),
+		Entry("invalid domain negative_ttl_seconds", "domains", []map[string]interface{}{{"domain": "apps.internal.", "negative_ttl_seconds": -1}}, "Domains[0].NegativeTTLSeconds: less than min"),
+		Entry("duplicate domain", "domains", []map[string]interface{}{{"domain": "apps.internal."}, {"domain": "Apps.Internal"}}, "Domains[1].Domain: duplicate domain Apps.Internal"),
+		Entry("invalid overlay_network", "overlay_network", "10.255.0.0", "OverlayNetwork: invalid IPv4 CIDR 10.255.0.0"),
+		Entry("IPv6 overlay_network", "overlay_network", "fd00::/64", "OverlayNetwork: invalid IPv4 CIDR fd00::/64"),
+		Entry("unsupported domain record_types", "domains", []map[string]interface{}{{"domain": "apps.internal.", "record_types": []string{"A", "MX"}}}, "Domains[0].RecordTypes: unsupported record type MX"),
 	)
 })
 
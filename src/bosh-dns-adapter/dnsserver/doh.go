@@ -0,0 +1,164 @@
+package dnsserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+// DoHHandler answers DNS-over-HTTPS queries as described in RFC 8484. Queries
+// are wire format DNS messages, either base64url encoded in the dns parameter
+// of a GET or as the body of a POST.
+type DoHHandler struct {
+	server *Server
+	logger lager.Logger
+}
+
+func NewDoHHandler(zones Zones, metricsSender MetricsSender, logger lager.Logger) *DoHHandler {
+	return &DoHHandler{
+		server: NewServer("", zones, metricsSender, logger),
+		logger: logger,
+	}
+}
+
+func (h *DoHHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	var (
+		query []byte
+		err   error
+	)
+
+	switch req.Method {
+	case http.MethodGet:
+		query, err = base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil || len(query) == 0 {
+			http.Error(resp, "dns parameter must be a base64url encoded DNS message", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if req.Header.Get("Content-Type") != dnsMessageContentType {
+			http.Error(resp, "content type must be "+dnsMessageContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		query, err = ioutil.ReadAll(io.LimitReader(req.Body, maxTCPSize+1))
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(query) > maxTCPSize {
+			http.Error(resp, "DNS message is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	default:
+		resp.Header().Set("Allow", "GET, POST")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, ok := h.server.respond(req.Context(), query, false)
+	if !ok {
+		http.Error(resp, "malformed DNS message", http.StatusBadRequest)
+		return
+	}
+
+	resp.Header().Set("Content-Type", dnsMessageContentType)
+	resp.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge(response)))
+	_, err = resp.Write(response)
+	if err != nil {
+		h.logger.Debug("doh-write-failed", lager.Data{"error": err.Error()})
+	}
+}
+
+// maxAge is how long, in seconds, HTTP caches may keep a response: the lowest
+// TTL in its answer section, or for a negative answer that of the SOA in its
+// authority section, as RFC 8484 asks. Responses without records, such as
+// server failures, are not to be cached.
+func maxAge(response []byte) uint32 {
+	var parser dnsmessage.Parser
+	if _, err := parser.Start(response); err != nil {
+		return 0
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return 0
+	}
+
+	lowest, found := lowestTTL(parser.AnswerHeader, parser.SkipAnswer)
+	if !found {
+		lowest, _ = lowestTTL(parser.AuthorityHeader, parser.SkipAuthority)
+	}
+	return lowest
+}
+
+func lowestTTL(next func() (dnsmessage.ResourceHeader, error), skip func() error) (uint32, bool) {
+	var lowest uint32
+	found := false
+	for {
+		header, err := next()
+		if err != nil {
+			return lowest, found
+		}
+		if !found || header.TTL < lowest {
+			lowest = header.TTL
+			found = true
+		}
+		if err := skip(); err != nil {
+			return lowest, found
+		}
+	}
+}
+
+// DoHServer serves DNS-over-HTTPS queries on their own listener, since RFC
+// 8484 clients only send queries over HTTPS.
+type DoHServer struct {
+	address   string
+	tlsConfig *tls.Config
+	handler   http.Handler
+	logger    lager.Logger
+}
+
+func NewDoHServer(address, certPath, keyPath string, handler http.Handler, logger lager.Logger) (*DoHServer, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load doh key pair: %s", err)
+	}
+
+	return &DoHServer{
+		address: address,
+		tlsConfig: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		},
+		handler: handler,
+		logger:  logger,
+	}, nil
+}
+
+func (s *DoHServer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	listener, err := tls.Listen("tcp", s.address, s.tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{Handler: s.handler}
+	errs := make(chan error, 1)
+	go func() { errs <- httpServer.Serve(listener) }()
+
+	s.logger.Info("doh-server-started", lager.Data{"address": s.address})
+	close(ready)
+
+	select {
+	case <-signals:
+		httpServer.Close()
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
@@ -0,0 +1,209 @@
+package dnsserver_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "bosh-dns-adapter/dnsserver"
+	"bosh-dns-adapter/dnsserver/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"golang.org/x/net/dns/dnsmessage"
+	"test-helpers"
+)
+
+var _ = Describe("DoHHandler", func() {
+	var (
+		resolver      *fakes.Resolver
+		metricsSender *fakes.MetricsSender
+		server        *httptest.Server
+		query         []byte
+	)
+
+	BeforeEach(func() {
+		resolver = &fakes.Resolver{}
+		metricsSender = &fakes.MetricsSender{}
+		resolver.HostsReturns([]sdcclient.Host{{IP: "192.168.0.1"}}, nil)
+
+		server = httptest.NewServer(NewDoHHandler(NewZones(clock.NewClock(), Zone{Domain: "apps.internal", Resolver: resolver, TTL: 30, NegativeTTL: 5}), metricsSender, lagertest.NewTestLogger("test")))
+
+		builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+		Expect(builder.StartQuestions()).To(Succeed())
+		Expect(builder.Question(dnsmessage.Question{
+			Name:  dnsmessage.MustNewName("app-id.apps.internal."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		})).To(Succeed())
+		var err error
+		query, err = builder.Finish()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	readMessage := func(resp *http.Response) dnsmessage.Message {
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/dns-message"))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		var response dnsmessage.Message
+		Expect(response.Unpack(body)).To(Succeed())
+		return response
+	}
+
+	answerIP := func(response dnsmessage.Message) string {
+		Expect(response.Answers).To(HaveLen(1))
+		a, ok := response.Answers[0].Body.(*dnsmessage.AResource)
+		Expect(ok).To(BeTrue())
+		return net.IP(a.A[:]).String()
+	}
+
+	It("answers queries sent with GET", func() {
+		resp, err := http.Get(server.URL + "?dns=" + base64.RawURLEncoding.EncodeToString(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		response := readMessage(resp)
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(answerIP(response)).To(Equal("192.168.0.1"))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+	})
+
+	It("answers queries sent with POST", func() {
+		resp, err := http.Post(server.URL, "application/dns-message", bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		response := readMessage(resp)
+		Expect(answerIP(response)).To(Equal("192.168.0.1"))
+	})
+
+	It("lets HTTP caches keep answers for the lowest TTL in them", func() {
+		resolver.HostsReturns([]sdcclient.Host{{IP: "192.168.0.1"}, {IP: "192.168.0.2"}}, nil)
+
+		resp, err := http.Post(server.URL, "application/dns-message", bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readMessage(resp).Answers).To(HaveLen(2))
+		Expect(resp.Header.Get("Cache-Control")).To(Equal("max-age=30"))
+	})
+
+	It("lets HTTP caches keep unknown names for the negative TTL", func() {
+		resolver.HostsReturns(nil, sdcclient.ErrUnknownHostname)
+
+		resp, err := http.Post(server.URL, "application/dns-message", bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readMessage(resp).Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+		Expect(resp.Header.Get("Cache-Control")).To(Equal("max-age=5"))
+	})
+
+	It("answers with a server failure when the lookup fails", func() {
+		resolver.HostsReturns(nil, errors.New("potato"))
+
+		resp, err := http.Post(server.URL, "application/dns-message", bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		response := readMessage(resp)
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeServerFailure))
+		Expect(resp.Header.Get("Cache-Control")).To(Equal("max-age=0"))
+		Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("DNSRequestFailures"))
+	})
+
+	It("rejects a GET without a valid dns parameter", func() {
+		resp, err := http.Get(server.URL + "?dns=not*base64")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects a POST with another content type", func() {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+	})
+
+	It("rejects messages that cannot be parsed", func() {
+		resp, err := http.Post(server.URL, "application/dns-message", bytes.NewReader([]byte{1, 2, 3}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects other methods", func() {
+		req, err := http.NewRequest("PUT", server.URL, bytes.NewReader(query))
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resp.Header.Get("Allow")).To(Equal("GET, POST"))
+	})
+})
+
+var _ = Describe("DoHServer", func() {
+	var (
+		address    string
+		caFile     string
+		certFile   string
+		keyFile    string
+		serverProc ifrit.Process
+	)
+
+	BeforeEach(func() {
+		address = fmt.Sprintf("127.0.0.1:%d", ports.PickAPort())
+		caFile, certFile, keyFile, _ = testhelpers.GenerateCaAndMutualTlsCerts()
+		serverProc = nil
+	})
+
+	AfterEach(func() {
+		if serverProc != nil {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive(BeNil()))
+		}
+		os.Remove(caFile)
+		os.Remove(certFile)
+		os.Remove(keyFile)
+	})
+
+	It("serves the handler over TLS", func() {
+		server, err := NewDoHServer(address, certFile, keyFile, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Write([]byte(req.URL.Path))
+		}), lagertest.NewTestLogger("test"))
+		Expect(err).NotTo(HaveOccurred())
+		serverProc = ifrit.Invoke(server)
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: testhelpers.CertPool(caFile)},
+		}}
+		resp, err := client.Get("https://" + address + "/dns-query")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.TLS).NotTo(BeNil())
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("/dns-query"))
+	})
+
+	It("fails to be created without a valid key pair", func() {
+		_, err := NewDoHServer(address, certFile, caFile, http.NotFoundHandler(), lagertest.NewTestLogger("test"))
+		Expect(err).To(MatchError(ContainSubstring("load doh key pair")))
+	})
+})
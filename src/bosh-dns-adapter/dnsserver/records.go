@@ -0,0 +1,205 @@
+package dnsserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"bosh-dns-adapter/sdcclient"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Record is an answer to a query, independent of the format it is written
+// out in.
+type Record struct {
+	Name   string
+	Type   dnsmessage.Type
+	IP     string
+	Port   uint16
+	Target string
+	TTL    uint32
+
+	staleAt time.Time
+}
+
+// Data returns the record data the way it is written in zone files.
+func (r Record) Data() string {
+	switch r.Type {
+	case dnsmessage.TypeSRV:
+		return fmt.Sprintf("0 0 %d %s", r.Port, r.Target)
+	case dnsmessage.TypePTR:
+		return r.Target
+	case dnsmessage.TypeSOA:
+		return fmt.Sprintf("%s hostmaster.%s 1 %d %d %d %d", r.Name, r.Name, soaRefresh, soaRetry, soaExpire, r.TTL)
+	default:
+		return r.IP
+	}
+}
+
+// Lookup returns the answers and additional records for a query. SRV queries
+// are for names like _http._tcp.app-id.apps.internal. and point at a name
+// per instance, which in turn resolves to only that instance's address. It
+// returns sdcclient.ErrUnknownHostname when the name does not exist.
+func Lookup(ctx context.Context, resolver Resolver, name string, qtype dnsmessage.Type) ([]Record, []Record, error) {
+	switch qtype {
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+		return lookupAddress(ctx, resolver, name, qtype)
+	case dnsmessage.TypeSRV:
+		return lookupSRV(ctx, resolver, name)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// lookupAddress falls back to looking the name up as it is when it looks like
+// an instance name but does not match an instance, since an app's own name
+// could look like one.
+func lookupAddress(ctx context.Context, resolver Resolver, name string, qtype dnsmessage.Type) ([]Record, []Record, error) {
+	ip, hostname, isInstanceName := parseInstanceName(name)
+	if isInstanceName {
+		answers, err := lookupAddresses(ctx, resolver, name, hostname, qtype, ip)
+		if err != nil && err != sdcclient.ErrUnknownHostname {
+			return nil, nil, err
+		}
+		if len(answers) > 0 {
+			return answers, nil, nil
+		}
+	}
+
+	answers, err := lookupAddresses(ctx, resolver, name, name, qtype, "")
+	return answers, nil, err
+}
+
+// lookupAddresses returns the addresses of the given family registered for
+// the hostname, limited to onlyIP when it is set.
+func lookupAddresses(ctx context.Context, resolver Resolver, name, hostname string, qtype dnsmessage.Type, onlyIP string) ([]Record, error) {
+	hosts, err := resolver.Hosts(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := []Record{}
+	for _, host := range hosts {
+		if onlyIP != "" && host.IP != onlyIP {
+			continue
+		}
+		if addressType(host.IP) != qtype {
+			continue
+		}
+		answers = append(answers, Record{Name: name, Type: qtype, IP: host.IP, staleAt: host.StaleAt})
+	}
+	return answers, nil
+}
+
+func lookupSRV(ctx context.Context, resolver Resolver, name string) ([]Record, []Record, error) {
+	hostname, ok := parseSRVName(name)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	hosts, err := resolver.Hosts(ctx, hostname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	answers := []Record{}
+	additionals := []Record{}
+	for _, host := range hosts {
+		if host.Port == 0 {
+			continue
+		}
+		target := instanceName(host, hostname)
+		answers = append(answers, Record{Name: name, Type: dnsmessage.TypeSRV, Port: host.Port, Target: target, staleAt: host.StaleAt})
+		additionals = append(additionals, Record{Name: target, Type: addressType(host.IP), IP: host.IP, staleAt: host.StaleAt})
+	}
+	return answers, additionals, nil
+}
+
+// LookupPTR answers PTR queries for names like 2.0.255.10.in-addr.arpa. with
+// every hostname the address is registered under. It returns
+// sdcclient.ErrUnknownHostname when the address is not registered.
+func LookupPTR(ctx context.Context, resolver ReverseResolver, name string, qtype dnsmessage.Type) ([]Record, error) {
+	ip, ok := parseReverseName(name)
+	if !ok || qtype != dnsmessage.TypePTR {
+		return nil, nil
+	}
+
+	hostnames, err := resolver.Hostnames(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := []Record{}
+	for _, hostname := range hostnames {
+		answers = append(answers, Record{Name: name, Type: dnsmessage.TypePTR, Target: canonicalName(hostname)})
+	}
+	return answers, nil
+}
+
+func parseReverseName(name string) (string, bool) {
+	const suffix = ".in-addr.arpa."
+	name = canonicalName(name)
+	if !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, suffix), ".")
+	if len(labels) != net.IPv4len {
+		return "", false
+	}
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	ip := net.ParseIP(strings.Join(labels, ".")).To4()
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+func parseSRVName(name string) (string, bool) {
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) != 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return "", false
+	}
+	return labels[2], true
+}
+
+// addressType returns TypeA or TypeAAAA depending on the family of the IP.
+func addressType(ip string) dnsmessage.Type {
+	parsed := net.ParseIP(ip)
+	if parsed != nil && parsed.To4() == nil {
+		return dnsmessage.TypeAAAA
+	}
+	return dnsmessage.TypeA
+}
+
+// instanceName writes the IP as a single label, replacing the dots of an
+// IPv4 address or the colons of an IPv6 address with dashes.
+func instanceName(host sdcclient.Host, hostname string) string {
+	separator := "."
+	if addressType(host.IP) == dnsmessage.TypeAAAA {
+		separator = ":"
+	}
+	return strings.Replace(host.IP, separator, "-", -1) + "." + hostname
+}
+
+func parseInstanceName(name string) (string, string, bool) {
+	labels := strings.SplitN(name, ".", 2)
+	if len(labels) != 2 {
+		return "", "", false
+	}
+
+	ip := net.ParseIP(strings.Replace(labels[0], "-", ".", -1)).To4()
+	if ip == nil {
+		ip = net.ParseIP(strings.Replace(labels[0], "-", ":", -1))
+	}
+	if ip == nil {
+		return "", "", false
+	}
+	return ip.String(), labels[1], true
+}
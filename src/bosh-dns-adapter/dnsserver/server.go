@@ -0,0 +1,447 @@
+package dnsserver
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	minUDPSize        = 512
+	maxUDPSize        = 4096
+	maxTCPSize        = 65535
+	tcpIdleTimeout    = 10 * time.Second
+	queryTimeout      = 5 * time.Second
+	maxUDPWorkers     = 512
+	failureMetricName = "DNSRequestFailures"
+
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 86400
+)
+
+//go:generate counterfeiter -o fakes/resolver.go --fake-name Resolver . Resolver
+type Resolver interface {
+	Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error)
+}
+
+//go:generate counterfeiter -o fakes/reverse_resolver.go --fake-name ReverseResolver . ReverseResolver
+type ReverseResolver interface {
+	Hostnames(ctx context.Context, ip string) ([]string, error)
+}
+
+//go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
+type MetricsSender interface {
+	IncrementCounter(string)
+}
+
+type Server struct {
+	address       string
+	zones         Zones
+	metricsSender MetricsSender
+	logger        lager.Logger
+}
+
+func NewServer(address string, zones Zones, metricsSender MetricsSender, logger lager.Logger) *Server {
+	return &Server{
+		address:       address,
+		zones:         zones,
+		metricsSender: metricsSender,
+		logger:        logger,
+	}
+}
+
+func (s *Server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	packetConn, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return err
+	}
+	defer packetConn.Close()
+
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.serveUDP(packetConn) }()
+	go func() { errs <- s.serveTCP(listener) }()
+
+	s.logger.Info("dns-server-started", lager.Data{"address": s.address})
+	close(ready)
+
+	select {
+	case <-signals:
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// serveUDP answers at most maxUDPWorkers queries at once. While all of them
+// are busy, further queries wait in the socket buffer, and the kernel drops
+// them once it is full.
+func (s *Server) serveUDP(conn net.PacketConn) error {
+	workers := make(chan struct{}, maxUDPWorkers)
+	for {
+		buf := make([]byte, maxUDPSize)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		workers <- struct{}{}
+		go func() {
+			defer func() { <-workers }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+			defer cancel()
+
+			response, ok := s.respond(ctx, buf[:n], true)
+			if !ok {
+				return
+			}
+			_, err := conn.WriteTo(response, addr)
+			if err != nil {
+				s.logger.Error("dns-udp-write-failed", err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+		var length uint16
+		err := binary.Read(conn, binary.BigEndian, &length)
+		if err != nil {
+			return
+		}
+
+		query := make([]byte, length)
+		_, err = io.ReadFull(conn, query)
+		if err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		response, ok := s.respond(ctx, query, false)
+		cancel()
+		if !ok {
+			return
+		}
+
+		framed := make([]byte, 2, 2+len(response))
+		binary.BigEndian.PutUint16(framed, uint16(len(response)))
+		_, err = conn.Write(append(framed, response...))
+		if err != nil {
+			s.logger.Error("dns-tcp-write-failed", err)
+			return
+		}
+	}
+}
+
+// respond returns false when the query is too malformed to answer, in which
+// case it is dropped.
+func (s *Server) respond(ctx context.Context, query []byte, udp bool) ([]byte, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil, false
+	}
+
+	reply := reply{
+		header: dnsmessage.Header{
+			ID:               header.ID,
+			Response:         true,
+			OpCode:           header.OpCode,
+			RecursionDesired: header.RecursionDesired,
+		},
+		maxSize: maxTCPSize,
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		reply.header.RCode = dnsmessage.RCodeFormatError
+		return reply.pack()
+	}
+	reply.question = &questions[0]
+
+	udpSize, hasOPT, err := requestedUDPSize(&parser)
+	if err != nil {
+		reply.header.RCode = dnsmessage.RCodeFormatError
+		return reply.pack()
+	}
+	reply.opt = hasOPT
+	if udp {
+		reply.maxSize = udpSize
+	}
+
+	if header.OpCode != 0 {
+		reply.header.RCode = dnsmessage.RCodeNotImplemented
+		return reply.pack()
+	}
+
+	s.answer(ctx, &reply)
+	return reply.pack()
+}
+
+func (s *Server) answer(ctx context.Context, reply *reply) {
+	question := reply.question
+	name := strings.ToLower(question.Name.String())
+
+	zone, inZone := s.zones.Find(name)
+	if question.Class != dnsmessage.ClassINET || !inZone {
+		reply.header.RCode = dnsmessage.RCodeRefused
+		return
+	}
+	reply.header.Authoritative = true
+
+	answers, additionals, err := zone.Lookup(ctx, name, question.Type)
+	if err == sdcclient.ErrUnknownHostname {
+		reply.header.RCode = dnsmessage.RCodeNameError
+		reply.authorities = []Record{zone.SOA()}
+		s.logger.Debug("unknown-name", lager.Data{
+			"service-name": name,
+			"type":         question.Type.String(),
+		})
+		return
+	}
+	if err != nil {
+		reply.header.RCode = dnsmessage.RCodeServerFailure
+		s.logger.Error("could not connect to service discovery controller", err, lager.Data{
+			"service-name": name,
+		})
+		s.metricsSender.IncrementCounter(failureMetricName)
+		return
+	}
+	reply.answers = answers
+	reply.additionals = additionals
+	if len(answers) == 0 {
+		reply.authorities = []Record{zone.SOA()}
+	}
+
+	s.logger.Debug("success", lager.Data{
+		"answers":      len(answers),
+		"service-name": name,
+		"type":         question.Type.String(),
+	})
+}
+
+func requestedUDPSize(parser *dnsmessage.Parser) (int, bool, error) {
+	err := parser.SkipAllAnswers()
+	if err == nil {
+		err = parser.SkipAllAuthorities()
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	for {
+		header, err := parser.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return minUDPSize, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+
+		if header.Type == dnsmessage.TypeOPT {
+			size := int(header.Class)
+			if size < minUDPSize {
+				size = minUDPSize
+			}
+			if size > maxUDPSize {
+				size = maxUDPSize
+			}
+			return size, true, nil
+		}
+
+		err = parser.SkipAdditional()
+		if err != nil {
+			return 0, false, err
+		}
+	}
+}
+
+type reply struct {
+	header      dnsmessage.Header
+	question    *dnsmessage.Question
+	answers     []Record
+	authorities []Record
+	additionals []Record
+	opt         bool
+	maxSize     int
+}
+
+// pack drops the answers and sets the truncated bit when the response does
+// not fit, so that the client retries over TCP.
+func (r *reply) pack() ([]byte, bool) {
+	response, err := r.build()
+	if err == nil && len(response) > r.maxSize {
+		r.header.Truncated = true
+		r.answers = nil
+		r.additionals = nil
+		response, err = r.build()
+	}
+	if err != nil {
+		return nil, false // not tested
+	}
+	return response, true
+}
+
+func (r *reply) build() ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, r.header)
+	builder.EnableCompression()
+
+	err := builder.StartQuestions()
+	if err != nil {
+		return nil, err
+	}
+	if r.question != nil {
+		err = builder.Question(*r.question)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = builder.StartAnswers()
+	if err != nil {
+		return nil, err
+	}
+	for _, answer := range r.answers {
+		err = addRecord(&builder, r.question.Name, answer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = builder.StartAuthorities()
+	if err != nil {
+		return nil, err
+	}
+	for _, authority := range r.authorities {
+		name, err := dnsmessage.NewName(authority.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = addRecord(&builder, name, authority)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = builder.StartAdditionals()
+	if err != nil {
+		return nil, err
+	}
+	for _, additional := range r.additionals {
+		name, err := dnsmessage.NewName(additional.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = addRecord(&builder, name, additional)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.opt {
+		err = builder.OPTResource(dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName("."),
+			Class: dnsmessage.Class(maxUDPSize),
+		}, dnsmessage.OPTResource{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
+
+// addRecord writes the record with the given owner name, so that answers
+// keep the case the question was asked in.
+func addRecord(builder *dnsmessage.Builder, name dnsmessage.Name, record Record) error {
+	header := dnsmessage.ResourceHeader{
+		Name:  name,
+		Class: dnsmessage.ClassINET,
+		TTL:   record.TTL,
+	}
+
+	switch record.Type {
+	case dnsmessage.TypeA:
+		ip := net.ParseIP(record.IP).To4()
+		if ip == nil {
+			return nil
+		}
+		var a dnsmessage.AResource
+		copy(a.A[:], ip)
+		return builder.AResource(header, a)
+	case dnsmessage.TypeAAAA:
+		ip := net.ParseIP(record.IP)
+		if ip == nil {
+			return nil
+		}
+		var aaaa dnsmessage.AAAAResource
+		copy(aaaa.AAAA[:], ip.To16())
+		return builder.AAAAResource(header, aaaa)
+	case dnsmessage.TypeSRV:
+		target, err := dnsmessage.NewName(record.Target)
+		if err != nil {
+			return err
+		}
+		return builder.SRVResource(header, dnsmessage.SRVResource{
+			Port:   record.Port,
+			Target: target,
+		})
+	case dnsmessage.TypePTR:
+		ptr, err := dnsmessage.NewName(record.Target)
+		if err != nil {
+			return err
+		}
+		return builder.PTRResource(header, dnsmessage.PTRResource{PTR: ptr})
+	case dnsmessage.TypeSOA:
+		ns, err := dnsmessage.NewName(record.Name)
+		if err != nil {
+			return err
+		}
+		mbox, err := dnsmessage.NewName("hostmaster." + record.Name)
+		if err != nil {
+			return err
+		}
+		return builder.SOAResource(header, dnsmessage.SOAResource{
+			NS:      ns,
+			MBox:    mbox,
+			Serial:  1,
+			Refresh: soaRefresh,
+			Retry:   soaRetry,
+			Expire:  soaExpire,
+			MinTTL:  record.TTL,
+		})
+	}
+	return nil
+}
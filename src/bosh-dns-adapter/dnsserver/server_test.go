@@ -0,0 +1,660 @@
+package dnsserver_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	. "bosh-dns-adapter/dnsserver"
+	"bosh-dns-adapter/dnsserver/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		resolver      *fakes.Resolver
+		metricsSender *fakes.MetricsSender
+		serverProc    ifrit.Process
+		address       string
+		zones         Zones
+		fakeClock     *fakeclock.FakeClock
+	)
+
+	BeforeEach(func() {
+		address = fmt.Sprintf("127.0.0.1:%d", ports.PickAPort())
+		resolver = &fakes.Resolver{}
+		metricsSender = &fakes.MetricsSender{}
+		resolver.HostsReturns([]sdcclient.Host{
+			{IP: "192.168.0.1", Port: 8080},
+			{IP: "192.168.0.2", Port: 9090},
+		}, nil)
+
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		zones = NewZones(fakeClock, Zone{Domain: "apps.internal", Resolver: resolver, NegativeTTL: 15})
+	})
+
+	JustBeforeEach(func() {
+		server := NewServer(address, zones, metricsSender, lagertest.NewTestLogger("test"))
+		serverProc = ifrit.Invoke(server)
+	})
+
+	AfterEach(func() {
+		serverProc.Signal(os.Interrupt)
+		Eventually(serverProc.Wait()).Should(Receive(BeNil()))
+	})
+
+	buildQuery := func(header dnsmessage.Header, udpSize int, questions ...dnsmessage.Question) []byte {
+		builder := dnsmessage.NewBuilder(nil, header)
+		Expect(builder.StartQuestions()).To(Succeed())
+		for _, question := range questions {
+			Expect(builder.Question(question)).To(Succeed())
+		}
+		if udpSize != 0 {
+			Expect(builder.StartAdditionals()).To(Succeed())
+			Expect(builder.OPTResource(dnsmessage.ResourceHeader{
+				Name:  dnsmessage.MustNewName("."),
+				Class: dnsmessage.Class(udpSize),
+			}, dnsmessage.OPTResource{})).To(Succeed())
+		}
+		query, err := builder.Finish()
+		Expect(err).NotTo(HaveOccurred())
+		return query
+	}
+
+	question := func(name string, qtype dnsmessage.Type) dnsmessage.Question {
+		return dnsmessage.Question{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}
+	}
+
+	queryUDP := func(query []byte) dnsmessage.Message {
+		conn, err := net.Dial("udp", address)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.Write(query)
+		Expect(err).NotTo(HaveOccurred())
+
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		var response dnsmessage.Message
+		Expect(response.Unpack(buf[:n])).To(Succeed())
+		return response
+	}
+
+	queryTCP := func(query []byte) dnsmessage.Message {
+		conn, err := net.Dial("tcp", address)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		framed := make([]byte, 2, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		_, err = conn.Write(append(framed, query...))
+		Expect(err).NotTo(HaveOccurred())
+
+		var length uint16
+		Expect(binary.Read(conn, binary.BigEndian, &length)).To(Succeed())
+		buf := make([]byte, length)
+		_, err = io.ReadFull(conn, buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		var response dnsmessage.Message
+		Expect(response.Unpack(buf)).To(Succeed())
+		return response
+	}
+
+	answerIPs := func(response dnsmessage.Message) []string {
+		ips := []string{}
+		for _, answer := range response.Answers {
+			a, ok := answer.Body.(*dnsmessage.AResource)
+			Expect(ok).To(BeTrue())
+			ips = append(ips, net.IP(a.A[:]).String())
+		}
+		return ips
+	}
+
+	It("answers A queries over UDP", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42, RecursionDesired: true}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.ID).To(Equal(uint16(42)))
+		Expect(response.Header.Response).To(BeTrue())
+		Expect(response.Header.Authoritative).To(BeTrue())
+		Expect(response.Header.RecursionDesired).To(BeTrue())
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(response.Questions).To(HaveLen(1))
+		Expect(response.Questions[0].Name.String()).To(Equal("app-id.apps.internal."))
+		Expect(answerIPs(response)).To(Equal([]string{"192.168.0.1", "192.168.0.2"}))
+		Expect(response.Answers[0].Header.Name.String()).To(Equal("app-id.apps.internal."))
+		Expect(response.Answers[0].Header.TTL).To(Equal(uint32(0)))
+
+		Expect(resolver.HostsCallCount()).To(Equal(1))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+	})
+
+	It("answers A queries over TCP", func() {
+		response := queryTCP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(answerIPs(response)).To(Equal([]string{"192.168.0.1", "192.168.0.2"}))
+	})
+
+	It("gives each query a deadline", func() {
+		queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+		))
+		queryTCP(buildQuery(
+			dnsmessage.Header{ID: 43}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(resolver.HostsCallCount()).To(Equal(2))
+		for i := 0; i < 2; i++ {
+			ctx, _ := resolver.HostsArgsForCall(i)
+			deadline, ok := ctx.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now(), 5*time.Second))
+		}
+	})
+
+	It("matches the domain case insensitively", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("App-Id.Apps.Internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(response.Questions[0].Name.String()).To(Equal("App-Id.Apps.Internal."))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+	})
+
+	It("answers SRV queries with the port and a target per instance", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("_http._tcp.app-id.apps.internal.", dnsmessage.TypeSRV),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+
+		Expect(response.Answers).To(HaveLen(2))
+		srvs := map[uint16]string{}
+		for _, answer := range response.Answers {
+			Expect(answer.Header.Name.String()).To(Equal("_http._tcp.app-id.apps.internal."))
+			srv, ok := answer.Body.(*dnsmessage.SRVResource)
+			Expect(ok).To(BeTrue())
+			srvs[srv.Port] = srv.Target.String()
+		}
+		Expect(srvs).To(Equal(map[uint16]string{
+			8080: "192-168-0-1.app-id.apps.internal.",
+			9090: "192-168-0-2.app-id.apps.internal.",
+		}))
+
+		Expect(response.Additionals).To(HaveLen(2))
+		Expect(response.Additionals[0].Header.Name.String()).To(Equal("192-168-0-1.app-id.apps.internal."))
+		Expect(response.Additionals[0].Body).To(Equal(&dnsmessage.AResource{A: [4]byte{192, 168, 0, 1}}))
+	})
+
+	Context("when instances have no port", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns([]sdcclient.Host{{IP: "192.168.0.1"}}, nil)
+		})
+
+		It("leaves them out of SRV answers", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("_http._tcp.app-id.apps.internal.", dnsmessage.TypeSRV),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(BeEmpty())
+		})
+	})
+
+	It("resolves an SRV target to only that instance", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("192-168-0-2.app-id.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		_, name := resolver.HostsArgsForCall(0)
+		Expect(name).To(Equal("app-id.apps.internal."))
+		Expect(answerIPs(response)).To(Equal([]string{"192.168.0.2"}))
+	})
+
+	Context("when instances have IPv6 addresses", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns([]sdcclient.Host{
+				{IP: "192.168.0.1", Port: 8080},
+				{IP: "fd00::1", Port: 8080},
+			}, nil)
+		})
+
+		aaaaIPs := func(records []dnsmessage.Resource) []string {
+			ips := []string{}
+			for _, record := range records {
+				aaaa, ok := record.Body.(*dnsmessage.AAAAResource)
+				Expect(ok).To(BeTrue())
+				ips = append(ips, net.IP(aaaa.AAAA[:]).String())
+			}
+			return ips
+		}
+
+		It("answers AAAA queries with only the IPv6 addresses", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.apps.internal.", dnsmessage.TypeAAAA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(aaaaIPs(response.Answers)).To(Equal([]string{"fd00::1"}))
+		})
+
+		It("answers A queries with only the IPv4 addresses", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(answerIPs(response)).To(Equal([]string{"192.168.0.1"}))
+		})
+
+		It("points SRV answers at an IPv6 target", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("_http._tcp.app-id.apps.internal.", dnsmessage.TypeSRV),
+			))
+
+			Expect(response.Answers).To(HaveLen(2))
+			srv, ok := response.Answers[1].Body.(*dnsmessage.SRVResource)
+			Expect(ok).To(BeTrue())
+			Expect(srv.Target.String()).To(Equal("fd00--1.app-id.apps.internal."))
+			Expect(response.Additionals[1].Header.Name.String()).To(Equal("fd00--1.app-id.apps.internal."))
+			Expect(aaaaIPs(response.Additionals[1:])).To(Equal([]string{"fd00::1"}))
+		})
+
+		It("resolves an IPv6 SRV target to only that instance", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("fd00--1.app-id.apps.internal.", dnsmessage.TypeAAAA),
+			))
+
+			_, name := resolver.HostsArgsForCall(0)
+			Expect(name).To(Equal("app-id.apps.internal."))
+			Expect(aaaaIPs(response.Answers)).To(Equal([]string{"fd00::1"}))
+		})
+	})
+
+	Context("when a name only looks like an instance name", func() {
+		BeforeEach(func() {
+			resolver.HostsStub = func(ctx context.Context, name string) ([]sdcclient.Host, error) {
+				if name == "1-2-3-4.apps.internal." {
+					return []sdcclient.Host{{IP: "10.0.0.1"}}, nil
+				}
+				return []sdcclient.Host{}, nil
+			}
+		})
+
+		It("looks it up as it is", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("1-2-3-4.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(answerIPs(response)).To(Equal([]string{"10.0.0.1"}))
+		})
+	})
+
+	It("answers other record types with no answers", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeMX),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(response.Answers).To(BeEmpty())
+		Expect(resolver.HostsCallCount()).To(Equal(0))
+	})
+
+	Context("when the name does not exist", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns(nil, sdcclient.ErrUnknownHostname)
+		})
+
+		It("returns a name error with the SOA of the zone", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("missing.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+			Expect(response.Header.Authoritative).To(BeTrue())
+			Expect(response.Answers).To(BeEmpty())
+			Expect(response.Authorities).To(HaveLen(1))
+			Expect(response.Authorities[0].Header.Name.String()).To(Equal("apps.internal."))
+			Expect(response.Authorities[0].Header.TTL).To(Equal(uint32(15)))
+
+			soa, ok := response.Authorities[0].Body.(*dnsmessage.SOAResource)
+			Expect(ok).To(BeTrue())
+			Expect(soa.NS.String()).To(Equal("apps.internal."))
+			Expect(soa.MBox.String()).To(Equal("hostmaster.apps.internal."))
+			Expect(soa.MinTTL).To(Equal(uint32(15)))
+			Expect(metricsSender.IncrementCounterCallCount()).To(Equal(0))
+		})
+
+		It("returns a name error for instance names of unknown names", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("192-168-0-1.missing.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+			Expect(resolver.HostsCallCount()).To(Equal(2))
+		})
+
+		It("returns a name error for SRV queries", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("_http._tcp.missing.apps.internal.", dnsmessage.TypeSRV),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+		})
+	})
+
+	It("answers with the SOA of the zone when a name has no records of the type", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeAAAA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(response.Answers).To(BeEmpty())
+		Expect(response.Authorities).To(HaveLen(1))
+		Expect(response.Authorities[0].Header.Type).To(Equal(dnsmessage.TypeSOA))
+	})
+
+	It("refuses names outside of the domain", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("example.com.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeRefused))
+		Expect(response.Header.Authoritative).To(BeFalse())
+		Expect(resolver.HostsCallCount()).To(Equal(0))
+	})
+
+	Context("when there are several zones", func() {
+		var (
+			svcResolver     *fakes.Resolver
+			segmentResolver *fakes.Resolver
+		)
+
+		BeforeEach(func() {
+			svcResolver = &fakes.Resolver{}
+			svcResolver.HostsReturns([]sdcclient.Host{{IP: "10.0.0.1", Port: 8080}}, nil)
+			segmentResolver = &fakes.Resolver{}
+			segmentResolver.HostsReturns([]sdcclient.Host{{IP: "10.0.1.1"}}, nil)
+
+			zones = NewZones(
+				fakeClock,
+				Zone{Domain: "apps.internal.", Resolver: resolver},
+				Zone{Domain: "svc.internal.", Resolver: svcResolver, Types: []dnsmessage.Type{dnsmessage.TypeA}, TTL: 30},
+				Zone{Domain: "segment.apps.internal.", Resolver: segmentResolver},
+			)
+		})
+
+		It("looks names up with the resolver of their zone", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("platform.svc.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(answerIPs(response)).To(Equal([]string{"10.0.0.1"}))
+			Expect(resolver.HostsCallCount()).To(Equal(0))
+		})
+
+		It("looks names up in the innermost zone", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.segment.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(answerIPs(response)).To(Equal([]string{"10.0.1.1"}))
+			Expect(resolver.HostsCallCount()).To(Equal(0))
+		})
+
+		It("answers with the TTL of the zone", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("platform.svc.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Answers[0].Header.TTL).To(Equal(uint32(30)))
+		})
+
+		Context("when instances would go stale sooner than the TTL", func() {
+			BeforeEach(func() {
+				svcResolver.HostsReturns([]sdcclient.Host{
+					{IP: "10.0.0.1", StaleAt: fakeClock.Now().Add(10*time.Second + 500*time.Millisecond)},
+					{IP: "10.0.0.2", StaleAt: fakeClock.Now().Add(-time.Second)},
+					{IP: "10.0.0.3", StaleAt: fakeClock.Now().Add(time.Minute)},
+				}, nil)
+			})
+
+			It("cuts the TTL short", func() {
+				fakeClock.Increment(time.Second)
+
+				response := queryUDP(buildQuery(
+					dnsmessage.Header{ID: 42}, 0,
+					question("platform.svc.internal.", dnsmessage.TypeA),
+				))
+
+				Expect(response.Answers).To(HaveLen(3))
+				Expect(response.Answers[0].Header.TTL).To(Equal(uint32(9)))
+				Expect(response.Answers[1].Header.TTL).To(Equal(uint32(0)))
+				Expect(response.Answers[2].Header.TTL).To(Equal(uint32(30)))
+			})
+		})
+
+		It("answers record types the zone does not allow with no answers", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("_http._tcp.platform.svc.internal.", dnsmessage.TypeSRV),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(BeEmpty())
+			Expect(svcResolver.HostsCallCount()).To(Equal(0))
+		})
+
+		It("refuses names outside of every zone", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("other.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeRefused))
+		})
+	})
+
+	Context("when there is a reverse zone", func() {
+		var reverseResolver *fakes.ReverseResolver
+
+		BeforeEach(func() {
+			reverseResolver = &fakes.ReverseResolver{}
+			reverseResolver.HostnamesStub = func(ctx context.Context, ip string) ([]string, error) {
+				if ip == "10.255.0.2" {
+					return []string{"0.app-id.apps.internal.", "app-id.apps.internal"}, nil
+				}
+				return nil, sdcclient.ErrUnknownHostname
+			}
+
+			zones = NewZones(
+				fakeClock,
+				Zone{Domain: "apps.internal.", Resolver: resolver},
+				Zone{Domain: "255.10.in-addr.arpa.", Reverse: reverseResolver, Types: []dnsmessage.Type{dnsmessage.TypePTR}, TTL: 5, NegativeTTL: 15},
+			)
+		})
+
+		It("answers PTR queries with the hostnames of the address", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("2.0.255.10.in-addr.arpa.", dnsmessage.TypePTR),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Header.Authoritative).To(BeTrue())
+			Expect(response.Answers).To(HaveLen(2))
+			Expect(response.Answers[0].Header.TTL).To(Equal(uint32(5)))
+			Expect(response.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String()).To(Equal("0.app-id.apps.internal."))
+			Expect(response.Answers[1].Body.(*dnsmessage.PTRResource).PTR.String()).To(Equal("app-id.apps.internal."))
+
+			_, ip := reverseResolver.HostnamesArgsForCall(0)
+			Expect(ip).To(Equal("10.255.0.2"))
+		})
+
+		It("answers addresses that are not registered with a name error", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("3.0.255.10.in-addr.arpa.", dnsmessage.TypePTR),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+			Expect(response.Authorities).To(HaveLen(1))
+			Expect(response.Authorities[0].Header.Name.String()).To(Equal("255.10.in-addr.arpa."))
+		})
+
+		It("answers names that are not a whole address with no answers", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("0.255.10.in-addr.arpa.", dnsmessage.TypePTR),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(BeEmpty())
+			Expect(reverseResolver.HostnamesCallCount()).To(Equal(0))
+		})
+
+		It("answers other record types with no answers", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("2.0.255.10.in-addr.arpa.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(BeEmpty())
+			Expect(reverseResolver.HostnamesCallCount()).To(Equal(0))
+		})
+	})
+
+	It("returns a format error when there is more than one question", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+			question("other.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.ID).To(Equal(uint16(42)))
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeFormatError))
+	})
+
+	It("returns not implemented for opcodes other than query", func() {
+		response := queryUDP(buildQuery(
+			dnsmessage.Header{ID: 42, OpCode: 2}, 0,
+			question("app-id.apps.internal.", dnsmessage.TypeA),
+		))
+
+		Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeNotImplemented))
+		Expect(resolver.HostsCallCount()).To(Equal(0))
+	})
+
+	Context("when the service discovery controller lookup fails", func() {
+		BeforeEach(func() {
+			resolver.HostsReturns(nil, errors.New("potato"))
+		})
+
+		It("returns a server failure and emits a metric", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeServerFailure))
+			Expect(metricsSender.IncrementCounterCallCount()).To(Equal(1))
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("DNSRequestFailures"))
+		})
+	})
+
+	Context("when the answers do not fit in a UDP response", func() {
+		BeforeEach(func() {
+			hosts := []sdcclient.Host{}
+			for i := 0; i < 100; i++ {
+				hosts = append(hosts, sdcclient.Host{IP: fmt.Sprintf("10.0.0.%d", i)})
+			}
+			resolver.HostsReturns(hosts, nil)
+		})
+
+		It("sets the truncated bit and drops the answers", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.Truncated).To(BeTrue())
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(BeEmpty())
+		})
+
+		It("returns all of the answers over TCP", func() {
+			response := queryTCP(buildQuery(
+				dnsmessage.Header{ID: 42}, 0,
+				question("app-id.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.Truncated).To(BeFalse())
+			Expect(response.Answers).To(HaveLen(100))
+		})
+
+		It("uses the UDP size advertised with EDNS0", func() {
+			response := queryUDP(buildQuery(
+				dnsmessage.Header{ID: 42}, 4096,
+				question("app-id.apps.internal.", dnsmessage.TypeA),
+			))
+
+			Expect(response.Header.Truncated).To(BeFalse())
+			Expect(response.Answers).To(HaveLen(100))
+			Expect(response.Additionals).To(HaveLen(1))
+			Expect(response.Additionals[0].Header.Type).To(Equal(dnsmessage.TypeOPT))
+		})
+	})
+})
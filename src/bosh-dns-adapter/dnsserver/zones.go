@@ -0,0 +1,125 @@
+package dnsserver
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Zone is an internal domain along with where its names are resolved and how
+// they are answered. A zone without Types answers every supported type.
+// NegativeTTL is how long resolvers may remember that a name or record type
+// does not exist. A reverse zone, such as 255.10.in-addr.arpa., answers PTR
+// queries through Reverse instead of Resolver.
+type Zone struct {
+	Domain      string
+	Resolver    Resolver
+	Reverse     ReverseResolver
+	Types       []dnsmessage.Type
+	TTL         uint32
+	NegativeTTL uint32
+
+	clock clock.Clock
+}
+
+// Zones finds the zone a name belongs to. A name in nested zones belongs to
+// the innermost one.
+type Zones []Zone
+
+// NewZones gives the zones the clock their TTLs are cut short by.
+func NewZones(clock clock.Clock, zones ...Zone) Zones {
+	normalized := make(Zones, len(zones))
+	for i, zone := range zones {
+		zone.Domain = canonicalName(zone.Domain)
+		zone.clock = clock
+		normalized[i] = zone
+	}
+
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return len(normalized[i].Domain) > len(normalized[j].Domain)
+	})
+	return normalized
+}
+
+func (z Zones) Find(name string) (Zone, bool) {
+	name = canonicalName(name)
+	for _, zone := range z {
+		if name == zone.Domain || strings.HasSuffix(name, "."+zone.Domain) {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
+
+func (z Zone) Allows(qtype dnsmessage.Type) bool {
+	if len(z.Types) == 0 {
+		return true
+	}
+	for _, allowed := range z.Types {
+		if allowed == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup is Lookup against the zone's resolver, with no answers for types the
+// zone does not allow. Records get the zone's TTL, cut short to when the
+// controller would drop the instance unless it is registered again, so that
+// resolvers never cache an answer for longer than the controller would.
+func (z Zone) Lookup(ctx context.Context, name string, qtype dnsmessage.Type) ([]Record, []Record, error) {
+	if !z.Allows(qtype) {
+		return nil, nil, nil
+	}
+
+	var (
+		answers, additionals []Record
+		err                  error
+	)
+	if z.Reverse != nil {
+		answers, err = LookupPTR(ctx, z.Reverse, name, qtype)
+	} else {
+		answers, additionals, err = Lookup(ctx, z.Resolver, name, qtype)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := z.clock.Now()
+	for i := range answers {
+		answers[i].TTL = z.ttl(answers[i], now)
+	}
+	for i := range additionals {
+		additionals[i].TTL = z.ttl(additionals[i], now)
+	}
+	return answers, additionals, nil
+}
+
+func (z Zone) ttl(record Record, now time.Time) uint32 {
+	if record.staleAt.IsZero() {
+		return z.TTL
+	}
+
+	remaining := record.staleAt.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	if seconds := uint32(remaining / time.Second); seconds < z.TTL {
+		return seconds
+	}
+	return z.TTL
+}
+
+// SOA is the record answered in the authority section when a name or record
+// type does not exist, which resolvers cache the negative answer by.
+func (z Zone) SOA() Record {
+	return Record{Name: z.Domain, Type: dnsmessage.TypeSOA, TTL: z.NegativeTTL}
+}
+
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".") + ".")
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bosh-dns-adapter/cache"
+	"bosh-dns-adapter/coalesce"
 	"bosh-dns-adapter/config"
+	"bosh-dns-adapter/dnsserver"
+	"bosh-dns-adapter/replica"
 	"bosh-dns-adapter/sdcclient"
 	"encoding/json"
 	"errors"
@@ -20,6 +24,7 @@ import (
 	"code.cloudfoundry.org/cf-networking-helpers/lagerlevel"
 	"code.cloudfoundry.org/cf-networking-helpers/metrics"
 	"code.cloudfoundry.org/cf-networking-helpers/middleware"
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 	"github.com/cloudfoundry/dropsonde"
 	"github.com/tedsuo/ifrit"
@@ -28,6 +33,19 @@ import (
 	"golang.org/x/net/dns/dnsmessage"
 )
 
+var supportedTypes = map[string]dnsmessage.Type{
+	"1":  dnsmessage.TypeA,
+	"28": dnsmessage.TypeAAAA,
+	"12": dnsmessage.TypePTR,
+	"33": dnsmessage.TypeSRV,
+}
+
+var recordTypeNames = map[string]dnsmessage.Type{
+	"A":    dnsmessage.TypeA,
+	"AAAA": dnsmessage.TypeAAAA,
+	"SRV":  dnsmessage.TypeSRV,
+}
+
 func main() {
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGTERM, os.Interrupt)
@@ -60,11 +78,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	sdcServerUrl := fmt.Sprintf("https://%s:%s",
-		config.ServiceDiscoveryControllerAddress,
-		config.ServiceDiscoveryControllerPort,
-	)
-
 	metronAddress := fmt.Sprintf("127.0.0.1:%d", config.MetronPort)
 	err = dropsonde.Initialize(metronAddress, "bosh-dns-adapter")
 	if err != nil {
@@ -72,18 +85,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	sdcClient, err := sdcclient.NewServiceDiscoveryClient(sdcServerUrl, config.CACert, config.ClientCert, config.ClientKey)
-	if err != nil {
-		logger.Error("Unable to create service discovery client", err)
-		os.Exit(1)
-	}
-
 	requestLogger := logger.Session("serve-request")
 
 	metricSender := metrics.MetricsSender{
 		Logger: logger.Session("bosh-dns-adapter"),
 	}
 
+	retryPolicy := sdcclient.DefaultRetryPolicy
+	if config.ServiceDiscoveryControllerQueryTimeoutMs > 0 {
+		retryPolicy.QueryTimeout = time.Duration(config.ServiceDiscoveryControllerQueryTimeoutMs) * time.Millisecond
+	}
+	retryPolicy.BreakerThreshold = config.ServiceDiscoveryControllerBreakerFailures
+	if config.ServiceDiscoveryControllerBreakerCooldownSeconds > 0 {
+		retryPolicy.BreakerCooldown = time.Duration(config.ServiceDiscoveryControllerBreakerCooldownSeconds) * time.Second
+	}
+
+	backends := []*backend{}
+	backendsByURLs := map[string]*backend{}
+	backendFor := func(sdcServerUrls []string, sdcServerName string) *backend {
+		key := strings.Join(sdcServerUrls, ",")
+		if existing, ok := backendsByURLs[key]; ok {
+			return existing
+		}
+
+		created, err := newBackend(sdcServerUrls, sdcServerName, config, retryPolicy, &metricSender, logger)
+		if err != nil {
+			logger.Error("Unable to create service discovery client", err)
+			os.Exit(1)
+		}
+		backendsByURLs[key] = created
+		backends = append(backends, created)
+		return created
+	}
+
+	zones := []dnsserver.Zone{}
+	for _, domain := range config.InternalDomains() {
+		domainBackend := backendFor(sdcServerURLs(config, domain))
+		zones = append(zones, dnsserver.Zone{
+			Domain:      domain.Domain,
+			Resolver:    domainBackend.resolver,
+			Types:       recordTypes(domain.RecordTypes),
+			TTL:         uint32(domain.TTLSeconds),
+			NegativeTTL: uint32(domain.NegativeTTLSeconds),
+		})
+	}
+	if reverseDomain := config.ReverseDomain(); reverseDomain != "" {
+		reverseBackend := backendFor(reverseServerURLs(config))
+		zones = append(zones, dnsserver.Zone{
+			Domain:  reverseDomain,
+			Reverse: reverseBackend.client,
+			Types:   []dnsmessage.Type{dnsmessage.TypePTR},
+		})
+	}
+	internalZones := dnsserver.NewZones(clock.NewClock(), zones...)
+
 	metricsWrap := func(name string, handler http.Handler) http.Handler {
 		metricsWrapper := middleware.MetricWrapper{
 			Name:          name,
@@ -92,64 +147,176 @@ func main() {
 		return metricsWrapper.Wrap(handler)
 	}
 
-	go func() {
-		http.Serve(l, metricsWrap("GetIPs", http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-			dnsType := getQueryParam(req, "type", "1")
-			name := getQueryParam(req, "name", "")
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", metricsWrap("DoHQuery", dnsserver.NewDoHHandler(
+		internalZones,
+		&metricSender,
+		logger.Session("doh"),
+	)))
+	mux.Handle("/", metricsWrap("GetIPs", http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		dnsType := getQueryParam(req, "type", "1")
+		name := getQueryParam(req, "name", "")
+
+		qtype, supported := supportedTypes[dnsType]
+		if !supported {
+			writeResponse(resp, dnsmessage.RCodeSuccess, name, dnsType, nil, nil, nil, logger)
+			requestLogger.Debug("unsupported record type", lager.Data{
+				"ips":          "",
+				"service-name": name,
+			})
+			return
+		}
+
+		if name == "" {
+			resp.WriteHeader(http.StatusBadRequest)
+			writeResponse(resp, dnsmessage.RCodeServerFailure, name, dnsType, nil, nil, nil, logger)
+			requestLogger.Debug("name parameter empty", lager.Data{
+				"ips":          "",
+				"service-name": "",
+			})
+			return
+		}
+
+		zone, inZone := internalZones.Find(name)
+		if !inZone {
+			writeResponse(resp, dnsmessage.RCodeRefused, name, dnsType, nil, nil, nil, logger)
+			requestLogger.Debug("name outside of internal domains", lager.Data{
+				"ips":          "",
+				"service-name": name,
+			})
+			return
+		}
 
-			if dnsType != "1" {
-				writeResponse(resp, dnsmessage.RCodeSuccess, name, dnsType, nil, logger)
-				requestLogger.Debug("unsupported record type", lager.Data{
+		answers, additionals, err := zone.Lookup(req.Context(), name, qtype)
+		if err == sdcclient.ErrUnknownHostname {
+			writeResponse(resp, dnsmessage.RCodeNameError, name, dnsType, nil, []dnsserver.Record{zone.SOA()}, nil, logger)
+			requestLogger.Debug("unknown name", lager.Data{
+				"ips":          "",
+				"service-name": name,
+			})
+			return
+		}
+		if err != nil {
+			wrappedErr := errors.New(fmt.Sprintf("Error querying Service Discover Controller: %s", err))
+			writeErrorResponse(resp, wrappedErr, logger)
+			requestLogger.Error("could not connect to service discovery controller",
+				wrappedErr,
+				lager.Data{
 					"ips":          "",
 					"service-name": name,
 				})
-				return
-			}
 
-			if name == "" {
-				resp.WriteHeader(http.StatusBadRequest)
-				writeResponse(resp, dnsmessage.RCodeServerFailure, name, dnsType, nil, logger)
-				requestLogger.Debug("name parameter empty", lager.Data{
-					"ips":          "",
-					"service-name": "",
-				})
-				return
-			}
+			metricSender.IncrementCounter("DNSRequestFailures")
+			return
+		}
 
-			ips, err := sdcClient.IPs(name)
-			if err != nil {
-				wrappedErr := errors.New(fmt.Sprintf("Error querying Service Discover Controller: %s", err))
-				writeErrorResponse(resp, wrappedErr, logger)
-				requestLogger.Error("could not connect to service discovery controller",
-					wrappedErr,
-					lager.Data{
-						"ips":          "",
-						"service-name": name,
-					})
-
-				metricSender.IncrementCounter("DNSRequestFailures")
-				return
-			}
+		writeResponse(resp, dnsmessage.RCodeSuccess, name, dnsType, answers, nil, additionals, logger)
+		requestLogger.Debug("success", lager.Data{
+			"ips":          strings.Join(recordIPs(append(answers, additionals...)), ","),
+			"service-name": name,
+		})
+	})))
 
-			writeResponse(resp, dnsmessage.RCodeSuccess, name, dnsType, ips, logger)
-			requestLogger.Debug("success", lager.Data{
-				"ips":          strings.Join(ips, ","),
-				"service-name": name,
-			})
-		})))
+	go func() {
+		http.Serve(l, mux)
 	}()
 
-	uptimeSource := metrics.NewUptimeSource()
+	var (
+		healthyBackendsGetters []func() (float64, error)
+		breakerStateGetters    []func() (float64, error)
+		cacheEntriesGetters    []func() (float64, error)
+		replicaAgeGetters      []func() (float64, error)
+	)
+	for _, domainBackend := range backends {
+		healthyBackendsGetters = append(healthyBackendsGetters, domainBackend.client.GetHealthyBackends)
+		breakerStateGetters = append(breakerStateGetters, domainBackend.client.GetCircuitBreakerState)
+		if domainBackend.cache != nil {
+			cacheEntriesGetters = append(cacheEntriesGetters, domainBackend.cache.GetEntries)
+		}
+		if domainBackend.replica != nil {
+			replicaAgeGetters = append(replicaAgeGetters, domainBackend.replica.GetAgeSeconds)
+		}
+	}
+
+	metricSources := []metrics.MetricSource{
+		metrics.NewUptimeSource(),
+		{
+			Name:   "SDCHealthyBackends",
+			Unit:   "backends",
+			Getter: sumOf(healthyBackendsGetters),
+		},
+		{
+			Name:   "SDCCircuitBreakerState",
+			Unit:   "state",
+			Getter: maxOf(breakerStateGetters),
+		},
+	}
+	if len(cacheEntriesGetters) > 0 {
+		metricSources = append(metricSources, metrics.MetricSource{
+			Name:   "DNSCacheEntries",
+			Unit:   "entries",
+			Getter: sumOf(cacheEntriesGetters),
+		})
+	}
+	if len(replicaAgeGetters) > 0 {
+		metricSources = append(metricSources, metrics.MetricSource{
+			Name:   "DNSReplicaAgeSeconds",
+			Unit:   "seconds",
+			Getter: maxOf(replicaAgeGetters),
+		})
+	}
 	metricsEmitter := metrics.NewMetricsEmitter(
 		lager.NewLogger("bosh-dns-adapter"),
 		time.Duration(config.MetricsEmitSeconds)*time.Second,
-		uptimeSource,
+		metricSources...,
 	)
 
 	members := grouper.Members{
 		{"metrics-emitter", metricsEmitter},
 		{"log-level-server", lagerlevel.NewServer(config.LogLevelAddress, config.LogLevelPort, sink, logger.Session("log-level-server"))},
 	}
+
+	for i, domainBackend := range backends {
+		members = append(members, domainBackend.members(i, config)...)
+	}
+	if config.DNSPort != 0 {
+		dnsAddress := config.DNSAddress
+		if dnsAddress == "" {
+			dnsAddress = config.Address
+		}
+		dnsServer := dnsserver.NewServer(
+			fmt.Sprintf("%s:%d", dnsAddress, config.DNSPort),
+			internalZones,
+			&metricSender,
+			logger.Session("dns-server"),
+		)
+		members = append(members, grouper.Member{"dns-server", dnsServer})
+	}
+	if config.DoHPort != 0 {
+		dohAddress := config.DoHAddress
+		if dohAddress == "" {
+			dohAddress = config.Address
+		}
+		dohMux := http.NewServeMux()
+		dohMux.Handle("/dns-query", metricsWrap("DoHQuery", dnsserver.NewDoHHandler(
+			internalZones,
+			&metricSender,
+			logger.Session("doh"),
+		)))
+		dohServer, err := dnsserver.NewDoHServer(
+			fmt.Sprintf("%s:%d", dohAddress, config.DoHPort),
+			config.DoHServerCert,
+			config.DoHServerKey,
+			dohMux,
+			logger.Session("doh-server"),
+		)
+		if err != nil {
+			logger.Error("Unable to create doh server", err)
+			os.Exit(1)
+		}
+		members = append(members, grouper.Member{"doh-server", dohServer})
+	}
+
 	group := grouper.NewOrdered(os.Interrupt, members)
 	monitor := ifrit.Invoke(sigmon.New(group))
 
@@ -187,8 +354,8 @@ func writeErrorResponse(resp http.ResponseWriter, err error, logger lager.Logger
 	}
 }
 
-func writeResponse(resp http.ResponseWriter, dnsResponseStatus dnsmessage.RCode, requestedInfraName string, dnsType string, ips []string, logger lager.Logger) {
-	responseBody, err := buildResponseBody(dnsResponseStatus, requestedInfraName, dnsType, ips)
+func writeResponse(resp http.ResponseWriter, dnsResponseStatus dnsmessage.RCode, requestedInfraName string, dnsType string, answers, authorities, additionals []dnsserver.Record, logger lager.Logger) {
+	responseBody, err := buildResponseBody(dnsResponseStatus, requestedInfraName, dnsType, answers, authorities, additionals)
 	if err != nil {
 		logger.Error("Error building response", err)
 		return
@@ -209,18 +376,24 @@ type Answer struct {
 	Data   string `json:"data"`
 }
 
-func buildResponseBody(dnsResponseStatus dnsmessage.RCode, requestedInfraName string, dnsType string, ips []string) (string, error) {
-	answers := make([]Answer, len(ips), len(ips))
-	for i, ip := range ips {
-		answers[i] = Answer{
-			Name:   requestedInfraName,
-			RRType: uint16(dnsmessage.TypeA),
-			Data:   ip,
-			TTL:    0,
+// buildResponseBody only writes the authority section when there is one, as
+// it is only used for negative answers.
+func buildResponseBody(dnsResponseStatus dnsmessage.RCode, requestedInfraName string, dnsType string, answers, authorities, additionals []dnsserver.Record) (string, error) {
+	answersBytes, err := json.Marshal(recordsToAnswers(answers))
+	if err != nil {
+		return "", err // not tested
+	}
+
+	authority := ""
+	if len(authorities) > 0 {
+		authoritiesBytes, err := json.Marshal(recordsToAnswers(authorities))
+		if err != nil {
+			return "", err // not tested
 		}
+		authority = fmt.Sprintf(`"Authority": %s,`, authoritiesBytes)
 	}
 
-	bytes, err := json.Marshal(answers)
+	additionalsBytes, err := json.Marshal(recordsToAnswers(additionals))
 	if err != nil {
 		return "", err // not tested
 	}
@@ -240,9 +413,188 @@ func buildResponseBody(dnsResponseStatus dnsmessage.RCode, requestedInfraName st
 			}
 		],
 		"Answer": %s,
-		"Additional": [ ],
+		%s
+		"Additional": %s,
 		"edns_client_subnet": "0.0.0.0/0"
 	}`
 
-	return fmt.Sprintf(template, dnsResponseStatus, requestedInfraName, dnsType, string(bytes)), nil
+	return fmt.Sprintf(template, dnsResponseStatus, requestedInfraName, dnsType, string(answersBytes), authority, string(additionalsBytes)), nil
+}
+
+func recordsToAnswers(records []dnsserver.Record) []Answer {
+	answers := make([]Answer, len(records), len(records))
+	for i, record := range records {
+		answers[i] = Answer{
+			Name:   record.Name,
+			RRType: uint16(record.Type),
+			Data:   record.Data(),
+			TTL:    record.TTL,
+		}
+	}
+	return answers
+}
+
+func recordIPs(records []dnsserver.Record) []string {
+	ips := []string{}
+	for _, record := range records {
+		if record.IP != "" {
+			ips = append(ips, record.IP)
+		}
+	}
+	return ips
+}
+
+// backend looks names up on one set of service discovery controller
+// instances, for every domain that uses them.
+type backend struct {
+	client   *sdcclient.ServiceDiscoveryClient
+	resolver dnsserver.Resolver
+	cache    *cache.Cache
+	replica  *replica.Replica
+	logger   lager.Logger
+}
+
+func newBackend(serverURLs []string, serverName string, adapterConfig *config.Config, retryPolicy sdcclient.RetryPolicy, metricSender *metrics.MetricsSender, logger lager.Logger) (*backend, error) {
+	client, err := sdcclient.NewServiceDiscoveryClientWithBackends(
+		serverURLs,
+		serverName,
+		adapterConfig.CACert,
+		adapterConfig.ClientCert,
+		adapterConfig.ClientKey,
+		retryPolicy,
+		clock.NewClock(),
+		metricSender,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	coalescer := coalesce.New(client, metricSender)
+	b := &backend{
+		client:   client,
+		resolver: coalescer,
+		logger:   logger.WithData(lager.Data{"service-discovery-controllers": serverURLs}),
+	}
+
+	if adapterConfig.ReplicaEnabled {
+		b.replica = replica.New(
+			client,
+			coalescer,
+			time.Duration(adapterConfig.ReplicaMaxStalenessSeconds)*time.Second,
+			clock.NewClock(),
+			metricSender,
+			b.logger.Session("replica"),
+		)
+		b.resolver = b.replica
+	} else if adapterConfig.CacheTTLSeconds > 0 {
+		b.cache = cache.New(
+			coalescer,
+			time.Duration(adapterConfig.CacheTTLSeconds)*time.Second,
+			time.Duration(adapterConfig.CacheNegativeTTLSeconds)*time.Second,
+			time.Duration(adapterConfig.CacheMaxStaleSeconds)*time.Second,
+			adapterConfig.CacheMaxEntries,
+			clock.NewClock(),
+			metricSender,
+		)
+		b.resolver = b.cache
+	}
+
+	return b, nil
+}
+
+// members returns the processes that keep the backend up to date, named with
+// the index of the backend when it is not the first.
+func (b *backend) members(index int, adapterConfig *config.Config) grouper.Members {
+	name := func(name string) string {
+		if index == 0 {
+			return name
+		}
+		return fmt.Sprintf("%s-%d", name, index)
+	}
+
+	members := grouper.Members{}
+	if b.cache != nil {
+		cacheWatcher := cache.NewWatcher(b.client, b.cache, clock.NewClock(), b.logger.Session("cache-watcher"))
+		members = append(members, grouper.Member{name("cache-watcher"), cacheWatcher})
+	}
+	if b.replica != nil {
+		members = append(members, grouper.Member{name("replica"), b.replica})
+	}
+	if adapterConfig.ServiceDiscoveryControllerHealthCheckSeconds > 0 {
+		healthChecker := sdcclient.NewHealthChecker(
+			b.client,
+			time.Duration(adapterConfig.ServiceDiscoveryControllerHealthCheckSeconds)*time.Second,
+			clock.NewClock(),
+		)
+		members = append(members, grouper.Member{name("sdc-health-checker"), healthChecker})
+	}
+	return members
+}
+
+// reverseServerURLs returns the top level service discovery controller
+// instances, which addresses in the overlay network are looked up on.
+func reverseServerURLs(adapterConfig *config.Config) ([]string, string) {
+	return sdcServerURLs(adapterConfig, config.Domain{})
+}
+
+// sdcServerURLs returns the service discovery controller instances for the
+// domain, falling back to the top level ones, and the name their certificates
+// are checked against.
+func sdcServerURLs(adapterConfig *config.Config, domain config.Domain) ([]string, string) {
+	port := domain.ServiceDiscoveryControllerPort
+	if port == "" {
+		port = adapterConfig.ServiceDiscoveryControllerPort
+	}
+
+	addresses := domain.ServiceDiscoveryControllerAddresses
+	if len(addresses) == 0 {
+		addresses = adapterConfig.ServiceDiscoveryControllerAddresses
+	}
+	if len(addresses) == 0 {
+		return []string{fmt.Sprintf("https://%s", net.JoinHostPort(adapterConfig.ServiceDiscoveryControllerAddress, port))}, ""
+	}
+
+	serverURLs := []string{}
+	for _, sdcAddress := range addresses {
+		serverURLs = append(serverURLs, fmt.Sprintf("https://%s", net.JoinHostPort(sdcAddress, port)))
+	}
+	return serverURLs, adapterConfig.ServiceDiscoveryControllerAddress
+}
+
+func recordTypes(names []string) []dnsmessage.Type {
+	types := []dnsmessage.Type{}
+	for _, name := range names {
+		types = append(types, recordTypeNames[name])
+	}
+	return types
+}
+
+func sumOf(getters []func() (float64, error)) func() (float64, error) {
+	return func() (float64, error) {
+		sum := 0.0
+		for _, getter := range getters {
+			value, err := getter()
+			if err != nil {
+				return 0, err
+			}
+			sum += value
+		}
+		return sum, nil
+	}
+}
+
+func maxOf(getters []func() (float64, error)) func() (float64, error) {
+	return func() (float64, error) {
+		max := 0.0
+		for _, getter := range getters {
+			value, err := getter()
+			if err != nil {
+				return 0, err
+			}
+			if value > max {
+				max = value
+			}
+		}
+		return max, nil
+	}
 }
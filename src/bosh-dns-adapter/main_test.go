@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 	"github.com/onsi/gomega/gexec"
 	"github.com/onsi/gomega/ghttp"
 	"github.com/onsi/gomega/types"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 var _ = Describe("Main", func() {
@@ -90,7 +92,9 @@ var _ = Describe("Main", func() {
 			"metron_port": %d,
 			"metrics_emit_seconds": 2,
 			"log_level_port": %d,
-			"log_level_address": "127.0.0.1"
+			"log_level_address": "127.0.0.1",
+			"domains": [{"domain": "apps.internal."}, {"domain": "internal.local."}],
+			"overlay_network": "10.255.0.0/16"
 		}`, dnsAdapterAddress,
 			dnsAdapterPort,
 			strings.TrimPrefix(urlParts[1], "//"),
@@ -284,6 +288,39 @@ var _ = Describe("Main", func() {
 		})
 	})
 
+	Context("when the name is outside of the internal domains", func() {
+		It("returns a refused status without querying the service discovery controller", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+
+			url := fmt.Sprintf("http://127.0.0.1:%s?type=1&name=app-id.example.com.", dnsAdapterPort)
+			resp, err := http.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(all)).To(MatchJSON(`{
+				"Status": 5,
+				"TC": false,
+				"RD": false,
+				"RA": false,
+				"AD": false,
+				"CD": false,
+				"Question":
+				[
+					{
+						"name": "app-id.example.com.",
+						"type": 1
+					}
+				],
+				"Answer": [],
+				"Additional": [],
+				"edns_client_subnet": "0.0.0.0/0"
+			}`))
+			Expect(fakeServiceDiscoveryControllerServer.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
 	Context("when 'name' url param is not provided", func() {
 		It("returns a http 400 status", func() {
 			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
@@ -417,6 +454,278 @@ var _ = Describe("Main", func() {
 		})
 	})
 
+	Context("when requesting an AAAA record", func() {
+		BeforeEach(func() {
+			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/registration/app-id.internal.local."),
+				ghttp.RespondWith(200, `{
+					"env": "",
+					"hosts": [
+					{
+						"ip_address": "192.168.0.1",
+						"port": 0
+					},
+					{
+						"ip_address": "fd00::1",
+						"port": 0
+					}],
+					"service": ""
+				}`),
+			)}
+		})
+
+		It("should return only the IPv6 addresses", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+			url := fmt.Sprintf("http://127.0.0.1:%s?type=28&name=app-id.internal.local.", dnsAdapterPort)
+			request, err := http.NewRequest("GET", url, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(all)).To(MatchJSON(`{
+					"Status": 0,
+					"TC": false,
+					"RD": false,
+					"RA": false,
+					"AD": false,
+					"CD": false,
+					"Question":
+					[
+						{
+							"name": "app-id.internal.local.",
+							"type": 28
+						}
+					],
+					"Answer":
+					[
+						{
+							"name": "app-id.internal.local.",
+							"type": 28,
+							"TTL":  0,
+							"data": "fd00::1"
+						}
+					],
+					"Additional": [ ],
+					"edns_client_subnet": "0.0.0.0/0"
+				}`))
+		})
+	})
+
+	Context("when requesting an SRV record", func() {
+		BeforeEach(func() {
+			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/registration/app-id.internal.local."),
+				ghttp.RespondWith(200, `{
+					"env": "",
+					"hosts": [
+					{
+						"ip_address": "192.168.0.1",
+						"last_check_in": "",
+						"port": 8080,
+						"revision": "",
+						"service": "",
+						"service_repo_name": "",
+						"tags": {}
+					}],
+					"service": ""
+				}`),
+			)}
+		})
+
+		It("should return the port and a target for each instance", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+			url := fmt.Sprintf("http://127.0.0.1:%s?type=33&name=_http._tcp.app-id.internal.local.", dnsAdapterPort)
+			request, err := http.NewRequest("GET", url, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(all)).To(MatchJSON(`{
+					"Status": 0,
+					"TC": false,
+					"RD": false,
+					"RA": false,
+					"AD": false,
+					"CD": false,
+					"Question":
+					[
+						{
+							"name": "_http._tcp.app-id.internal.local.",
+							"type": 33
+						}
+					],
+					"Answer":
+					[
+						{
+							"name": "_http._tcp.app-id.internal.local.",
+							"type": 33,
+							"TTL":  0,
+							"data": "0 0 8080 192-168-0-1.app-id.internal.local."
+						}
+					],
+					"Additional":
+					[
+						{
+							"name": "192-168-0-1.app-id.internal.local.",
+							"type": 1,
+							"TTL":  0,
+							"data": "192.168.0.1"
+						}
+					],
+					"edns_client_subnet": "0.0.0.0/0"
+				}`))
+		})
+	})
+
+	Context("when querying over DNS-over-HTTPS", func() {
+		BeforeEach(func() {
+			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+				ghttp.RespondWith(200, `{"hosts": [{"ip_address": "192.168.0.1"}]}`),
+			)}
+		})
+
+		It("answers with a DNS message", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+
+			builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+			Expect(builder.StartQuestions()).To(Succeed())
+			Expect(builder.Question(dnsmessage.Question{
+				Name:  dnsmessage.MustNewName("app-id.apps.internal."),
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			})).To(Succeed())
+			query, err := builder.Finish()
+			Expect(err).ToNot(HaveOccurred())
+
+			url := fmt.Sprintf("http://127.0.0.1:%s/dns-query", dnsAdapterPort)
+			resp, err := http.Post(url, "application/dns-message", bytes.NewReader(query))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/dns-message"))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			var response dnsmessage.Message
+			Expect(response.Unpack(all)).To(Succeed())
+			Expect(response.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+			Expect(response.Answers).To(HaveLen(1))
+			Expect(response.Answers[0].Body).To(Equal(&dnsmessage.AResource{A: [4]byte{192, 168, 0, 1}}))
+		})
+	})
+
+	Context("when requesting a PTR record for an overlay address", func() {
+		BeforeEach(func() {
+			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/reverse/10.255.0.2"),
+					ghttp.RespondWith(200, `{"ip": "10.255.0.2", "hostnames": ["app-id.internal.local."]}`),
+				),
+			}
+		})
+
+		It("returns the hostnames the address is registered under", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+
+			url := fmt.Sprintf("http://127.0.0.1:%s?type=12&name=2.0.255.10.in-addr.arpa.", dnsAdapterPort)
+			resp, err := http.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(all)).To(MatchJSON(`{
+				"Status": 0,
+				"TC": false,
+				"RD": false,
+				"RA": false,
+				"AD": false,
+				"CD": false,
+				"Question":
+				[
+					{
+						"name": "2.0.255.10.in-addr.arpa.",
+						"type": 12
+					}
+				],
+				"Answer":
+				[
+					{
+						"name": "2.0.255.10.in-addr.arpa.",
+						"type": 12,
+						"TTL": 0,
+						"data": "app-id.internal.local."
+					}
+				],
+				"Additional": [],
+				"edns_client_subnet": "0.0.0.0/0"
+			}`))
+		})
+	})
+
+	Context("when the service discovery controller does not know the name", func() {
+		BeforeEach(func() {
+			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/registration/app-id.internal.local."),
+					ghttp.RespondWith(200, `{"env": "", "hosts": [], "service": "", "not_found": true}`),
+				),
+			}
+		})
+
+		It("returns a name error with the SOA of the domain", func() {
+			Eventually(session).Should(gbytes.Say("bosh-dns-adapter.server-started"))
+
+			url := fmt.Sprintf("http://127.0.0.1:%s?type=1&name=app-id.internal.local.", dnsAdapterPort)
+			resp, err := http.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			all, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(all)).To(MatchJSON(`{
+				"Status": 3,
+				"TC": false,
+				"RD": false,
+				"RA": false,
+				"AD": false,
+				"CD": false,
+				"Question":
+				[
+					{
+						"name": "app-id.internal.local.",
+						"type": 1
+					}
+				],
+				"Answer": [],
+				"Authority":
+				[
+					{
+						"name": "internal.local.",
+						"type": 6,
+						"TTL": 0,
+						"data": "internal.local. hostmaster.internal.local. 1 3600 600 86400 0"
+					}
+				],
+				"Additional": [],
+				"edns_client_subnet": "0.0.0.0/0"
+			}`))
+		})
+	})
+
 	Context("when the service discovery controller returns non-successful", func() {
 		BeforeEach(func() {
 			fakeServiceDiscoveryControllerResponse = []http.HandlerFunc{
@@ -0,0 +1,313 @@
+package replica
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	replicaHits      = "DNSReplicaHits"
+	replicaFallbacks = "DNSReplicaFallbacks"
+
+	watchWait          = 5 * time.Second
+	syncRetryInterval  = 5 * time.Second
+	eventTypeAdded     = "added"
+	eventTypeRefreshed = "refreshed"
+)
+
+//go:generate counterfeiter -o fakes/resolver.go --fake-name Resolver . Resolver
+type Resolver interface {
+	Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error)
+}
+
+//go:generate counterfeiter -o fakes/sync_client.go --fake-name SyncClient . SyncClient
+type SyncClient interface {
+	CurrentRevision(ctx context.Context) (uint64, error)
+	Routes(ctx context.Context) (map[string][]sdcclient.Host, error)
+	WatchEvents(ctx context.Context, since uint64, wait time.Duration) (uint64, []sdcclient.Event, error)
+}
+
+//go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
+type MetricsSender interface {
+	IncrementCounter(string)
+}
+
+// Replica keeps a copy of the service discovery controller's whole address
+// table, loaded from /routes and kept current by watching for changes, and
+// answers lookups from it. Until the copy is loaded, or once it has gone
+// longer than maxStaleness without hearing from the controller, lookups go to
+// the fallback instead.
+//
+// Each host keeps when the controller would drop it unless it is registered
+// again. The controller publishes no change when a host is only registered
+// again, so once that time passes for a host of a name, the name is looked up
+// on the fallback, and the times it answers with are kept.
+type Replica struct {
+	client        SyncClient
+	fallback      Resolver
+	maxStaleness  time.Duration
+	clock         clock.Clock
+	metricsSender MetricsSender
+	logger        lager.Logger
+
+	mutex    sync.RWMutex
+	table    map[string][]sdcclient.Host
+	loaded   bool
+	syncedAt time.Time
+}
+
+func New(client SyncClient, fallback Resolver, maxStaleness time.Duration, clock clock.Clock, metricsSender MetricsSender, logger lager.Logger) *Replica {
+	return &Replica{
+		client:        client,
+		fallback:      fallback,
+		maxStaleness:  maxStaleness,
+		clock:         clock,
+		metricsSender: metricsSender,
+		logger:        logger,
+		table:         map[string][]sdcclient.Host{},
+		syncedAt:      clock.Now(),
+	}
+}
+
+func (r *Replica) Hosts(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error) {
+	now := r.clock.Now()
+
+	r.mutex.RLock()
+	fresh := r.loaded && now.Sub(r.syncedAt) <= r.maxStaleness
+	var (
+		hosts []sdcclient.Host
+		known bool
+	)
+	if fresh {
+		hosts, known = r.table[fqdn(infrastructureName)]
+		hosts = shuffled(hosts)
+	}
+	r.mutex.RUnlock()
+
+	if !fresh {
+		r.metricsSender.IncrementCounter(replicaFallbacks)
+		return r.fallback.Hosts(ctx, infrastructureName)
+	}
+
+	if anyStale(hosts, now) {
+		r.metricsSender.IncrementCounter(replicaFallbacks)
+		refreshed, err := r.refresh(ctx, infrastructureName)
+		if err == nil {
+			return refreshed, nil
+		}
+		r.logger.Error("refresh-failed", err, lager.Data{"service-name": infrastructureName})
+		return hosts, nil
+	}
+
+	r.metricsSender.IncrementCounter(replicaHits)
+	if !known {
+		return nil, sdcclient.ErrUnknownHostname
+	}
+	return hosts, nil
+}
+
+// refresh looks the name up on the fallback and keeps when the controller now
+// says each of its hosts would go stale. Hosts are only ever added to or
+// removed from the copy by the watch, so that an answer that raced with a
+// change cannot undo it.
+func (r *Replica) refresh(ctx context.Context, infrastructureName string) ([]sdcclient.Host, error) {
+	hosts, err := r.fallback.Hosts(ctx, infrastructureName)
+	if err != nil {
+		return nil, err
+	}
+
+	staleAt := make(map[string]time.Time, len(hosts))
+	for _, host := range hosts {
+		staleAt[host.IP] = host.StaleAt
+	}
+
+	hostname := fqdn(infrastructureName)
+	r.mutex.Lock()
+	if current, ok := r.table[hostname]; ok {
+		updated := make([]sdcclient.Host, len(current))
+		for i, host := range current {
+			if newStaleAt, ok := staleAt[host.IP]; ok {
+				host.StaleAt = newStaleAt
+			}
+			updated[i] = host
+		}
+		r.table[hostname] = updated
+	}
+	r.mutex.Unlock()
+
+	return hosts, nil
+}
+
+// GetAgeSeconds reports how long it has been since the replica last heard
+// from the controller, or since it started if it has not been loaded yet.
+func (r *Replica) GetAgeSeconds() (float64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.clock.Since(r.syncedAt).Seconds(), nil
+}
+
+func (r *Replica) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.sync(ctx)
+		close(stopped)
+	}()
+
+	close(ready)
+
+	<-signals
+	cancel()
+	<-stopped
+	return nil
+}
+
+func (r *Replica) sync(ctx context.Context) {
+	var revision uint64
+	loaded := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !loaded {
+			var err error
+			revision, err = r.load(ctx)
+			if err != nil {
+				r.logger.Error("load-failed", err)
+				if !r.wait(ctx) {
+					return
+				}
+				continue
+			}
+
+			loaded = true
+			continue
+		}
+
+		newRevision, events, err := r.client.WatchEvents(ctx, revision, watchWait)
+		if err == sdcclient.ErrRevisionUnavailable {
+			r.logger.Info("watch-revision-unavailable", lager.Data{"revision": revision})
+			loaded = false
+			continue
+		}
+		if err != nil {
+			r.logger.Error("watch-failed", err)
+			loaded = false
+			if !r.wait(ctx) {
+				return
+			}
+			continue
+		}
+
+		r.apply(events)
+		revision = newRevision
+	}
+}
+
+// load takes the revision before the routes, so that watching from it replays
+// any change the routes may have missed. Replaying a change the routes
+// already include leaves the table as it was.
+func (r *Replica) load(ctx context.Context) (uint64, error) {
+	revision, err := r.client.CurrentRevision(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	routes, err := r.client.Routes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	table := make(map[string][]sdcclient.Host, len(routes))
+	for hostname, hosts := range routes {
+		table[fqdn(hostname)] = hosts
+	}
+
+	r.mutex.Lock()
+	r.table = table
+	r.loaded = true
+	r.syncedAt = r.clock.Now()
+	r.mutex.Unlock()
+
+	r.logger.Info("loaded", lager.Data{"revision": revision, "hostnames": len(table)})
+	return revision, nil
+}
+
+func (r *Replica) apply(events []sdcclient.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, event := range events {
+		hostname := fqdn(event.Hostname)
+		hosts := withoutIP(r.table[hostname], event.Host.IP)
+		if event.Type == eventTypeAdded || event.Type == eventTypeRefreshed {
+			hosts = append(hosts, event.Host)
+		}
+
+		if len(hosts) == 0 {
+			delete(r.table, hostname)
+		} else {
+			r.table[hostname] = hosts
+		}
+	}
+	r.syncedAt = r.clock.Now()
+}
+
+func (r *Replica) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-r.clock.After(syncRetryInterval):
+		return true
+	}
+}
+
+// withoutIP returns a copy of the hosts without the one with the IP, so that
+// slices handed out by Hosts are never changed underneath their callers.
+func withoutIP(hosts []sdcclient.Host, ip string) []sdcclient.Host {
+	result := make([]sdcclient.Host, 0, len(hosts)+1)
+	for _, host := range hosts {
+		if host.IP != ip {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+func anyStale(hosts []sdcclient.Host, now time.Time) bool {
+	for _, host := range hosts {
+		if !host.StaleAt.IsZero() && !host.StaleAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func fqdn(name string) string {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+func shuffled(hosts []sdcclient.Host) []sdcclient.Host {
+	result := make([]sdcclient.Host, len(hosts))
+	for i, j := range rand.Perm(len(hosts)) {
+		result[i] = hosts[j]
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package replica_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	. "bosh-dns-adapter/replica"
+	"bosh-dns-adapter/replica/fakes"
+	"bosh-dns-adapter/sdcclient"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Replica", func() {
+	var (
+		client        *fakes.SyncClient
+		fallback      *fakes.Resolver
+		metricsSender *fakes.MetricsSender
+		fakeClock     *fakeclock.FakeClock
+		replica       *Replica
+		process       ifrit.Process
+		changes       chan []sdcclient.Event
+		watchErr      error
+		ctx           context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		metricsSender = &fakes.MetricsSender{}
+
+		fallback = &fakes.Resolver{}
+		fallback.HostsReturns([]sdcclient.Host{{IP: "10.0.0.1"}}, nil)
+
+		changes = make(chan []sdcclient.Event)
+		watchErr = nil
+		client = &fakes.SyncClient{}
+		client.CurrentRevisionReturns(7, nil)
+		client.RoutesReturns(map[string][]sdcclient.Host{
+			"app-id.apps.internal.": {{IP: "192.168.0.1", Port: 8080}},
+			"other.apps.internal.":  {{IP: "192.168.0.2"}},
+		}, nil)
+		client.WatchEventsStub = func(ctx context.Context, since uint64, wait time.Duration) (uint64, []sdcclient.Event, error) {
+			if watchErr != nil {
+				time.Sleep(10 * time.Millisecond)
+				return 0, nil, watchErr
+			}
+
+			select {
+			case events := <-changes:
+				return since + uint64(len(events)), events, nil
+			case <-time.After(10 * time.Millisecond):
+				return since, []sdcclient.Event{}, nil
+			}
+		}
+
+		replica = New(client, fallback, 30*time.Second, fakeClock, metricsSender, lagertest.NewTestLogger("test"))
+	})
+
+	AfterEach(func() {
+		if process != nil {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			process = nil
+		}
+	})
+
+	start := func() {
+		process = ifrit.Invoke(replica)
+		Eventually(client.WatchEventsCallCount).Should(BeNumerically(">", 0))
+	}
+
+	counters := func() []string {
+		names := []string{}
+		for i := 0; i < metricsSender.IncrementCounterCallCount(); i++ {
+			names = append(names, metricsSender.IncrementCounterArgsForCall(i))
+		}
+		return names
+	}
+
+	lastWatchedRevision := func() uint64 {
+		_, since, _ := client.WatchEventsArgsForCall(client.WatchEventsCallCount() - 1)
+		return since
+	}
+
+	It("falls back until it has loaded the routes", func() {
+		Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(Equal([]sdcclient.Host{{IP: "10.0.0.1"}}))
+		Expect(fallback.HostsCallCount()).To(Equal(1))
+		Expect(counters()).To(Equal([]string{"DNSReplicaFallbacks"}))
+	})
+
+	Context("once it has loaded the routes", func() {
+		JustBeforeEach(func() {
+			start()
+		})
+
+		It("answers from the routes", func() {
+			Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(Equal([]sdcclient.Host{{IP: "192.168.0.1", Port: 8080}}))
+			Expect(replica.Hosts(ctx, "other.apps.internal")).To(Equal([]sdcclient.Host{{IP: "192.168.0.2"}}))
+			_, err := replica.Hosts(ctx, "missing.apps.internal.")
+			Expect(err).To(Equal(sdcclient.ErrUnknownHostname))
+
+			Expect(fallback.HostsCallCount()).To(Equal(0))
+			Expect(counters()).To(Equal([]string{"DNSReplicaHits", "DNSReplicaHits", "DNSReplicaHits"}))
+		})
+
+		It("watches from the revision taken before the routes", func() {
+			_, since, wait := client.WatchEventsArgsForCall(0)
+			Expect(since).To(Equal(uint64(7)))
+			Expect(wait).To(Equal(5 * time.Second))
+		})
+
+		It("applies the changes it is told about", func() {
+			changes <- []sdcclient.Event{
+				{Type: "added", Hostname: "app-id.apps.internal.", Host: sdcclient.Host{IP: "192.168.0.3", Port: 8080}},
+				{Type: "refreshed", Hostname: "app-id.apps.internal.", Host: sdcclient.Host{IP: "192.168.0.1", Port: 9090}},
+				{Type: "removed", Hostname: "other.apps.internal.", Host: sdcclient.Host{IP: "192.168.0.2"}},
+				{Type: "added", Hostname: "new.apps.internal.", Host: sdcclient.Host{IP: "192.168.0.4"}},
+				{Type: "pruned", Hostname: "new.apps.internal.", Host: sdcclient.Host{IP: "192.168.0.4"}},
+			}
+			Eventually(lastWatchedRevision).Should(Equal(uint64(12)))
+
+			Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(
+				sdcclient.Host{IP: "192.168.0.1", Port: 9090},
+				sdcclient.Host{IP: "192.168.0.3", Port: 8080},
+			))
+			_, err := replica.Hosts(ctx, "other.apps.internal.")
+			Expect(err).To(Equal(sdcclient.ErrUnknownHostname))
+			_, err = replica.Hosts(ctx, "new.apps.internal.")
+			Expect(err).To(Equal(sdcclient.ErrUnknownHostname))
+		})
+
+		It("reports how long ago it heard from the controller", func() {
+			Expect(replica.GetAgeSeconds()).To(BeNumerically("<", 1))
+		})
+
+		Context("when the time a host had left when it was copied has passed", func() {
+			BeforeEach(func() {
+				client.RoutesReturns(map[string][]sdcclient.Host{
+					"app-id.apps.internal.": {
+						{IP: "192.168.0.1", Port: 8080, StaleAt: fakeClock.Now().Add(10 * time.Second)},
+						{IP: "192.168.0.2", Port: 8080, StaleAt: fakeClock.Now().Add(20 * time.Second)},
+					},
+				}, nil)
+				fallback.HostsReturns([]sdcclient.Host{
+					{IP: "192.168.0.1", Port: 8080, StaleAt: fakeClock.Now().Add(40 * time.Second)},
+					{IP: "192.168.0.2", Port: 8080, StaleAt: fakeClock.Now().Add(40 * time.Second)},
+				}, nil)
+			})
+
+			It("answers from the copy until then", func() {
+				fakeClock.Increment(9 * time.Second)
+				Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(HaveLen(2))
+				Expect(fallback.HostsCallCount()).To(Equal(0))
+			})
+
+			It("looks the name up on the fallback and keeps the new times", func() {
+				fakeClock.Increment(10 * time.Second)
+				Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(ConsistOf(
+					sdcclient.Host{IP: "192.168.0.1", Port: 8080, StaleAt: fakeClock.Now().Add(30 * time.Second)},
+					sdcclient.Host{IP: "192.168.0.2", Port: 8080, StaleAt: fakeClock.Now().Add(30 * time.Second)},
+				))
+				Expect(fallback.HostsCallCount()).To(Equal(1))
+				Expect(counters()).To(Equal([]string{"DNSReplicaFallbacks"}))
+
+				Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(HaveLen(2))
+				Expect(fallback.HostsCallCount()).To(Equal(1))
+			})
+
+			Context("when the fallback fails", func() {
+				BeforeEach(func() {
+					fallback.HostsReturns(nil, errors.New("potato"))
+				})
+
+				It("answers from the copy", func() {
+					fakeClock.Increment(10 * time.Second)
+					Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(HaveLen(2))
+				})
+			})
+		})
+
+		Context("when the revision is no longer available", func() {
+			BeforeEach(func() {
+				client.RoutesReturnsOnCall(0, map[string][]sdcclient.Host{
+					"app-id.apps.internal.": {{IP: "192.168.0.1", Port: 8080}},
+				}, nil)
+				client.RoutesReturns(map[string][]sdcclient.Host{
+					"app-id.apps.internal.": {{IP: "192.168.0.5"}},
+				}, nil)
+				watchErr = sdcclient.ErrRevisionUnavailable
+			})
+
+			It("loads the routes again", func() {
+				Eventually(client.RoutesCallCount).Should(BeNumerically(">", 1))
+				Eventually(func() []sdcclient.Host {
+					hosts, _ := replica.Hosts(ctx, "app-id.apps.internal.")
+					return hosts
+				}).Should(Equal([]sdcclient.Host{{IP: "192.168.0.5"}}))
+			})
+		})
+
+		Context("when it stops hearing from the controller", func() {
+			BeforeEach(func() {
+				client.CurrentRevisionReturnsOnCall(0, 7, nil)
+				client.CurrentRevisionReturns(0, errors.New("potato"))
+				watchErr = errors.New("potato")
+			})
+
+			It("keeps answering until it is too stale, then falls back", func() {
+				fakeClock.Increment(30 * time.Second)
+				Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(Equal([]sdcclient.Host{{IP: "192.168.0.1", Port: 8080}}))
+
+				fakeClock.Increment(time.Second)
+				Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(Equal([]sdcclient.Host{{IP: "10.0.0.1"}}))
+				Expect(replica.GetAgeSeconds()).To(BeNumerically(">=", 31))
+			})
+		})
+	})
+
+	Context("when the routes cannot be loaded", func() {
+		BeforeEach(func() {
+			client.RoutesReturns(nil, errors.New("address table is not warm"))
+			process = ifrit.Invoke(replica)
+		})
+
+		It("retries after a while and falls back meanwhile", func() {
+			Eventually(client.RoutesCallCount).Should(Equal(1))
+			Expect(replica.Hosts(ctx, "app-id.apps.internal.")).To(Equal([]sdcclient.Host{{IP: "10.0.0.1"}}))
+
+			fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+			Eventually(client.RoutesCallCount).Should(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,47 @@
+package sdcclient
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+//go:generate counterfeiter -o fakes/health_checkable.go --fake-name HealthCheckable . HealthCheckable
+type HealthCheckable interface {
+	CheckHealth(ctx context.Context)
+}
+
+// HealthChecker periodically checks the health of every service discovery
+// controller so that lookups go to warm, responsive ones first.
+type HealthChecker struct {
+	client   HealthCheckable
+	interval time.Duration
+	clock    clock.Clock
+}
+
+func NewHealthChecker(client HealthCheckable, interval time.Duration, clock clock.Clock) *HealthChecker {
+	return &HealthChecker{
+		client:   client,
+		interval: interval,
+		clock:    clock,
+	}
+}
+
+func (h *HealthChecker) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	h.client.CheckHealth(context.Background())
+	close(ready)
+
+	ticker := h.clock.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C():
+			h.client.CheckHealth(context.Background())
+		}
+	}
+}
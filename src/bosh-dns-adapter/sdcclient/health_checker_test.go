@@ -0,0 +1,45 @@
+package sdcclient_test
+
+import (
+	"os"
+	"time"
+
+	. "bosh-dns-adapter/sdcclient"
+	"bosh-dns-adapter/sdcclient/fakes"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("HealthChecker", func() {
+	var (
+		client    *fakes.HealthCheckable
+		fakeClock *fakeclock.FakeClock
+		process   ifrit.Process
+	)
+
+	BeforeEach(func() {
+		client = &fakes.HealthCheckable{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		process = ifrit.Invoke(NewHealthChecker(client, 5*time.Second, fakeClock))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("checks the health of the backends before it is ready", func() {
+		Expect(client.CheckHealthCallCount()).To(Equal(1))
+	})
+
+	It("checks the health of the backends on every interval", func() {
+		fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+		Eventually(client.CheckHealthCallCount).Should(Equal(2))
+
+		fakeClock.WaitForWatcherAndIncrement(5 * time.Second)
+		Eventually(client.CheckHealthCallCount).Should(Equal(3))
+	})
+})
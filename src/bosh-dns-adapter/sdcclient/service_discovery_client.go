@@ -1,6 +1,7 @@
 package sdcclient
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -11,23 +12,155 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+const (
+	requestRetries           = "SDCRequestRetries"
+	circuitBreakerOpened     = "SDCCircuitBreakerOpened"
+	circuitBreakerRejections = "SDCCircuitBreakerRejections"
+
+	// watchTimeout is how much longer than the requested wait a watch may
+	// take before it is abandoned.
+	watchTimeout = 5 * time.Second
 )
 
+//go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
+type MetricsSender interface {
+	IncrementCounter(string)
+}
+
+// RetryPolicy bounds how long a query may take and how it is retried.
+// Retries back off exponentially with jitter, from InitialBackoff up to
+// MaxBackoff. After BreakerThreshold queries in a row have failed, queries
+// fail fast with ErrCircuitOpen for BreakerCooldown. The breaker is disabled
+// when BreakerThreshold is 0.
+type RetryPolicy struct {
+	QueryTimeout     time.Duration
+	MaxAttempts      int
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	QueryTimeout:     2 * time.Second,
+	MaxAttempts:      4,
+	InitialBackoff:   20 * time.Millisecond,
+	MaxBackoff:       500 * time.Millisecond,
+	BreakerThreshold: 5,
+	BreakerCooldown:  10 * time.Second,
+}
+
 type ServiceDiscoveryClient struct {
-	serverURL string
-	client    *http.Client
+	client        *http.Client
+	retryPolicy   RetryPolicy
+	breaker       *breaker
+	clock         clock.Clock
+	metricsSender MetricsSender
+
+	mutex    sync.Mutex
+	backends []*backend
+	watchURL string
+}
+
+// backend is one service discovery controller. Backends start out healthy
+// and are marked unhealthy when a request to them fails, until a health
+// check or a later request succeeds.
+type backend struct {
+	url     string
+	healthy bool
+	latency time.Duration
 }
 
 type serverResponse struct {
-	Hosts []host `json:"Hosts"`
+	Hosts    []host `json:"Hosts"`
+	NotFound bool   `json:"not_found"`
 }
 
+// host has MaxAge, the seconds it has left before the controller would drop
+// it unless it is registered again, in /routes and watch responses.
 type host struct {
 	IPAddress string `json:"ip_address"`
+	Port      uint16 `json:"port"`
+	MaxAge    *int   `json:"max_age"`
+}
+
+// Host is an instance registered for a hostname. StaleAt is when the
+// controller would drop it unless it is registered again, or zero when the
+// controller did not say.
+type Host struct {
+	IP      string
+	Port    uint16
+	StaleAt time.Time
+}
+
+var ErrRevisionUnavailable = errors.New("revision unavailable")
+
+// ErrUnknownHostname is returned by Hosts when the controller has no
+// addresses at all for the hostname.
+var ErrUnknownHostname = errors.New("unknown hostname")
+
+type watchResponse struct {
+	Revision uint64       `json:"revision"`
+	Events   []watchEvent `json:"events"`
+}
+
+type watchEvent struct {
+	Type     string `json:"type"`
+	Hostname string `json:"hostname"`
+	Host     host   `json:"host"`
+}
+
+// Event is a change to the controller's address table. Added and refreshed
+// events carry the host as it now is, removed and pruned events the host that
+// went away.
+type Event struct {
+	Type     string
+	Hostname string
+	Host     Host
+}
+
+type reverseResponse struct {
+	Hostnames []string `json:"hostnames"`
+	NotFound  bool     `json:"not_found"`
+}
+
+type routesResponse struct {
+	Addresses []routesAddress `json:"addresses"`
+}
+
+type routesAddress struct {
+	Hostname string `json:"hostname"`
+	Hosts    []host `json:"hosts"`
 }
 
 func NewServiceDiscoveryClient(serverURL, caPath, clientCertPath, clientKeyPath string) (*ServiceDiscoveryClient, error) {
+	return NewServiceDiscoveryClientWithBackends([]string{serverURL}, "", caPath, clientCertPath, clientKeyPath,
+		DefaultRetryPolicy, clock.NewClock(), nopMetricsSender{})
+}
+
+// NewServiceDiscoveryClientWithBackends returns a client that spreads
+// requests across several controllers. Their certificates are verified
+// against serverName when it is set, since the backends are addressed by IP.
+func NewServiceDiscoveryClientWithBackends(
+	serverURLs []string,
+	serverName, caPath, clientCertPath, clientKeyPath string,
+	retryPolicy RetryPolicy,
+	clock clock.Clock,
+	metricsSender MetricsSender,
+) (*ServiceDiscoveryClient, error) {
+	if len(serverURLs) == 0 {
+		return nil, errors.New("no service discovery controller urls")
+	}
+
 	caPemBytes, err := ioutil.ReadFile(caPath)
 	if err != nil {
 		return nil, fmt.Errorf("read CA file: %s", err)
@@ -47,6 +180,7 @@ func NewServiceDiscoveryClient(serverURL, caPath, clientCertPath, clientKeyPath
 		ClientCAs:    caCertPool,
 		RootCAs:      caCertPool,
 		Certificates: []tls.Certificate{cert},
+		ServerName:   serverName,
 	}
 
 	tlsConfig.BuildNameToCertificate()
@@ -65,67 +199,504 @@ func NewServiceDiscoveryClient(serverURL, caPath, clientCertPath, clientKeyPath
 
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   time.Second * 10,
+	}
+
+	backends := make([]*backend, len(serverURLs))
+	for i, serverURL := range serverURLs {
+		backends[i] = &backend{url: serverURL, healthy: true}
 	}
 
 	return &ServiceDiscoveryClient{
-		serverURL: serverURL,
-		client:    client,
+		client:        client,
+		retryPolicy:   retryPolicy,
+		breaker:       newBreaker(retryPolicy.BreakerThreshold, retryPolicy.BreakerCooldown, clock),
+		clock:         clock,
+		metricsSender: metricsSender,
+		backends:      backends,
 	}, nil
 }
 
-func (s *ServiceDiscoveryClient) IPs(infrastructureName string) ([]string, error) {
-	requestUrl := fmt.Sprintf("%s/v1/registration/%s", s.serverURL, infrastructureName)
+func (s *ServiceDiscoveryClient) IPs(ctx context.Context, infrastructureName string) ([]string, error) {
+	hosts, err := s.Hosts(ctx, infrastructureName)
+	if err != nil {
+		return []string{}, err
+	}
 
-	var (
-		err      error
-		httpResp *http.Response
-	)
+	ips := make([]string, len(hosts), len(hosts))
+	for i, host := range hosts {
+		ips[i] = host.IP
+	}
 
-	for i := 0; i < 4; i++ {
-		httpResp, err = s.client.Get(requestUrl)
-		if err != nil {
-			return []string{}, err
+	return ips, nil
+}
+
+// Hosts asks the healthiest backends first. When a backend fails the next
+// one is tried, and once every backend has been tried the query backs off
+// before going around again, until the attempts or the query timeout run out.
+func (s *ServiceDiscoveryClient) Hosts(ctx context.Context, infrastructureName string) ([]Host, error) {
+	if !s.breaker.allow() {
+		s.metricsSender.IncrementCounter(circuitBreakerRejections)
+		return []Host{}, ErrCircuitOpen
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, s.retryPolicy.QueryTimeout)
+	defer cancel()
+
+	hosts, err := s.queryHosts(queryCtx, infrastructureName)
+	if err != nil && err != ErrUnknownHostname {
+		// the caller giving up says nothing about the controllers
+		if ctx.Err() == context.Canceled {
+			s.breaker.abandoned()
+		} else if s.breaker.failed() {
+			s.metricsSender.IncrementCounter(circuitBreakerOpened)
 		}
+		return []Host{}, err
+	}
 
-		if httpResp.StatusCode == http.StatusOK {
-			break
-		} else {
-			defer func(httpResp *http.Response) {
-				io.Copy(ioutil.Discard, httpResp.Body)
-				httpResp.Body.Close()
-			}(httpResp)
+	s.breaker.succeeded()
+	if err != nil {
+		return []Host{}, err
+	}
+	shuffle(hosts)
+	return hosts, nil
+}
+
+func (s *ServiceDiscoveryClient) queryHosts(ctx context.Context, infrastructureName string) ([]Host, error) {
+	serverURLs := s.orderedBackends()
+
+	attempts := s.retryPolicy.MaxAttempts
+	if len(serverURLs) > attempts {
+		attempts = len(serverURLs)
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			s.metricsSender.IncrementCounter(requestRetries)
+		}
+		if i >= len(serverURLs) {
+			if !s.backoff(ctx, i/len(serverURLs)-1) {
+				return nil, err
+			}
+		}
+
+		serverURL := serverURLs[i%len(serverURLs)]
+
+		var (
+			hosts     []Host
+			retryable bool
+		)
+		hosts, retryable, err = s.getHosts(ctx, serverURL, infrastructureName)
+		if err == nil || err == ErrUnknownHostname {
+			s.setHealthy(serverURL, true)
+			return hosts, err
 		}
+		if !retryable {
+			return nil, err
+		}
+
+		s.setHealthy(serverURL, false)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// backoff waits for a random duration between half and all of the
+// exponential backoff for the retry, and returns false if the query ran out
+// of time first.
+func (s *ServiceDiscoveryClient) backoff(ctx context.Context, retry int) bool {
+	delay := s.retryPolicy.InitialBackoff
+	for i := 0; i < retry && delay < s.retryPolicy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.retryPolicy.MaxBackoff {
+		delay = s.retryPolicy.MaxBackoff
+	}
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
 	}
 
+	select {
+	case <-ctx.Done():
+		return false
+	case <-s.clock.After(delay):
+		return true
+	}
+}
+
+// getHosts returns whether the error is worth retrying, which it is unless
+// the controller answered with something that could not be parsed.
+func (s *ServiceDiscoveryClient) getHosts(ctx context.Context, serverURL, infrastructureName string) ([]Host, bool, error) {
+	requestUrl := fmt.Sprintf("%s/v1/registration/%s", serverURL, infrastructureName)
+	httpResp, err := s.get(ctx, requestUrl)
+	if err != nil {
+		return nil, true, err
+	}
+	defer httpResp.Body.Close()
+
 	if httpResp.StatusCode != http.StatusOK {
-		return []string{}, errors.New(fmt.Sprintf("Received non successful response from server: %+v", httpResp))
+		io.Copy(ioutil.Discard, httpResp.Body)
+		return nil, true, errors.New(fmt.Sprintf("Received non successful response from server: %+v", httpResp))
 	}
 
 	bytes, err := ioutil.ReadAll(httpResp.Body)
-	httpResp.Body.Close()
 	if err != nil {
-		return []string{}, err
+		return nil, true, err
 	}
 
 	var serverResponse *serverResponse
 	err = json.Unmarshal(bytes, &serverResponse)
 	if err != nil {
-		return []string{}, err
+		return nil, false, err
+	}
+	if serverResponse.NotFound {
+		return nil, false, ErrUnknownHostname
+	}
+
+	var staleAt time.Time
+	if maxAge, ok := parseMaxAge(httpResp.Header.Get("Cache-Control")); ok {
+		staleAt = s.clock.Now().Add(maxAge)
 	}
 
 	numHosts := len(serverResponse.Hosts)
-	ips := make([]string, numHosts, numHosts)
+	hosts := make([]Host, numHosts, numHosts)
 	for i, host := range serverResponse.Hosts {
-		ips[i] = host.IPAddress
+		hosts[i] = Host{IP: host.IPAddress, Port: host.Port, StaleAt: staleAt}
 	}
 
-	shuffle(ips)
+	return hosts, false, nil
+}
+
+// Hostnames returns the hostnames the IP is registered under, asking each
+// backend once, healthiest first. It returns ErrUnknownHostname when the IP is
+// not registered under any hostname.
+func (s *ServiceDiscoveryClient) Hostnames(ctx context.Context, ip string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.retryPolicy.QueryTimeout)
+	defer cancel()
 
-	return ips, nil
+	var err error
+	for _, serverURL := range s.orderedBackends() {
+		var hostnames []string
+		hostnames, err = s.getHostnames(ctx, serverURL, ip)
+		if err == nil || err == ErrUnknownHostname {
+			s.setHealthy(serverURL, true)
+			return hostnames, err
+		}
+
+		s.setHealthy(serverURL, false)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+func (s *ServiceDiscoveryClient) getHostnames(ctx context.Context, serverURL, ip string) ([]string, error) {
+	httpResp, err := s.get(ctx, fmt.Sprintf("%s/v1/reverse/%s", serverURL, ip))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		return nil, fmt.Errorf("received non successful response from server: %d", httpResp.StatusCode)
+	}
+
+	var response reverseResponse
+	err = json.NewDecoder(httpResp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal reverse response: %s", err)
+	}
+	if response.NotFound {
+		return nil, ErrUnknownHostname
+	}
+
+	return response.Hostnames, nil
+}
+
+func parseMaxAge(cacheControl string) (time.Duration, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// CurrentRevision returns the revision of the controller's address table, to
+// start watching from. Revisions are only meaningful to the controller that
+// issued them, so it picks the healthiest backend and later calls to Watch
+// stay on it.
+func (s *ServiceDiscoveryClient) CurrentRevision(ctx context.Context) (uint64, error) {
+	serverURL := s.orderedBackends()[0]
+	s.mutex.Lock()
+	s.watchURL = serverURL
+	s.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.retryPolicy.QueryTimeout)
+	defer cancel()
+
+	response, err := s.getWatch(ctx, serverURL, fmt.Sprintf("%s/v1/watch", serverURL))
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Revision, nil
+}
+
+// Watch waits for changes after the given revision and returns the new
+// revision along with the hostnames that changed.
+func (s *ServiceDiscoveryClient) Watch(ctx context.Context, since uint64, wait time.Duration) (uint64, []string, error) {
+	revision, events, err := s.WatchEvents(ctx, since, wait)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	hostnames := make([]string, len(events))
+	for i, event := range events {
+		hostnames[i] = event.Hostname
+	}
+
+	return revision, hostnames, nil
+}
+
+// WatchEvents is Watch with the full events.
+func (s *ServiceDiscoveryClient) WatchEvents(ctx context.Context, since uint64, wait time.Duration) (uint64, []Event, error) {
+	serverURL := s.currentWatchURL()
+
+	ctx, cancel := context.WithTimeout(ctx, wait+watchTimeout)
+	defer cancel()
+
+	requestUrl := fmt.Sprintf("%s/v1/watch?since=%d&wait=%d", serverURL, since, int(wait.Seconds()))
+	response, err := s.getWatch(ctx, serverURL, requestUrl)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	events := make([]Event, len(response.Events))
+	for i, event := range response.Events {
+		events[i] = Event{
+			Type:     event.Type,
+			Hostname: event.Hostname,
+			Host:     s.toHost(event.Host),
+		}
+	}
+
+	return response.Revision, events, nil
+}
+
+// Routes returns every host in the address table of the controller picked by
+// CurrentRevision, by hostname. It fails if that controller's address table is
+// not warm, since it would be missing hosts.
+func (s *ServiceDiscoveryClient) Routes(ctx context.Context) (map[string][]Host, error) {
+	serverURL := s.currentWatchURL()
+
+	ctx, cancel := context.WithTimeout(ctx, s.retryPolicy.QueryTimeout)
+	defer cancel()
+
+	warm, _ := s.checkHealth(ctx, serverURL)
+	if !warm {
+		return nil, errors.New("address table is not warm")
+	}
+
+	httpResp, err := s.get(ctx, fmt.Sprintf("%s/routes", serverURL))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non successful response from server: %d", httpResp.StatusCode)
+	}
+
+	var response routesResponse
+	err = json.NewDecoder(httpResp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal routes response: %s", err)
+	}
+
+	routes := map[string][]Host{}
+	for _, address := range response.Addresses {
+		hosts := make([]Host, len(address.Hosts))
+		for i, host := range address.Hosts {
+			hosts[i] = s.toHost(host)
+		}
+		routes[address.Hostname] = hosts
+	}
+
+	return routes, nil
+}
+
+func (s *ServiceDiscoveryClient) toHost(h host) Host {
+	result := Host{IP: h.IPAddress, Port: h.Port}
+	if h.MaxAge != nil {
+		result.StaleAt = s.clock.Now().Add(time.Duration(*h.MaxAge) * time.Second)
+	}
+	return result
+}
+
+func (s *ServiceDiscoveryClient) currentWatchURL() string {
+	s.mutex.Lock()
+	serverURL := s.watchURL
+	s.mutex.Unlock()
+
+	if serverURL == "" {
+		serverURL = s.orderedBackends()[0]
+	}
+	return serverURL
 }
 
-func shuffle(vals []string) {
+func (s *ServiceDiscoveryClient) getWatch(ctx context.Context, serverURL, requestUrl string) (*watchResponse, error) {
+	httpResp, err := s.get(ctx, requestUrl)
+	if err != nil {
+		s.setHealthy(serverURL, false)
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusGone {
+		return nil, ErrRevisionUnavailable
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		s.setHealthy(serverURL, false)
+		return nil, fmt.Errorf("received non successful response from server: %d", httpResp.StatusCode)
+	}
+
+	var response watchResponse
+	err = json.NewDecoder(httpResp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal watch response: %s", err)
+	}
+
+	return &response, nil
+}
+
+// CheckHealth asks every backend whether its address table is warm and
+// records how long it took to answer.
+func (s *ServiceDiscoveryClient) CheckHealth(ctx context.Context) {
+	s.mutex.Lock()
+	serverURLs := make([]string, len(s.backends))
+	for i, b := range s.backends {
+		serverURLs[i] = b.url
+	}
+	s.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, serverURL := range serverURLs {
+		wg.Add(1)
+		go func(serverURL string) {
+			defer wg.Done()
+			healthy, latency := s.checkHealth(ctx, serverURL)
+
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			for _, b := range s.backends {
+				if b.url == serverURL {
+					b.healthy = healthy
+					b.latency = latency
+				}
+			}
+		}(serverURL)
+	}
+	wg.Wait()
+}
+
+func (s *ServiceDiscoveryClient) checkHealth(ctx context.Context, serverURL string) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, s.retryPolicy.QueryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	httpResp, err := s.get(ctx, fmt.Sprintf("%s/v1/health", serverURL))
+	latency := time.Since(start)
+	if err != nil {
+		return false, latency
+	}
+	defer httpResp.Body.Close()
+	io.Copy(ioutil.Discard, httpResp.Body)
+
+	return httpResp.StatusCode == http.StatusOK, latency
+}
+
+func (s *ServiceDiscoveryClient) GetHealthyBackends() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	healthy := 0
+	for _, b := range s.backends {
+		if b.healthy {
+			healthy++
+		}
+	}
+	return float64(healthy), nil
+}
+
+// GetCircuitBreakerState reports 0 while the circuit breaker is closed, 1
+// while it is open and 2 while a query is testing whether to close it.
+func (s *ServiceDiscoveryClient) GetCircuitBreakerState() (float64, error) {
+	return float64(s.breaker.currentState()), nil
+}
+
+func (s *ServiceDiscoveryClient) get(ctx context.Context, requestUrl string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(req.WithContext(ctx))
+}
+
+// orderedBackends returns the backend urls with the healthy ones first,
+// fastest first.
+func (s *ServiceDiscoveryClient) orderedBackends() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backends := make([]backend, len(s.backends))
+	for i, b := range s.backends {
+		backends[i] = *b
+	}
+
+	sort.SliceStable(backends, func(i, j int) bool {
+		if backends[i].healthy != backends[j].healthy {
+			return backends[i].healthy
+		}
+		return backends[i].latency < backends[j].latency
+	})
+
+	serverURLs := make([]string, len(backends))
+	for i, b := range backends {
+		serverURLs[i] = b.url
+	}
+	return serverURLs
+}
+
+func (s *ServiceDiscoveryClient) setHealthy(serverURL string, healthy bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, b := range s.backends {
+		if b.url == serverURL {
+			b.healthy = healthy
+		}
+	}
+}
+
+type nopMetricsSender struct{}
+
+func (nopMetricsSender) IncrementCounter(string) {}
+
+func shuffle(vals []Host) {
 	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 	for len(vals) > 0 {
 		n := len(vals)
@@ -1,15 +1,20 @@
 package sdcclient_test
 
 import (
+	"context"
 	"net/http"
 
 	. "bosh-dns-adapter/sdcclient"
+	"bosh-dns-adapter/sdcclient/fakes"
 	"test-helpers"
 
 	"crypto/tls"
 	"io/ioutil"
 	"os"
+	"time"
 
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/clock/fakeclock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
@@ -25,9 +30,11 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 		clientCertFileName string
 		clientKeyFileName  string
 		serverCert         tls.Certificate
+		ctx                context.Context
 	)
 
 	BeforeEach(func() {
+		ctx = context.Background()
 		caFileName, clientCertFileName, clientKeyFileName, serverCert = testhelpers.GenerateCaAndMutualTlsCerts()
 	})
 
@@ -126,7 +133,7 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 			})
 
 			It("returns the ips in the server response", func() {
-				actualIPs, err := client.IPs("app-id.apps.internal.")
+				actualIPs, err := client.IPs(ctx, "app-id.apps.internal.")
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(actualIPs).To(ConsistOf("192.168.0.1", "192.168.0.2"))
@@ -134,6 +141,36 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 
 		})
 
+		Context("when the server responds with ports", func() {
+			BeforeEach(func() {
+				fakeServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+					ghttp.RespondWith(http.StatusOK, `{
+							"env": "",
+							"Hosts": [
+							{
+								"ip_address": "192.168.0.1",
+								"port": 8080
+							},
+							{
+								"ip_address": "192.168.0.2",
+								"port": 9090
+							}],
+							"service": ""
+						}`)))
+			})
+
+			It("returns the hosts with their ports", func() {
+				hosts, err := client.Hosts(ctx, "app-id.apps.internal.")
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(hosts).To(ConsistOf(
+					Host{IP: "192.168.0.1", Port: 8080},
+					Host{IP: "192.168.0.2", Port: 9090},
+				))
+			})
+		})
+
 		Context("returned ips order", func() {
 			BeforeEach(func() {
 				fakeServer.RouteToHandler("GET", "/v1/registration/app-id.apps.internal.", func(writer http.ResponseWriter, request *http.Request) {
@@ -175,7 +212,7 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 
 			It("shuffles them to return them in random order", func() {
 				Eventually(func() []string {
-					ips, err := client.IPs("app-id.apps.internal.")
+					ips, err := client.IPs(ctx, "app-id.apps.internal.")
 					Expect(err).ToNot(HaveOccurred())
 					return ips
 				}).Should(Equal([]string{"192.168.0.3", "192.168.0.1", "192.168.0.2"}))
@@ -191,7 +228,7 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := client.IPs("app-id.apps.internal.")
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -237,7 +274,7 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 			})
 
 			It("retries and returns the successful response", func() {
-				actualIPs, err := client.IPs("app-id.apps.internal.")
+				actualIPs, err := client.IPs(ctx, "app-id.apps.internal.")
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(actualIPs).To(ConsistOf("192.168.0.1", "192.168.0.2"))
@@ -263,11 +300,578 @@ var _ = Describe("ServiceDiscoveryClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := client.IPs("app-id.apps.internal.")
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("Received non successful response from server:"))
 			})
 		})
 	})
 
+	Describe("Watch", func() {
+		BeforeEach(func() {
+			fakeServer = ghttp.NewUnstartedServer()
+			fakeServer.HTTPTestServer.TLS = &tls.Config{}
+			fakeServer.HTTPTestServer.TLS.RootCAs = testhelpers.CertPool(caFileName)
+			fakeServer.HTTPTestServer.TLS.ClientCAs = testhelpers.CertPool(caFileName)
+			fakeServer.HTTPTestServer.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			fakeServer.HTTPTestServer.TLS.Certificates = []tls.Certificate{serverCert}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			fakeServer.HTTPTestServer.StartTLS()
+			client, err = NewServiceDiscoveryClient(fakeServer.URL(), caFileName, clientCertFileName, clientKeyFileName)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			fakeServer.Close()
+			os.Remove(caFileName)
+			os.Remove(clientCertFileName)
+			os.Remove(clientKeyFileName)
+		})
+
+		It("gets the current revision", func() {
+			fakeServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/watch", ""),
+				ghttp.RespondWith(http.StatusOK, `{"revision": 7, "events": []}`)))
+
+			revision, err := client.CurrentRevision(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revision).To(Equal(uint64(7)))
+		})
+
+		It("returns the new revision and the hostnames that changed", func() {
+			fakeServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/watch", "since=7&wait=5"),
+				ghttp.RespondWith(http.StatusOK, `{
+					"revision": 9,
+					"events": [
+						{"revision": 8, "type": "added", "hostname": "app-id.apps.internal.", "host": {"ip_address": "192.168.0.1"}},
+						{"revision": 9, "type": "removed", "hostname": "other.apps.internal.", "host": {"ip_address": "192.168.0.2"}}
+					]
+				}`)))
+
+			revision, hostnames, err := client.Watch(ctx, 7, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revision).To(Equal(uint64(9)))
+			Expect(hostnames).To(Equal([]string{"app-id.apps.internal.", "other.apps.internal."}))
+		})
+
+		It("returns the events with their hosts", func() {
+			fakeServer.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/watch", "since=7&wait=5"),
+				ghttp.RespondWith(http.StatusOK, `{
+					"revision": 9,
+					"events": [
+						{"revision": 8, "type": "added", "hostname": "app-id.apps.internal.", "host": {"ip_address": "192.168.0.1", "port": 8080}},
+						{"revision": 9, "type": "removed", "hostname": "other.apps.internal.", "host": {"ip_address": "192.168.0.2"}}
+					]
+				}`)))
+
+			revision, events, err := client.WatchEvents(ctx, 7, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revision).To(Equal(uint64(9)))
+			Expect(events).To(Equal([]Event{
+				{Type: "added", Hostname: "app-id.apps.internal.", Host: Host{IP: "192.168.0.1", Port: 8080}},
+				{Type: "removed", Hostname: "other.apps.internal.", Host: Host{IP: "192.168.0.2"}},
+			}))
+		})
+
+		It("carries when the hosts of events would go stale", func() {
+			fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusOK, `{
+				"revision": 8,
+				"events": [
+					{"revision": 8, "type": "added", "hostname": "app-id.apps.internal.", "host": {"ip_address": "192.168.0.1", "max_age": 20}}
+				]
+			}`))
+
+			_, events, err := client.WatchEvents(ctx, 7, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Host.StaleAt).To(BeTemporally("~", time.Now().Add(20*time.Second), time.Second))
+		})
+
+		Describe("Routes", func() {
+			It("returns every host by hostname", func() {
+				fakeServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v1/health"),
+						ghttp.RespondWith(http.StatusOK, `{"warm": true}`)),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/routes"),
+						ghttp.RespondWith(http.StatusOK, `{
+							"addresses": [
+								{"hostname": "app-id.apps.internal.", "hosts": [{"ip_address": "192.168.0.1", "port": 8080}, {"ip_address": "192.168.0.2"}]},
+								{"hostname": "other.apps.internal.", "hosts": [{"ip_address": "192.168.0.3"}]}
+							]
+						}`)))
+
+				routes, err := client.Routes(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(routes).To(Equal(map[string][]Host{
+					"app-id.apps.internal.": {{IP: "192.168.0.1", Port: 8080}, {IP: "192.168.0.2"}},
+					"other.apps.internal.":  {{IP: "192.168.0.3"}},
+				}))
+			})
+
+			It("carries when each host would go stale", func() {
+				fakeServer.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{"warm": true}`),
+					ghttp.RespondWith(http.StatusOK, `{
+						"addresses": [
+							{"hostname": "app-id.apps.internal.", "hosts": [{"ip_address": "192.168.0.1", "max_age": 20}]}
+						]
+					}`))
+
+				routes, err := client.Routes(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(routes["app-id.apps.internal."]).To(HaveLen(1))
+				Expect(routes["app-id.apps.internal."][0].StaleAt).To(BeTemporally("~", time.Now().Add(20*time.Second), time.Second))
+			})
+
+			Context("when the address table is not warm", func() {
+				BeforeEach(func() {
+					fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusServiceUnavailable, "address table is not warm"))
+				})
+
+				It("returns an error", func() {
+					_, err := client.Routes(ctx)
+					Expect(err).To(MatchError("address table is not warm"))
+					Expect(fakeServer.ReceivedRequests()).To(HaveLen(1))
+				})
+			})
+
+			Context("when the server responds with an error", func() {
+				BeforeEach(func() {
+					fakeServer.AppendHandlers(
+						ghttp.RespondWith(http.StatusOK, `{"warm": true}`),
+						ghttp.RespondWith(http.StatusInternalServerError, ""))
+				})
+
+				It("returns an error", func() {
+					_, err := client.Routes(ctx)
+					Expect(err).To(MatchError("received non successful response from server: 500"))
+				})
+			})
+		})
+
+		Context("when the revision is no longer available", func() {
+			BeforeEach(func() {
+				fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusGone, "revision 7 is unavailable"))
+			})
+
+			It("returns ErrRevisionUnavailable", func() {
+				_, _, err := client.Watch(ctx, 7, 5*time.Second)
+				Expect(err).To(Equal(ErrRevisionUnavailable))
+			})
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, ""))
+			})
+
+			It("returns an error", func() {
+				_, err := client.CurrentRevision(ctx)
+				Expect(err).To(MatchError("received non successful response from server: 500"))
+			})
+		})
+	})
+
+	Describe("with several backends", func() {
+		var (
+			firstServer  *ghttp.Server
+			secondServer *ghttp.Server
+			serverURLs   []string
+			hostsBody    string
+		)
+
+		newServer := func() *ghttp.Server {
+			server := ghttp.NewUnstartedServer()
+			server.HTTPTestServer.TLS = &tls.Config{}
+			server.HTTPTestServer.TLS.ClientCAs = testhelpers.CertPool(caFileName)
+			server.HTTPTestServer.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			server.HTTPTestServer.TLS.Certificates = []tls.Certificate{serverCert}
+			server.HTTPTestServer.StartTLS()
+			return server
+		}
+
+		BeforeEach(func() {
+			firstServer = newServer()
+			secondServer = newServer()
+			serverURLs = []string{firstServer.URL(), secondServer.URL()}
+			hostsBody = `{"Hosts": [{"ip_address": "192.168.0.1"}]}`
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			client, err = NewServiceDiscoveryClientWithBackends(serverURLs, "", caFileName, clientCertFileName, clientKeyFileName,
+				DefaultRetryPolicy, clock.NewClock(), &fakes.MetricsSender{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			firstServer.Close()
+			secondServer.Close()
+			os.Remove(caFileName)
+			os.Remove(clientCertFileName)
+			os.Remove(clientKeyFileName)
+		})
+
+		It("requires at least one backend", func() {
+			_, err := NewServiceDiscoveryClientWithBackends([]string{}, "", caFileName, clientCertFileName, clientKeyFileName,
+				DefaultRetryPolicy, clock.NewClock(), &fakes.MetricsSender{})
+			Expect(err).To(MatchError("no service discovery controller urls"))
+		})
+
+		Context("when a backend cannot be reached", func() {
+			BeforeEach(func() {
+				firstServer.Close()
+				secondServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+					ghttp.RespondWith(http.StatusOK, hostsBody)))
+			})
+
+			It("fails over to the next backend", func() {
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+				Expect(client.GetHealthyBackends()).To(Equal(1.0))
+			})
+		})
+
+		Context("when a backend's address table is not warm", func() {
+			BeforeEach(func() {
+				firstServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, "address table is not warm"))
+				secondServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+					ghttp.RespondWith(http.StatusOK, hostsBody)))
+			})
+
+			It("fails over to the next backend", func() {
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+				Expect(firstServer.ReceivedRequests()).To(HaveLen(1))
+			})
+
+			It("prefers the healthy backend for later lookups", func() {
+				client.IPs(ctx, "app-id.apps.internal.")
+
+				secondServer.AppendHandlers(ghttp.RespondWith(http.StatusOK, hostsBody))
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+				Expect(firstServer.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when every backend cannot be reached", func() {
+			BeforeEach(func() {
+				firstServer.Close()
+				secondServer.Close()
+			})
+
+			It("returns an error", func() {
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
+				Expect(err).To(HaveOccurred())
+				Expect(client.GetHealthyBackends()).To(Equal(0.0))
+			})
+		})
+
+		Describe("Hostnames", func() {
+			Context("when the ip is registered", func() {
+				BeforeEach(func() {
+					firstServer.AppendHandlers(ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v1/reverse/10.255.0.2"),
+						ghttp.RespondWith(http.StatusOK, `{"ip": "10.255.0.2", "hostnames": ["app-id.apps.internal."]}`)))
+				})
+
+				It("returns the hostnames", func() {
+					Expect(client.Hostnames(ctx, "10.255.0.2")).To(Equal([]string{"app-id.apps.internal."}))
+				})
+			})
+
+			Context("when the ip is not registered", func() {
+				BeforeEach(func() {
+					firstServer.AppendHandlers(ghttp.RespondWith(http.StatusOK, `{"ip": "10.255.0.2", "hostnames": [], "not_found": true}`))
+				})
+
+				It("returns ErrUnknownHostname", func() {
+					_, err := client.Hostnames(ctx, "10.255.0.2")
+					Expect(err).To(Equal(ErrUnknownHostname))
+					Expect(secondServer.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+
+			Context("when a backend's address table is not warm", func() {
+				BeforeEach(func() {
+					firstServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, "address table is not warm"))
+					secondServer.AppendHandlers(ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v1/reverse/10.255.0.2"),
+						ghttp.RespondWith(http.StatusOK, `{"ip": "10.255.0.2", "hostnames": ["app-id.apps.internal."]}`)))
+				})
+
+				It("fails over to the next backend", func() {
+					Expect(client.Hostnames(ctx, "10.255.0.2")).To(Equal([]string{"app-id.apps.internal."}))
+					Expect(client.GetHealthyBackends()).To(Equal(1.0))
+				})
+			})
+
+			Context("when every backend fails", func() {
+				BeforeEach(func() {
+					firstServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, ""))
+					secondServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, ""))
+				})
+
+				It("returns an error", func() {
+					_, err := client.Hostnames(ctx, "10.255.0.2")
+					Expect(err).To(MatchError("received non successful response from server: 500"))
+				})
+			})
+		})
+
+		Describe("CheckHealth", func() {
+			BeforeEach(func() {
+				firstServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/health"),
+					ghttp.RespondWith(http.StatusServiceUnavailable, "address table is not warm")))
+				secondServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/health"),
+					ghttp.RespondWith(http.StatusOK, `{"warm": true}`)))
+			})
+
+			It("sends lookups to the warm backends first", func() {
+				secondServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+					ghttp.RespondWith(http.StatusOK, hostsBody)))
+
+				client.CheckHealth(ctx)
+				Expect(client.GetHealthyBackends()).To(Equal(1.0))
+
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+				Expect(firstServer.ReceivedRequests()).To(HaveLen(1))
+			})
+
+			It("watches a warm backend", func() {
+				secondServer.AppendHandlers(ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/v1/watch"),
+					ghttp.RespondWith(http.StatusOK, `{"revision": 7, "events": []}`)))
+
+				client.CheckHealth(ctx)
+
+				Expect(client.CurrentRevision(ctx)).To(Equal(uint64(7)))
+				Expect(firstServer.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("retries and circuit breaking", func() {
+		var (
+			retryPolicy   RetryPolicy
+			fakeClock     *fakeclock.FakeClock
+			metricsSender *fakes.MetricsSender
+			hostsHandler  http.HandlerFunc
+		)
+
+		closeConnection := func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			conn.Close()
+		}
+
+		counters := func() []string {
+			names := []string{}
+			for i := 0; i < metricsSender.IncrementCounterCallCount(); i++ {
+				names = append(names, metricsSender.IncrementCounterArgsForCall(i))
+			}
+			return names
+		}
+
+		BeforeEach(func() {
+			fakeServer = ghttp.NewUnstartedServer()
+			fakeServer.HTTPTestServer.TLS = &tls.Config{}
+			fakeServer.HTTPTestServer.TLS.ClientCAs = testhelpers.CertPool(caFileName)
+			fakeServer.HTTPTestServer.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			fakeServer.HTTPTestServer.TLS.Certificates = []tls.Certificate{serverCert}
+
+			retryPolicy = DefaultRetryPolicy
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+			metricsSender = &fakes.MetricsSender{}
+			hostsHandler = ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v1/registration/app-id.apps.internal."),
+				ghttp.RespondWith(http.StatusOK, `{"Hosts": [{"ip_address": "192.168.0.1"}]}`))
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			fakeServer.HTTPTestServer.StartTLS()
+			client, err = NewServiceDiscoveryClientWithBackends([]string{fakeServer.URL()}, "", caFileName, clientCertFileName, clientKeyFileName,
+				retryPolicy, fakeClock, metricsSender)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			fakeServer.Close()
+			os.Remove(caFileName)
+			os.Remove(clientCertFileName)
+			os.Remove(clientKeyFileName)
+		})
+
+		Context("when the connection fails", func() {
+			BeforeEach(func() {
+				fakeServer.AppendHandlers(closeConnection, hostsHandler)
+			})
+
+			It("backs off and retries", func() {
+				result := make(chan []string)
+				go func() {
+					defer GinkgoRecover()
+					ips, err := client.IPs(ctx, "app-id.apps.internal.")
+					Expect(err).NotTo(HaveOccurred())
+					result <- ips
+				}()
+
+				Consistently(result).ShouldNot(Receive())
+				fakeClock.WaitForWatcherAndIncrement(retryPolicy.InitialBackoff)
+				Eventually(result).Should(Receive(Equal([]string{"192.168.0.1"})))
+				Expect(counters()).To(Equal([]string{"SDCRequestRetries"}))
+			})
+		})
+
+		Context("when the query runs out of time", func() {
+			BeforeEach(func() {
+				retryPolicy.QueryTimeout = 50 * time.Millisecond
+				fakeServer.AppendHandlers(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(200 * time.Millisecond)
+				})
+			})
+
+			It("gives up", func() {
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
+				Expect(err).To(HaveOccurred())
+				Expect(fakeServer.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the caller's context is done", func() {
+			It("does not send the query", func() {
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				_, err := client.IPs(cancelledCtx, "app-id.apps.internal.")
+				Expect(err).To(HaveOccurred())
+				Expect(fakeServer.ReceivedRequests()).To(BeEmpty())
+				Expect(client.GetCircuitBreakerState()).To(Equal(0.0))
+			})
+		})
+
+		Context("when the controller says how long the hosts may be cached", func() {
+			BeforeEach(func() {
+				fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusOK,
+					`{"Hosts": [{"ip_address": "192.168.0.1"}, {"ip_address": "192.168.0.2"}]}`,
+					http.Header{"Cache-Control": []string{"max-age=9"}},
+				))
+			})
+
+			It("returns when the hosts would go stale", func() {
+				hosts, err := client.Hosts(ctx, "app-id.apps.internal.")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hosts).To(ConsistOf(
+					Host{IP: "192.168.0.1", StaleAt: fakeClock.Now().Add(9 * time.Second)},
+					Host{IP: "192.168.0.2", StaleAt: fakeClock.Now().Add(9 * time.Second)},
+				))
+			})
+		})
+
+		Context("when the controller does not know the hostname", func() {
+			BeforeEach(func() {
+				retryPolicy.BreakerThreshold = 1
+				unknownHandler := ghttp.RespondWith(http.StatusOK, `{"Hosts": [], "not_found": true}`)
+				fakeServer.AppendHandlers(unknownHandler, unknownHandler)
+			})
+
+			It("returns ErrUnknownHostname without retrying or counting it as a failure", func() {
+				for i := 0; i < 2; i++ {
+					hosts, err := client.Hosts(ctx, "app-id.apps.internal.")
+					Expect(err).To(Equal(ErrUnknownHostname))
+					Expect(hosts).To(BeEmpty())
+				}
+
+				Expect(fakeServer.ReceivedRequests()).To(HaveLen(2))
+				Expect(client.GetCircuitBreakerState()).To(Equal(0.0))
+				Expect(counters()).To(BeEmpty())
+			})
+		})
+
+		Context("when queries keep failing", func() {
+			BeforeEach(func() {
+				retryPolicy.MaxAttempts = 1
+				retryPolicy.BreakerThreshold = 2
+				fakeServer.AppendHandlers(
+					ghttp.RespondWith(http.StatusInternalServerError, "address table is not warm"),
+					ghttp.RespondWith(http.StatusInternalServerError, "address table is not warm"),
+				)
+			})
+
+			JustBeforeEach(func() {
+				for i := 0; i < 2; i++ {
+					_, err := client.IPs(ctx, "app-id.apps.internal.")
+					Expect(err).To(HaveOccurred())
+				}
+			})
+
+			It("fails fast without querying the controller", func() {
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
+				Expect(err).To(Equal(ErrCircuitOpen))
+				Expect(fakeServer.ReceivedRequests()).To(HaveLen(2))
+
+				Expect(client.GetCircuitBreakerState()).To(Equal(1.0))
+				Expect(counters()).To(Equal([]string{"SDCCircuitBreakerOpened", "SDCCircuitBreakerRejections"}))
+			})
+
+			It("lets a query through once the cooldown has passed", func() {
+				fakeServer.AppendHandlers(hostsHandler)
+				fakeClock.Increment(retryPolicy.BreakerCooldown)
+
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+				Expect(client.GetCircuitBreakerState()).To(Equal(0.0))
+			})
+
+			It("lets another query through when the one after the cooldown is cancelled", func() {
+				fakeClock.Increment(retryPolicy.BreakerCooldown)
+
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+				_, err := client.IPs(cancelledCtx, "app-id.apps.internal.")
+				Expect(err).NotTo(Equal(ErrCircuitOpen))
+
+				fakeServer.AppendHandlers(hostsHandler)
+				Expect(client.IPs(ctx, "app-id.apps.internal.")).To(Equal([]string{"192.168.0.1"}))
+			})
+
+			It("opens again when the query after the cooldown fails", func() {
+				fakeServer.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, ""))
+				fakeClock.Increment(retryPolicy.BreakerCooldown)
+
+				_, err := client.IPs(ctx, "app-id.apps.internal.")
+				Expect(err).NotTo(Equal(ErrCircuitOpen))
+
+				_, err = client.IPs(ctx, "app-id.apps.internal.")
+				Expect(err).To(Equal(ErrCircuitOpen))
+			})
+		})
+
+		Context("when the breaker is disabled", func() {
+			BeforeEach(func() {
+				retryPolicy.MaxAttempts = 1
+				retryPolicy.BreakerThreshold = 0
+				fakeServer.AllowUnhandledRequests = true
+				fakeServer.UnhandledRequestStatusCode = http.StatusInternalServerError
+			})
+
+			It("keeps querying the controller", func() {
+				for i := 0; i < 10; i++ {
+					_, err := client.IPs(ctx, "app-id.apps.internal.")
+					Expect(err).NotTo(Equal(ErrCircuitOpen))
+				}
+				Expect(fakeServer.ReceivedRequests()).To(HaveLen(10))
+			})
+		})
+	})
 })
@@ -98,6 +98,21 @@ var _ = Describe("Integration", func() {
 				Expect(session.Err).To(gbytes.Say("invalid required env var DIGLETT_FREQUENCY_MS"))
 			})
 		})
+
+		Context("when DIGLETT_RECORD_TYPE is not A or AAAA", func() {
+			BeforeEach(func() {
+				appStartCommand.Env = []string{
+					fmt.Sprintf("PORT=%d", listenPort),
+					"DIGLETT_DESTINATION=google.com",
+					"DIGLETT_FREQUENCY_MS=100",
+					"DIGLETT_RECORD_TYPE=MX",
+				}
+			})
+			It("crashes", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("invalid env var DIGLETT_RECORD_TYPE, must be A or AAAA"))
+			})
+		})
 	})
 
 	Describe("endpoints", func() {
@@ -59,7 +59,14 @@ func main() {
 	if destination == "" {
 		log.Fatal("invalid required env var DIGLETT_DESTINATION")
 	}
-	answerSectionRegexp, err = regexp.Compile(destination + `.*IN.*A`)
+	recordType := os.Getenv("DIGLETT_RECORD_TYPE")
+	if recordType == "" {
+		recordType = "A"
+	}
+	if recordType != "A" && recordType != "AAAA" {
+		log.Fatal("invalid env var DIGLETT_RECORD_TYPE, must be A or AAAA")
+	}
+	answerSectionRegexp, err = regexp.Compile(regexp.QuoteMeta(destination) + `.*IN\s+` + recordType + `\s`)
 	if err != nil {
 		panic(err) // not tested
 	}
@@ -87,7 +94,7 @@ func main() {
 	log.SetOutput(os.Stdout)
 	ticker := time.NewTicker(time.Duration(frequency) * time.Millisecond)
 	for range ticker.C {
-		cmd := exec.Command("dig", destination, "+noall", "+answer", "+stats")
+		cmd := exec.Command("dig", destination, recordType, "+noall", "+answer", "+stats")
 		output, err := cmd.Output()
 		if err != nil {
 			panic(err) // not tested
@@ -10,11 +10,18 @@ import (
 )
 
 type DigHandler struct {
+	IPv6 bool
 }
 
 func (h *DigHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	destination := strings.TrimPrefix(req.URL.Path, "/dig/")
-	destination = strings.Split(destination, ":")[0]
+	prefix := "/dig/"
+	if h.IPv6 {
+		prefix = "/dig6/"
+	}
+	destination := strings.TrimPrefix(req.URL.Path, prefix)
+	if host, _, err := net.SplitHostPort(destination); err == nil {
+		destination = host
+	}
 
 	ips, err := net.LookupIP(destination)
 	if err != nil {
@@ -22,19 +29,22 @@ func (h *DigHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var ip4s []string
+	var matchingIPs []string
 
 	for _, ip := range ips {
-		ip4s = append(ip4s, ip.To4().String())
+		isIPv4 := ip.To4() != nil
+		if isIPv4 != h.IPv6 {
+			matchingIPs = append(matchingIPs, ip.String())
+		}
 	}
 
-	ip4Json, err := json.Marshal(ip4s)
+	ipsJson, err := json.Marshal(matchingIPs)
 	if err != nil {
 		handleDigError(err, destination, resp)
 		return
 	}
 
-	resp.Write(ip4Json)
+	resp.Write(ipsJson)
 }
 
 
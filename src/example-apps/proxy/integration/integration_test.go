@@ -95,6 +95,28 @@ var _ = Describe("Integration", func() {
 			Expect(responseBytes).To(ContainSubstring("Ping succeeded"))
 		})
 
+		It("should respond to /dig with the IPv4 addresses of the provided address", func() {
+			response, err := http.DefaultClient.Get("http://" + address + "/dig/127.0.0.1:8080")
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.StatusCode).To(Equal(200))
+
+			responseBytes, err := ioutil.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(responseBytes).To(MatchJSON(`["127.0.0.1"]`))
+		})
+
+		It("should respond to /dig6 with the IPv6 addresses of the provided address", func() {
+			response, err := http.DefaultClient.Get("http://" + address + "/dig6/[::1]:8080")
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.StatusCode).To(Equal(200))
+
+			responseBytes, err := ioutil.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(responseBytes).To(MatchJSON(`["::1"]`))
+		})
+
 		It("should respond to /proxy by proxying the request to the provided address", func() {
 			response, err := http.DefaultClient.Get("http://" + address + "/proxy/" + destinationAddress)
 			Expect(err).NotTo(HaveOccurred())
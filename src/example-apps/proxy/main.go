@@ -9,10 +9,11 @@ import (
 	"strconv"
 )
 
-func launchHandler(port int, downloadHandler, digHandler, pingHandler, proxyHandler, statsHandler, uploadHandler http.Handler) {
+func launchHandler(port int, downloadHandler, digHandler, dig6Handler, pingHandler, proxyHandler, statsHandler, uploadHandler http.Handler) {
 	mux := http.NewServeMux()
 	mux.Handle("/download/", downloadHandler)
 	mux.Handle("/dig/", digHandler)
+	mux.Handle("/dig6/", dig6Handler)
 	mux.Handle("/ping/", pingHandler)
 	mux.Handle("/proxy/", proxyHandler)
 	mux.Handle("/stats", statsHandler)
@@ -36,6 +37,7 @@ func main() {
 	downloadHandler := &handlers.DownloadHandler{}
 	pingHandler := &handlers.PingHandler{}
 	digHandler := &handlers.DigHandler{}
+	dig6Handler := &handlers.DigHandler{IPv6: true}
 	proxyHandler := &handlers.ProxyHandler{
 		Stats: stats,
 	}
@@ -44,5 +46,5 @@ func main() {
 	}
 	uploadHandler := &handlers.UploadHandler{}
 
-	launchHandler(systemPort, downloadHandler, digHandler, pingHandler, proxyHandler, statsHandler, uploadHandler)
+	launchHandler(systemPort, downloadHandler, digHandler, dig6Handler, pingHandler, proxyHandler, statsHandler, uploadHandler)
 }
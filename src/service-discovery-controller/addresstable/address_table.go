@@ -2,6 +2,7 @@ package addresstable
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 )
 
 type AddressTable struct {
-	addresses          map[string][]entry
+	shards             []*shard
 	clock              clock.Clock
 	stalenessThreshold time.Duration
 	mutex              sync.RWMutex
@@ -21,22 +22,89 @@ type AddressTable struct {
 	resumePruningDelay time.Duration
 	warm               bool
 	warmMutex          sync.RWMutex
+	revision           uint64
+	events             []Event
+	changed            chan struct{}
+	eventsMutex        sync.RWMutex
+	maxPrunePercent    int
+	maxPruneCount      int
+	pruningStatus      PruningStatus
+	reverse            map[string]map[string]struct{}
+	reverseMutex       sync.RWMutex
+}
+
+type PruningStatus struct {
+	Paused       bool
+	Held         bool
+	StaleEntries int
+	TotalEntries int
 }
 
 type entry struct {
-	ip         string
-	updateTime time.Time
+	ip                string
+	updateTime        time.Time
+	endpointUpdatedAt int64
+	metadata          Metadata
+	sources           []string
+}
+
+type entryKey struct {
+	hostname string
+	ip       string
+}
+
+type tombstone struct {
+	endpointUpdatedAt int64
+	removeTime        time.Time
+}
+
+// Metadata describes an instance. Source names the route source that last
+// registered it.
+type Metadata struct {
+	Port             uint16
+	AppGUID          string
+	ProcessGUID      string
+	InstanceIndex    string
+	AvailabilityZone string
+	Tags             map[string]string
+	Source           string
+}
+
+func (m Metadata) equal(other Metadata) bool {
+	if m.Port != other.Port ||
+		m.AppGUID != other.AppGUID ||
+		m.ProcessGUID != other.ProcessGUID ||
+		m.InstanceIndex != other.InstanceIndex ||
+		m.AvailabilityZone != other.AvailabilityZone ||
+		m.Source != other.Source ||
+		len(m.Tags) != len(other.Tags) {
+		return false
+	}
+	for key, value := range m.Tags {
+		if otherValue, ok := other.Tags[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+type Endpoint struct {
+	IP         string
+	UpdateTime time.Time
+	Metadata   Metadata
 }
 
 func NewAddressTable(stalenessThreshold, pruningInterval, resumePruningDelay time.Duration, clock clock.Clock, logger lager.Logger) *AddressTable {
 	table := &AddressTable{
-		addresses:          map[string][]entry{},
+		shards:             newShards(),
 		clock:              clock,
 		stalenessThreshold: stalenessThreshold,
 		ticker:             clock.NewTicker(pruningInterval),
 		pausedPruning:      false,
 		logger:             logger,
 		resumePruningDelay: resumePruningDelay,
+		changed:            make(chan struct{}),
+		reverse:            map[string]map[string]struct{}{},
 	}
 
 	table.pruneStaleEntriesOnInterval(pruningInterval)
@@ -44,57 +112,197 @@ func NewAddressTable(stalenessThreshold, pruningInterval, resumePruningDelay tim
 }
 
 func (at *AddressTable) Add(hostnames []string, ip string) {
-	at.mutex.Lock()
+	at.AddWithMetadata(hostnames, ip, 0, Metadata{})
+}
+
+// AddWithMetadata ignores hostnames for which a newer register or unregister
+// has already been applied and returns how many were ignored. An
+// endpointUpdatedAt of zero is never considered out of order.
+func (at *AddressTable) AddWithMetadata(hostnames []string, ip string, endpointUpdatedAt int64, metadata Metadata) int {
+	var dropped int
 	for _, hostname := range hostnames {
 		fqHostname := fqdn(hostname)
-		entries := at.entriesForHostname(fqHostname)
-		entryIndex := indexOf(entries, ip)
-		if entryIndex == -1 {
-			at.addresses[fqHostname] = append(entries, entry{ip: ip, updateTime: at.clock.Now()})
-		} else {
-			at.addresses[fqHostname][entryIndex].updateTime = at.clock.Now()
+		shard := at.shardFor(fqHostname)
+		shard.mutex.Lock()
+		if !at.addToShard(shard, fqHostname, ip, endpointUpdatedAt, metadata) {
+			dropped++
 		}
+		shard.mutex.Unlock()
+		at.flushEvents(shard)
 	}
-	at.mutex.Unlock()
+	return dropped
+}
+
+func (at *AddressTable) addToShard(shard *shard, hostname, ip string, endpointUpdatedAt int64, metadata Metadata) bool {
+	key := entryKey{hostname: hostname, ip: ip}
+	if removed, ok := shard.tombstones[key]; ok && removed.supersedes(endpointUpdatedAt) {
+		return false
+	}
+	delete(shard.tombstones, key)
+
+	entries := shard.entriesForHostname(hostname)
+	entryIndex := indexOf(entries, ip)
+	if entryIndex == -1 {
+		newEntry := entry{ip: ip, updateTime: at.clock.Now(), endpointUpdatedAt: endpointUpdatedAt, metadata: metadata, sources: []string{metadata.Source}}
+		shard.addresses[hostname] = append(entries, newEntry)
+		shard.trackExpiry(key, newEntry.updateTime)
+		at.indexIP(ip, hostname)
+		shard.publish(EventAdded, hostname, newEntry)
+		return true
+	}
+
+	if isOutOfOrder(endpointUpdatedAt, entries[entryIndex].endpointUpdatedAt) {
+		return false
+	}
+
+	existing := &entries[entryIndex]
+	metadataChanged := !existing.metadata.equal(metadata)
+	existing.updateTime = at.clock.Now()
+	existing.metadata = metadata
+	existing.sources = withSource(existing.sources, metadata.Source)
+	if endpointUpdatedAt != 0 {
+		existing.endpointUpdatedAt = endpointUpdatedAt
+	}
+	shard.trackExpiry(key, existing.updateTime)
+	if metadataChanged {
+		shard.publish(EventRefreshed, hostname, *existing)
+	}
+	return true
 }
 
 func (at *AddressTable) Remove(hostnames []string, ip string) {
-	at.mutex.Lock()
+	at.RemoveWithUpdatedAt(hostnames, ip, 0)
+}
+
+// RemoveWithUpdatedAt leaves a tombstone for each removed hostname so that a
+// delayed register older than the removal is ignored. It returns how many
+// hostnames were ignored because a newer message had already been applied.
+// The entries are removed whichever route sources registered them; see Apply
+// for unregistering the routes of a single source.
+func (at *AddressTable) RemoveWithUpdatedAt(hostnames []string, ip string, endpointUpdatedAt int64) int {
+	var dropped int
 	for _, hostname := range hostnames {
 		fqHostname := fqdn(hostname)
-		entries := at.entriesForHostname(fqHostname)
-		index := indexOf(entries, ip)
-		if index > -1 {
-			if len(entries) == 1 {
-				delete(at.addresses, fqHostname)
-			} else {
-				at.addresses[fqHostname] = append(entries[:index], entries[index+1:]...)
-			}
+		shard := at.shardFor(fqHostname)
+		shard.mutex.Lock()
+		if !at.removeFromShard(shard, fqHostname, ip, endpointUpdatedAt, "") {
+			dropped++
 		}
+		shard.mutex.Unlock()
+		at.flushEvents(shard)
 	}
-	at.mutex.Unlock()
+	return dropped
+}
+
+// removeFromShard removes the entry for the source, or for every source when
+// source is empty. An entry that other sources have also registered is kept
+// for them, and one the source never registered is left alone.
+func (at *AddressTable) removeFromShard(shard *shard, hostname, ip string, endpointUpdatedAt int64, source string) bool {
+	key := entryKey{hostname: hostname, ip: ip}
+	entries := shard.entriesForHostname(hostname)
+	index := indexOf(entries, ip)
+	if index > -1 {
+		if isOutOfOrder(endpointUpdatedAt, entries[index].endpointUpdatedAt) {
+			return false
+		}
+		if source != "" && !entries[index].ownedBy(source) {
+			return true
+		}
+		if source != "" && len(entries[index].sources) > 1 {
+			shard.disown(hostname, &entries[index], source)
+			return true
+		}
+		shard.publish(EventRemoved, hostname, entries[index])
+		shard.removeEntry(key, index, at.clock.Now())
+		at.unindexIP(ip, hostname)
+	} else if removed, ok := shard.tombstones[key]; ok && isOutOfOrder(endpointUpdatedAt, removed.endpointUpdatedAt) {
+		return false
+	}
+
+	if endpointUpdatedAt == 0 {
+		delete(shard.tombstones, key)
+	} else {
+		shard.tombstones[key] = tombstone{endpointUpdatedAt: endpointUpdatedAt, removeTime: at.clock.Now()}
+	}
+	return true
 }
 
 func (at *AddressTable) Lookup(hostname string) []string {
-	at.mutex.RLock()
+	fqHostname := fqdn(hostname)
+	shard := at.shardFor(fqHostname)
+	shard.mutex.RLock()
 
-	found := at.entriesForHostname(fqdn(hostname))
+	found := shard.entriesForHostname(fqHostname)
 	ips := entriesToIPs(found)
 
-	at.mutex.RUnlock()
+	shard.mutex.RUnlock()
 
 	return ips
 }
 
-func (at *AddressTable) GetAllAddresses() map[string][]string {
-	at.mutex.RLock()
+func (at *AddressTable) LookupEndpoints(hostname string) []Endpoint {
+	fqHostname := fqdn(hostname)
+	shard := at.shardFor(fqHostname)
+	shard.mutex.RLock()
 
-	addresses := map[string][]string{}
-	for address, entries := range at.addresses {
-		addresses[address] = entriesToIPs(entries)
+	found := shard.entriesForHostname(fqHostname)
+	endpoints := entriesToEndpoints(found)
+
+	shard.mutex.RUnlock()
+
+	return endpoints
+}
+
+// Known reports whether the hostname has endpoints, or lost its last one no
+// longer than the staleness threshold ago, as when its app is scaled to zero.
+func (at *AddressTable) Known(hostname string) bool {
+	fqHostname := fqdn(hostname)
+	shard := at.shardFor(fqHostname)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	if _, ok := shard.addresses[fqHostname]; ok {
+		return true
 	}
+	_, ok := shard.vacated[fqHostname]
+	return ok
+}
 
-	at.mutex.RUnlock()
+// LookupHostnames returns every hostname the IP is registered under, sorted.
+func (at *AddressTable) LookupHostnames(ip string) []string {
+	at.reverseMutex.RLock()
+	hostnames := make([]string, 0, len(at.reverse[ip]))
+	for hostname := range at.reverse[ip] {
+		hostnames = append(hostnames, hostname)
+	}
+	at.reverseMutex.RUnlock()
+
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+func (at *AddressTable) GetAllEndpoints() map[string][]Endpoint {
+	endpoints := map[string][]Endpoint{}
+	for _, shard := range at.shards {
+		shard.mutex.RLock()
+		for address, entries := range shard.addresses {
+			endpoints[address] = entriesToEndpoints(entries)
+		}
+		shard.mutex.RUnlock()
+	}
+
+	return endpoints
+}
+
+func (at *AddressTable) GetAllAddresses() map[string][]string {
+	addresses := map[string][]string{}
+	for _, shard := range at.shards {
+		shard.mutex.RLock()
+		for address, entries := range shard.addresses {
+			addresses[address] = entriesToIPs(entries)
+		}
+		shard.mutex.RUnlock()
+	}
 
 	return addresses
 }
@@ -132,12 +340,106 @@ func (at *AddressTable) ResumePruning() {
 	at.mutex.Unlock()
 }
 
-func (at *AddressTable) entriesForHostname(hostname string) []entry {
-	if existing, ok := at.addresses[hostname]; ok {
-		return existing
-	} else {
-		return []entry{}
+func (at *AddressTable) indexIP(ip, hostname string) {
+	at.reverseMutex.Lock()
+	hostnames, ok := at.reverse[ip]
+	if !ok {
+		hostnames = map[string]struct{}{}
+		at.reverse[ip] = hostnames
+	}
+	hostnames[hostname] = struct{}{}
+	at.reverseMutex.Unlock()
+}
+
+func (at *AddressTable) unindexIP(ip, hostname string) {
+	at.reverseMutex.Lock()
+	hostnames := at.reverse[ip]
+	delete(hostnames, hostname)
+	if len(hostnames) == 0 {
+		delete(at.reverse, ip)
 	}
+	at.reverseMutex.Unlock()
+}
+
+// ownedBy reports whether the source has registered the entry and not
+// unregistered it since.
+func (e entry) ownedBy(source string) bool {
+	for _, owner := range e.sources {
+		if owner == source {
+			return true
+		}
+	}
+	return false
+}
+
+// disown drops the source from the owners of an entry that other sources
+// still own. The metadata of the last register is kept, but no longer names
+// the source as where it came from.
+func (s *shard) disown(hostname string, e *entry, source string) {
+	e.sources = withoutSource(e.sources, source)
+	if e.metadata.Source == source {
+		e.metadata.Source = e.sources[len(e.sources)-1]
+		s.publish(EventRefreshed, hostname, *e)
+	}
+}
+
+func withSource(sources []string, source string) []string {
+	for _, owner := range sources {
+		if owner == source {
+			return sources
+		}
+	}
+	return append(sources[:len(sources):len(sources)], source)
+}
+
+func withoutSource(sources []string, source string) []string {
+	owners := make([]string, 0, len(sources))
+	for _, owner := range sources {
+		if owner != source {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+func isOutOfOrder(endpointUpdatedAt, lastEndpointUpdatedAt int64) bool {
+	return endpointUpdatedAt != 0 && endpointUpdatedAt < lastEndpointUpdatedAt
+}
+
+// supersedes reports whether the unregister that left the tombstone wins over
+// a register with the given update time. An unregister wins a tie, since a
+// register and an unregister sent at the same time cannot be ordered and
+// keeping the address could leave it registered until it is pruned.
+func (t tombstone) supersedes(endpointUpdatedAt int64) bool {
+	return endpointUpdatedAt != 0 && endpointUpdatedAt <= t.endpointUpdatedAt
+}
+
+// SetPruneLimits holds pruning for any cycle that would remove more than
+// maxPercent percent or maxCount of the entries. Zero disables a limit. While
+// pruning is held, each cycle still prunes as many of the entries that have
+// gone longest without a refresh as the limits allow, so that a mass expiry
+// is drained gradually instead of being kept forever.
+func (at *AddressTable) SetPruneLimits(maxPercent, maxCount int) {
+	at.mutex.Lock()
+	at.maxPrunePercent = maxPercent
+	at.maxPruneCount = maxCount
+	at.mutex.Unlock()
+}
+
+func (at *AddressTable) PruningStatus() PruningStatus {
+	at.mutex.RLock()
+	status := at.pruningStatus
+	status.Paused = at.pausedPruning
+	at.mutex.RUnlock()
+
+	return status
+}
+
+func (at *AddressTable) GetPruneHeld() (float64, error) {
+	if at.PruningStatus().Held {
+		return 1, nil
+	}
+	return 0, nil
 }
 
 func entriesToIPs(entries []entry) []string {
@@ -149,64 +451,178 @@ func entriesToIPs(entries []entry) []string {
 	return ips
 }
 
+func entriesToEndpoints(entries []entry) []Endpoint {
+	endpoints := make([]Endpoint, len(entries))
+	for idx, entry := range entries {
+		endpoints[idx] = Endpoint{
+			IP:         entry.ip,
+			UpdateTime: entry.updateTime,
+			Metadata:   entry.metadata,
+		}
+	}
+
+	return endpoints
+}
+
 func (at *AddressTable) pruneStaleEntriesOnInterval(pruningInterval time.Duration) {
 	go func() {
 		defer at.ticker.Stop()
 		for _ = range at.ticker.C() {
+			at.expireTombstones()
 			at.mutex.RLock()
 			if at.pausedPruning || (at.clock.Since(at.lastResume) < at.resumePruningDelay) {
 				at.mutex.RUnlock()
 				continue
 			}
 			at.mutex.RUnlock()
-			staleAddresses := at.addressesWithStaleEntriesWithReadLock()
-			at.pruneStaleEntriesWithWriteLock(staleAddresses)
+			at.pruneStaleEntries()
 		}
 	}()
 }
 
-func (at *AddressTable) pruneStaleEntriesWithWriteLock(candidateAddresses []string) {
-	if len(candidateAddresses) == 0 {
+func (at *AddressTable) pruneStaleEntries() {
+	expired := make([][]expiryItem, len(at.shards))
+	var staleCount, totalCount int
+	for i, shard := range at.shards {
+		shard.mutex.RLock()
+		expired[i] = shard.expiredEntries(at.isStale)
+		totalCount += len(shard.expiries)
+		shard.mutex.RUnlock()
+		staleCount += len(expired[i])
+	}
+
+	if at.holdPruning(staleCount, totalCount) {
+		expired = oldestExpired(expired, at.pruneLimit(totalCount))
+	} else if staleCount == 0 {
 		return
 	}
 
-	var oldTotal, newTotal int
-	at.mutex.Lock()
-	for _, staleAddr := range candidateAddresses {
-		entries, ok := at.addresses[staleAddr]
-		if ok {
-			oldCount := len(entries)
-			freshEntries := []entry{}
-			for _, entry := range entries {
-				if at.clock.Since(entry.updateTime) <= at.stalenessThreshold {
-					freshEntries = append(freshEntries, entry)
-				} else {
-					at.logger.Debug(fmt.Sprintf("pruning address %s from %s", entry.ip, staleAddr))
-				}
+	var pruned int
+	for i, shard := range at.shards {
+		pruned += at.pruneExpiredEntriesWithWriteLock(shard, expired[i])
+	}
+	at.logger.Info("pruned", lager.Data{"old-total": totalCount, "new-total": totalCount - pruned})
+}
+
+func (at *AddressTable) pruneExpiredEntriesWithWriteLock(shard *shard, expired []expiryItem) int {
+	if len(expired) == 0 {
+		return 0
+	}
+
+	var pruned int
+	shard.mutex.Lock()
+	for _, expiredItem := range expired {
+		key := expiredItem.key
+		item, ok := shard.expiryItems[key]
+		if !ok || !at.isStale(item.updateTime) {
+			continue
+		}
+
+		index := indexOf(shard.addresses[key.hostname], key.ip)
+		at.logger.Debug(fmt.Sprintf("pruning address %s from %s", key.ip, key.hostname))
+		shard.publish(EventPruned, key.hostname, shard.addresses[key.hostname][index])
+		shard.removeEntry(key, index, at.clock.Now())
+		at.unindexIP(key.ip, key.hostname)
+		pruned++
+	}
+	shard.mutex.Unlock()
+	at.flushEvents(shard)
+	return pruned
+}
+
+func (at *AddressTable) expireTombstones() {
+	for _, shard := range at.shards {
+		shard.mutex.Lock()
+		for key, removed := range shard.tombstones {
+			if at.clock.Since(removed.removeTime) > at.stalenessThreshold {
+				delete(shard.tombstones, key)
+			}
+		}
+		for hostname, removeTime := range shard.vacated {
+			if at.clock.Since(removeTime) > at.stalenessThreshold {
+				delete(shard.vacated, hostname)
 			}
-			at.addresses[staleAddr] = freshEntries
-			newCount := len(freshEntries)
-			oldTotal += oldCount
-			newTotal += newCount
 		}
+		shard.mutex.Unlock()
 	}
+}
+
+func (at *AddressTable) isStale(updateTime time.Time) bool {
+	return at.clock.Since(updateTime) > at.stalenessThreshold
+}
+
+func (at *AddressTable) holdPruning(staleCount, totalCount int) bool {
+	at.mutex.Lock()
+	wasHeld := at.pruningStatus.Held
+	held := (at.maxPruneCount > 0 && staleCount > at.maxPruneCount) ||
+		(at.maxPrunePercent > 0 && staleCount*100 > at.maxPrunePercent*totalCount)
+	at.pruningStatus = PruningStatus{
+		Held:         held,
+		StaleEntries: staleCount,
+		TotalEntries: totalCount,
+	}
+	maxPrunePercent, maxPruneCount := at.maxPrunePercent, at.maxPruneCount
 	at.mutex.Unlock()
-	at.logger.Info("pruned", lager.Data{"old-total": oldTotal, "new-total": newTotal})
+
+	data := lager.Data{
+		"stale-entries":     staleCount,
+		"total-entries":     totalCount,
+		"max-prune-percent": maxPrunePercent,
+		"max-prune-count":   maxPruneCount,
+	}
+	if held && !wasHeld {
+		// lager has no warning level; log the hold as an error so it alerts.
+		at.logger.Error("pruning-held", fmt.Errorf("%d of %d entries are stale, more than the prune limits allow; pruning at most %d per cycle", staleCount, totalCount, at.pruneLimit(totalCount)), data)
+	} else if !held && wasHeld {
+		at.logger.Info("pruning-released", data)
+	}
+	return held
 }
 
-func (at *AddressTable) addressesWithStaleEntriesWithReadLock() []string {
-	staleAddresses := []string{}
+// pruneLimit is how many entries a cycle may prune while pruning is held. It
+// is at least one, so that entries that will never be refreshed again, such
+// as those of a cell that is gone, are still pruned eventually.
+func (at *AddressTable) pruneLimit(totalCount int) int {
 	at.mutex.RLock()
-	for address, entries := range at.addresses {
-		for _, entry := range entries {
-			if at.clock.Since(entry.updateTime) > at.stalenessThreshold {
-				staleAddresses = append(staleAddresses, address)
-				break
-			}
+	maxPrunePercent, maxPruneCount := at.maxPrunePercent, at.maxPruneCount
+	at.mutex.RUnlock()
+
+	limit := totalCount
+	if maxPrunePercent > 0 && maxPrunePercent*totalCount/100 < limit {
+		limit = maxPrunePercent * totalCount / 100
+	}
+	if maxPruneCount > 0 && maxPruneCount < limit {
+		limit = maxPruneCount
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// oldestExpired keeps only the limit entries, across all shards, that have
+// gone the longest without a refresh.
+func oldestExpired(expired [][]expiryItem, limit int) [][]expiryItem {
+	type shardItem struct {
+		shard int
+		item  expiryItem
+	}
+	var all []shardItem
+	for i, items := range expired {
+		for _, item := range items {
+			all = append(all, shardItem{shard: i, item: item})
 		}
 	}
-	at.mutex.RUnlock()
-	return staleAddresses
+	sort.Slice(all, func(i, j int) bool { return all[i].item.updateTime.Before(all[j].item.updateTime) })
+	if len(all) > limit {
+		all = all[:limit]
+	}
+
+	oldest := make([][]expiryItem, len(expired))
+	for _, shardItem := range all {
+		oldest[shardItem.shard] = append(oldest[shardItem.shard], shardItem.item)
+	}
+	return oldest
 }
 
 func indexOf(entries []entry, value string) int {
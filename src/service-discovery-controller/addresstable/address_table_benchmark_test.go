@@ -0,0 +1,91 @@
+package addresstable
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager"
+)
+
+func newPopulatedTable(hostnames int) (*AddressTable, []string) {
+	table := NewAddressTable(time.Minute, time.Hour, 0, fakeclock.NewFakeClock(time.Now()), lager.NewLogger("benchmark"))
+	names := make([]string, hostnames)
+	for h := range names {
+		names[h] = fmt.Sprintf("app-%d.apps.internal.", h)
+		table.Add([]string{names[h]}, "10.0.0.1")
+	}
+	return table, names
+}
+
+// registerFlood refreshes every hostname in a loop, the way a route-emitter
+// sync does, until done is closed.
+func registerFlood(table *AddressTable, names []string, writers int, done chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for i := offset; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+					table.Add([]string{names[i%len(names)]}, "10.0.0.1")
+				}
+			}
+		}(w * len(names) / writers)
+	}
+	return &wg
+}
+
+func BenchmarkLookup(b *testing.B) {
+	table, names := newPopulatedTable(10000)
+	defer table.Shutdown()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			table.Lookup(names[i%len(names)])
+			i++
+		}
+	})
+}
+
+func BenchmarkLookupDuringRegisterFlood(b *testing.B) {
+	table, names := newPopulatedTable(10000)
+	defer table.Shutdown()
+
+	done := make(chan struct{})
+	wg := registerFlood(table, names, 4, done)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			table.Lookup(names[i%len(names)])
+			i++
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkParallelAdd(b *testing.B) {
+	table, names := newPopulatedTable(10000)
+	defer table.Shutdown()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			table.Add([]string{names[i%len(names)]}, "10.0.0.1")
+			i++
+		}
+	})
+}
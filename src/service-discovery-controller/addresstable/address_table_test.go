@@ -93,6 +93,165 @@ var _ = Describe("AddressTable", func() {
 		})
 	})
 
+	Describe("AddWithMetadata", func() {
+		var metadata addresstable.Metadata
+
+		BeforeEach(func() {
+			metadata = addresstable.Metadata{
+				Port:             8080,
+				AppGUID:          "some-app-guid",
+				ProcessGUID:      "some-process-guid",
+				InstanceIndex:    "1",
+				AvailabilityZone: "z1",
+				Tags:             map[string]string{"component": "api"},
+			}
+		})
+
+		It("stores the metadata with the endpoint", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, metadata)
+			Expect(table.LookupEndpoints("foo.com")).To(Equal([]addresstable.Endpoint{
+				{IP: "192.0.0.1", UpdateTime: fakeClock.Now(), Metadata: metadata},
+			}))
+		})
+
+		Context("when ip address is already registered", func() {
+			It("replaces the metadata and refreshes the update time", func() {
+				table.Add([]string{"foo.com"}, "192.0.0.1")
+				fakeClock.Increment(1 * time.Second)
+				table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, metadata)
+				Expect(table.LookupEndpoints("foo.com")).To(Equal([]addresstable.Endpoint{
+					{IP: "192.0.0.1", UpdateTime: fakeClock.Now(), Metadata: metadata},
+				}))
+			})
+		})
+	})
+
+	Describe("out of order messages", func() {
+		It("ignores a register older than the last applied register", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{Port: 8080})
+			dropped := table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 100, addresstable.Metadata{Port: 9090})
+			Expect(dropped).To(Equal(1))
+			Expect(table.LookupEndpoints("foo.com")[0].Metadata.Port).To(Equal(uint16(8080)))
+		})
+
+		It("applies a register with the same update time", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{})
+			Expect(table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{})).To(Equal(0))
+		})
+
+		It("ignores an unregister older than the last applied register", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{})
+			Expect(table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 100)).To(Equal(1))
+			Expect(table.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+		})
+
+		It("ignores a register older than a previous unregister", func() {
+			table.AddWithMetadata([]string{"foo.com", "bar.com"}, "192.0.0.1", 100, addresstable.Metadata{})
+			Expect(table.RemoveWithUpdatedAt([]string{"foo.com", "bar.com"}, "192.0.0.1", 200)).To(Equal(0))
+
+			Expect(table.AddWithMetadata([]string{"foo.com", "bar.com"}, "192.0.0.1", 100, addresstable.Metadata{})).To(Equal(2))
+			Expect(table.Lookup("foo.com")).To(BeEmpty())
+			Expect(table.Lookup("bar.com")).To(BeEmpty())
+		})
+
+		It("ignores a register older than an unregister that arrived first", func() {
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+			Expect(table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 100, addresstable.Metadata{})).To(Equal(1))
+			Expect(table.Lookup("foo.com")).To(BeEmpty())
+		})
+
+		It("ignores a register with the same update time as a previous unregister", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 100, addresstable.Metadata{})
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+
+			Expect(table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{})).To(Equal(1))
+			Expect(table.Lookup("foo.com")).To(BeEmpty())
+		})
+
+		It("ignores an unregister older than a previous unregister", func() {
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+			Expect(table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 100)).To(Equal(1))
+		})
+
+		It("applies a register newer than a previous unregister", func() {
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+			Expect(table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 300, addresstable.Metadata{})).To(Equal(0))
+			Expect(table.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+		})
+
+		It("always applies messages without an update time", func() {
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+			table.Add([]string{"foo.com"}, "192.0.0.1")
+			Expect(table.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+
+			table.Remove([]string{"foo.com"}, "192.0.0.1")
+			Expect(table.Lookup("foo.com")).To(BeEmpty())
+		})
+
+		It("forgets unregisters after the staleness threshold", func() {
+			table.PausePruning()
+			table.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.1", 200)
+
+			fakeClock.Increment(stalenessThreshold + time.Second)
+			Eventually(func() []string {
+				table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 100, addresstable.Metadata{})
+				return table.Lookup("foo.com")
+			}).Should(Equal([]string{"192.0.0.1"}))
+		})
+	})
+
+	Describe("Known", func() {
+		It("knows hostnames with endpoints", func() {
+			table.Add([]string{"foo.com"}, "192.0.0.1")
+			Expect(table.Known("foo.com")).To(BeTrue())
+			Expect(table.Known("bar.com")).To(BeFalse())
+		})
+
+		Context("when an app is scaled to zero", func() {
+			BeforeEach(func() {
+				table.Add([]string{"foo.com"}, "192.0.0.1")
+				table.Add([]string{"foo.com"}, "192.0.0.2")
+				table.Remove([]string{"foo.com"}, "192.0.0.1")
+				table.Remove([]string{"foo.com"}, "192.0.0.2")
+			})
+
+			It("still knows the hostname without any endpoints", func() {
+				Expect(table.Lookup("foo.com")).To(BeEmpty())
+				Expect(table.Known("foo.com")).To(BeTrue())
+			})
+
+			It("forgets the hostname after the staleness threshold", func() {
+				fakeClock.Increment(stalenessThreshold + time.Second)
+				Eventually(func() bool {
+					return table.Known("foo.com")
+				}).Should(BeFalse())
+			})
+		})
+
+		It("still knows a hostname whose last endpoint was pruned", func() {
+			table.Add([]string{"foo.com"}, "192.0.0.1")
+			fakeClock.Increment(stalenessThreshold + time.Second)
+			Eventually(func() []string {
+				return table.Lookup("foo.com")
+			}).Should(BeEmpty())
+			Expect(table.Known("foo.com")).To(BeTrue())
+		})
+	})
+
+	Describe("GetAllEndpoints", func() {
+		BeforeEach(func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, addresstable.Metadata{Port: 8080})
+			table.Add([]string{"bar.com"}, "192.0.0.4")
+		})
+
+		It("returns all endpoints", func() {
+			Expect(table.GetAllEndpoints()).To(Equal(map[string][]addresstable.Endpoint{
+				"foo.com.": {{IP: "192.0.0.1", UpdateTime: fakeClock.Now(), Metadata: addresstable.Metadata{Port: 8080}}},
+				"bar.com.": {{IP: "192.0.0.4", UpdateTime: fakeClock.Now()}},
+			}))
+		})
+	})
+
 	Describe("Remove", func() {
 		It("removes an endpoint", func() {
 			table.Add([]string{"foo.com"}, "192.0.0.1")
@@ -140,6 +299,80 @@ var _ = Describe("AddressTable", func() {
 		})
 	})
 
+	Describe("Apply", func() {
+		It("applies registers and unregisters in order", func() {
+			table.Add([]string{"baz.com"}, "192.0.0.3")
+
+			dropped := table.Apply([]addresstable.Change{
+				{Hostnames: []string{"foo.com", "bar.com"}, IP: "192.0.0.1", Metadata: addresstable.Metadata{Port: 8080}},
+				{Hostnames: []string{"foo.com"}, IP: "192.0.0.2"},
+				{Remove: true, Hostnames: []string{"bar.com", "baz.com"}, IP: "192.0.0.1"},
+				{Remove: true, Hostnames: []string{"baz.com."}, IP: "192.0.0.3"},
+			})
+
+			Expect(dropped).To(Equal([]int{0, 0, 0, 0}))
+			Expect(table.LookupEndpoints("foo.com")).To(Equal([]addresstable.Endpoint{
+				{IP: "192.0.0.1", UpdateTime: fakeClock.Now(), Metadata: addresstable.Metadata{Port: 8080}},
+				{IP: "192.0.0.2", UpdateTime: fakeClock.Now()},
+			}))
+			Expect(table.Lookup("bar.com")).To(BeEmpty())
+			Expect(table.Lookup("baz.com")).To(BeEmpty())
+		})
+
+		It("returns how many hostnames of each change were out of order", func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 200, addresstable.Metadata{})
+
+			dropped := table.Apply([]addresstable.Change{
+				{Hostnames: []string{"foo.com", "bar.com"}, IP: "192.0.0.1", EndpointUpdatedAt: 100},
+				{Remove: true, Hostnames: []string{"foo.com"}, IP: "192.0.0.1", EndpointUpdatedAt: 150},
+				{Remove: true, Hostnames: []string{"bar.com"}, IP: "192.0.0.1", EndpointUpdatedAt: 300},
+				{Hostnames: []string{"bar.com"}, IP: "192.0.0.1", EndpointUpdatedAt: 250},
+			})
+
+			Expect(dropped).To(Equal([]int{1, 1, 0, 1}))
+			Expect(table.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+			Expect(table.Lookup("bar.com")).To(BeEmpty())
+		})
+
+		Context("when several route sources register the same ip", func() {
+			BeforeEach(func() {
+				table.Apply([]addresstable.Change{
+					{Hostnames: []string{"foo.com"}, IP: "192.0.0.1", Metadata: addresstable.Metadata{Source: "nats"}},
+					{Hostnames: []string{"foo.com"}, IP: "192.0.0.1", Metadata: addresstable.Metadata{Source: "file"}},
+					{Hostnames: []string{"bar.com"}, IP: "192.0.0.2", Metadata: addresstable.Metadata{Source: "nats"}},
+				})
+			})
+
+			It("keeps an entry until every source that registered it unregisters it", func() {
+				table.Apply([]addresstable.Change{
+					{Remove: true, Hostnames: []string{"foo.com"}, IP: "192.0.0.1", Metadata: addresstable.Metadata{Source: "file"}},
+				})
+				endpoints := table.LookupEndpoints("foo.com")
+				Expect(endpoints).To(HaveLen(1))
+				Expect(endpoints[0].Metadata.Source).To(Equal("nats"))
+
+				table.Apply([]addresstable.Change{
+					{Remove: true, Hostnames: []string{"foo.com"}, IP: "192.0.0.1", Metadata: addresstable.Metadata{Source: "nats"}},
+				})
+				Expect(table.Lookup("foo.com")).To(BeEmpty())
+			})
+
+			It("does not remove an entry on behalf of a source that never registered it", func() {
+				dropped := table.Apply([]addresstable.Change{
+					{Remove: true, Hostnames: []string{"bar.com"}, IP: "192.0.0.2", Metadata: addresstable.Metadata{Source: "file"}},
+				})
+
+				Expect(dropped).To(Equal([]int{0}))
+				Expect(table.Lookup("bar.com")).To(Equal([]string{"192.0.0.2"}))
+			})
+
+			It("removes the entry for every source on Remove", func() {
+				table.Remove([]string{"foo.com"}, "192.0.0.1")
+				Expect(table.Lookup("foo.com")).To(BeEmpty())
+			})
+		})
+	})
+
 	Describe("Lookup", func() {
 		It("returns an empty array for an unknown hostname", func() {
 			Expect(table.Lookup("foo.com")).To(Equal([]string{}))
@@ -173,6 +406,41 @@ var _ = Describe("AddressTable", func() {
 		})
 	})
 
+	Describe("LookupHostnames", func() {
+		It("returns an empty array for an unknown ip", func() {
+			Expect(table.LookupHostnames("192.0.0.1")).To(Equal([]string{}))
+		})
+
+		Context("when an ip is registered to several hostnames", func() {
+			BeforeEach(func() {
+				table.Add([]string{"foo.com", "bar.com."}, "192.0.0.1")
+				table.Add([]string{"baz.com"}, "192.0.0.2")
+			})
+
+			It("returns the sorted hostnames for the ip", func() {
+				Expect(table.LookupHostnames("192.0.0.1")).To(Equal([]string{"bar.com.", "foo.com."}))
+				Expect(table.LookupHostnames("192.0.0.2")).To(Equal([]string{"baz.com."}))
+			})
+
+			It("does not return hostnames the ip was removed from", func() {
+				table.Remove([]string{"foo.com"}, "192.0.0.1")
+				Expect(table.LookupHostnames("192.0.0.1")).To(Equal([]string{"bar.com."}))
+
+				table.Remove([]string{"bar.com"}, "192.0.0.1")
+				Expect(table.LookupHostnames("192.0.0.1")).To(Equal([]string{}))
+			})
+
+			It("does not return hostnames that were pruned", func() {
+				fakeClock.Increment(stalenessThreshold - 1*time.Second)
+				table.Add([]string{"bar.com"}, "192.0.0.1")
+				fakeClock.Increment(1001 * time.Millisecond)
+
+				Eventually(func() []string { return table.LookupHostnames("192.0.0.1") }).Should(Equal([]string{"bar.com."}))
+				Eventually(func() []string { return table.LookupHostnames("192.0.0.2") }).Should(Equal([]string{}))
+			})
+		})
+	})
+
 	Describe("PausePruning", func() {
 		BeforeEach(func() {
 			table.Add([]string{"stale.com"}, "192.0.0.1")
@@ -185,6 +453,89 @@ var _ = Describe("AddressTable", func() {
 		})
 	})
 
+	Describe("prune limits", func() {
+		BeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				table.Add([]string{"foo.com"}, fmt.Sprintf("192.0.0.%d", i))
+			}
+		})
+
+		Context("when a cycle would prune more than the max percent", func() {
+			BeforeEach(func() {
+				table.SetPruneLimits(50, 0)
+				fakeClock.Increment(stalenessThreshold - time.Second)
+				for i := 0; i < 4; i++ {
+					table.Add([]string{"foo.com"}, fmt.Sprintf("192.0.0.%d", i))
+				}
+				fakeClock.Increment(2 * time.Second)
+			})
+
+			It("holds pruning to the max percent and reports it", func() {
+				Eventually(table.PruningStatus).Should(Equal(addresstable.PruningStatus{
+					Held:         true,
+					StaleEntries: 6,
+					TotalEntries: 10,
+				}))
+				Eventually(func() []string { return table.Lookup("foo.com") }).Should(HaveLen(5))
+				Expect(table.Lookup("foo.com")).To(ContainElement("192.0.0.0"))
+				Expect(table.GetPruneHeld()).To(Equal(float64(1)))
+				Expect(logger.LogMessages()).To(ContainElement("test.pruning-held"))
+
+				var held lager.LogFormat
+				for _, log := range logger.Logs() {
+					if log.Message == "test.pruning-held" {
+						held = log
+					}
+				}
+				Expect(held.LogLevel).To(Equal(lager.ERROR))
+				Expect(held.Data).To(HaveKeyWithValue("error", "6 of 10 entries are stale, more than the prune limits allow; pruning at most 5 per cycle"))
+			})
+
+			Context("when the stale entries are never refreshed", func() {
+				It("prunes the rest of them in later cycles and releases the hold", func() {
+					Eventually(func() []string { return table.Lookup("foo.com") }).Should(HaveLen(5))
+					Expect(table.GetPruneHeld()).To(Equal(float64(1)))
+
+					fakeClock.Increment(pruningInterval)
+
+					Eventually(func() []string { return table.Lookup("foo.com") }).Should(HaveLen(4))
+					Expect(table.GetPruneHeld()).To(Equal(float64(0)))
+					Expect(logger.LogMessages()).To(ContainElement("test.pruning-released"))
+				})
+			})
+		})
+
+		Context("when a cycle would prune more than the max count", func() {
+			BeforeEach(func() {
+				table.SetPruneLimits(0, 9)
+				fakeClock.Increment(stalenessThreshold + time.Second)
+			})
+
+			It("prunes no more than the max count per cycle until the hold is released", func() {
+				Eventually(func() []string { return table.Lookup("foo.com") }).Should(HaveLen(1))
+				Expect(table.GetPruneHeld()).To(Equal(float64(1)))
+				Consistently(func() []string { return table.Lookup("foo.com") }).Should(HaveLen(1))
+
+				fakeClock.Increment(pruningInterval)
+
+				Eventually(func() []string { return table.Lookup("foo.com") }).Should(BeEmpty())
+				Expect(table.GetPruneHeld()).To(Equal(float64(0)))
+			})
+		})
+
+		Context("when a cycle is within the limits", func() {
+			BeforeEach(func() {
+				table.SetPruneLimits(100, 10)
+				fakeClock.Increment(stalenessThreshold + time.Second)
+			})
+
+			It("prunes", func() {
+				Eventually(func() []string { return table.Lookup("foo.com") }).Should(BeEmpty())
+				Expect(table.PruningStatus().Held).To(BeFalse())
+			})
+		})
+	})
+
 	Describe("ResumePruning", func() {
 		Context("when pruning is initially paused", func() {
 			BeforeEach(func() {
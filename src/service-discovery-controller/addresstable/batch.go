@@ -0,0 +1,57 @@
+package addresstable
+
+// Change is a register, or an unregister when Remove is set, of an IP under
+// some hostnames by the route source named in Metadata.Source. An unregister
+// only takes back the register of that source: an entry that another source
+// has also registered is kept.
+type Change struct {
+	Remove            bool
+	Hostnames         []string
+	IP                string
+	EndpointUpdatedAt int64
+	Metadata          Metadata
+}
+
+type shardChange struct {
+	change   int
+	hostname string
+}
+
+// Apply applies the changes in order, taking the lock of each shard they
+// touch once for the whole batch instead of once per hostname. It returns how
+// many hostnames of each change were ignored as out of order, following the
+// same rules as AddWithMetadata and RemoveWithUpdatedAt.
+func (at *AddressTable) Apply(changes []Change) []int {
+	byShard := map[*shard][]shardChange{}
+	var touched []*shard
+	for i, change := range changes {
+		for _, hostname := range change.Hostnames {
+			fqHostname := fqdn(hostname)
+			shard := at.shardFor(fqHostname)
+			if _, ok := byShard[shard]; !ok {
+				touched = append(touched, shard)
+			}
+			byShard[shard] = append(byShard[shard], shardChange{change: i, hostname: fqHostname})
+		}
+	}
+
+	dropped := make([]int, len(changes))
+	for _, shard := range touched {
+		shard.mutex.Lock()
+		for _, sc := range byShard[shard] {
+			change := changes[sc.change]
+			var applied bool
+			if change.Remove {
+				applied = at.removeFromShard(shard, sc.hostname, change.IP, change.EndpointUpdatedAt, change.Metadata.Source)
+			} else {
+				applied = at.addToShard(shard, sc.hostname, change.IP, change.EndpointUpdatedAt, change.Metadata)
+			}
+			if !applied {
+				dropped[sc.change]++
+			}
+		}
+		shard.mutex.Unlock()
+		at.flushEvents(shard)
+	}
+	return dropped
+}
@@ -0,0 +1,100 @@
+package addresstable
+
+import "errors"
+
+type EventType string
+
+// A register that only keeps an existing entry alive publishes no event;
+// EventRefreshed is only published when it changes the entry's metadata.
+const (
+	EventAdded     EventType = "added"
+	EventRefreshed EventType = "refreshed"
+	EventRemoved   EventType = "removed"
+	EventPruned    EventType = "pruned"
+)
+
+const eventHistorySize = 10000
+
+var ErrRevisionUnavailable = errors.New("revision unavailable")
+
+type Event struct {
+	Revision uint64
+	Type     EventType
+	Hostname string
+	Endpoint Endpoint
+}
+
+func (at *AddressTable) Revision() uint64 {
+	at.eventsMutex.RLock()
+	revision := at.revision
+	at.eventsMutex.RUnlock()
+
+	return revision
+}
+
+// EventsSince returns the events after the given revision along with the
+// current revision. The returned channel is closed on the next change.
+func (at *AddressTable) EventsSince(revision uint64) ([]Event, uint64, <-chan struct{}, error) {
+	at.eventsMutex.RLock()
+	defer at.eventsMutex.RUnlock()
+
+	oldestRevision := at.revision - uint64(len(at.events))
+	if revision > at.revision || revision < oldestRevision {
+		return nil, at.revision, at.changed, ErrRevisionUnavailable
+	}
+
+	events := make([]Event, at.revision-revision)
+	copy(events, at.events[revision-oldestRevision:])
+
+	return events, at.revision, at.changed, nil
+}
+
+// publish queues an event while the lock of the shard being changed is held,
+// so the events for a hostname are queued in the order the changes were
+// applied. The queue is moved into the history by flushEvents once the shard
+// lock has been released, so that writers to different shards do not contend
+// on the events lock.
+func (s *shard) publish(eventType EventType, hostname string, e entry) {
+	s.pendingMutex.Lock()
+	s.pending = append(s.pending, Event{
+		Type:     eventType,
+		Hostname: hostname,
+		Endpoint: entriesToEndpoints([]entry{e})[0],
+	})
+	s.pendingMutex.Unlock()
+}
+
+// flushEvents only takes the events lock when the shard has events queued,
+// as it runs after every write and most writes only refresh an entry.
+func (at *AddressTable) flushEvents(shard *shard) {
+	shard.pendingMutex.Lock()
+	if len(shard.pending) == 0 {
+		shard.pendingMutex.Unlock()
+		return
+	}
+	shard.pendingMutex.Unlock()
+
+	at.eventsMutex.Lock()
+	defer at.eventsMutex.Unlock()
+
+	shard.pendingMutex.Lock()
+	pending := shard.pending
+	shard.pending = nil
+	shard.pendingMutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	for _, event := range pending {
+		at.revision++
+		event.Revision = at.revision
+		at.events = append(at.events, event)
+	}
+	if len(at.events) > eventHistorySize {
+		at.events = at.events[len(at.events)-eventHistorySize:]
+	}
+
+	close(at.changed)
+	at.changed = make(chan struct{})
+}
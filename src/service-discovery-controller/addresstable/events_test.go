@@ -0,0 +1,149 @@
+package addresstable_test
+
+import (
+	"fmt"
+	"service-discovery-controller/addresstable"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		table              *addresstable.AddressTable
+		fakeClock          *fakeclock.FakeClock
+		stalenessThreshold time.Duration
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		stalenessThreshold = 5 * time.Second
+		table = addresstable.NewAddressTable(stalenessThreshold, 1*time.Second, 0, fakeClock, lagertest.NewTestLogger("test"))
+	})
+
+	AfterEach(func() {
+		table.Shutdown()
+	})
+
+	eventTypes := func(events []addresstable.Event) []addresstable.EventType {
+		types := []addresstable.EventType{}
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	It("starts at revision zero with no events", func() {
+		Expect(table.Revision()).To(Equal(uint64(0)))
+
+		events, revision, _, err := table.EventsSince(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+		Expect(revision).To(Equal(uint64(0)))
+	})
+
+	It("publishes ordered events for adds, refreshes and removes", func() {
+		metadata := addresstable.Metadata{Port: 8080}
+		table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, metadata)
+		table.Add([]string{"foo.com"}, "192.0.0.1")
+		table.Remove([]string{"foo.com"}, "192.0.0.1")
+
+		events, revision, _, err := table.EventsSince(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revision).To(Equal(uint64(3)))
+		Expect(eventTypes(events)).To(Equal([]addresstable.EventType{
+			addresstable.EventAdded,
+			addresstable.EventRefreshed,
+			addresstable.EventRemoved,
+		}))
+		Expect(events[0]).To(Equal(addresstable.Event{
+			Revision: 1,
+			Type:     addresstable.EventAdded,
+			Hostname: "foo.com.",
+			Endpoint: addresstable.Endpoint{IP: "192.0.0.1", UpdateTime: fakeClock.Now(), Metadata: metadata},
+		}))
+		Expect(events[2].Revision).To(Equal(uint64(3)))
+	})
+
+	It("publishes nothing when a register only refreshes the update time", func() {
+		metadata := addresstable.Metadata{Port: 8080, Tags: map[string]string{"component": "api"}}
+		table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, metadata)
+		fakeClock.Increment(1 * time.Second)
+		table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 0, addresstable.Metadata{Port: 8080, Tags: map[string]string{"component": "api"}})
+
+		events, revision, _, err := table.EventsSince(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revision).To(Equal(uint64(1)))
+		Expect(eventTypes(events)).To(Equal([]addresstable.EventType{addresstable.EventAdded}))
+	})
+
+	It("does not close the returned channel on a refresh that changes nothing", func() {
+		table.Add([]string{"foo.com"}, "192.0.0.1")
+		_, _, changed, err := table.EventsSince(1)
+		Expect(err).NotTo(HaveOccurred())
+
+		table.Add([]string{"foo.com"}, "192.0.0.1")
+		Consistently(changed).ShouldNot(BeClosed())
+	})
+
+	It("returns only the events after the given revision", func() {
+		table.Add([]string{"foo.com"}, "192.0.0.1")
+		table.Add([]string{"bar.com"}, "192.0.0.2")
+
+		events, _, _, err := table.EventsSince(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Hostname).To(Equal("bar.com."))
+	})
+
+	It("publishes an event for each pruned entry", func() {
+		table.Add([]string{"foo.com", "bar.com"}, "192.0.0.1")
+		fakeClock.Increment(stalenessThreshold + 1*time.Second)
+
+		Eventually(table.Revision).Should(Equal(uint64(4)))
+
+		events, _, _, err := table.EventsSince(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(eventTypes(events)).To(Equal([]addresstable.EventType{
+			addresstable.EventPruned,
+			addresstable.EventPruned,
+		}))
+	})
+
+	It("closes the returned channel on the next change", func() {
+		_, _, changed, err := table.EventsSince(0)
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(changed).ShouldNot(BeClosed())
+
+		table.Add([]string{"foo.com"}, "192.0.0.1")
+		Eventually(changed).Should(BeClosed())
+	})
+
+	Context("when the revision is ahead of the table", func() {
+		It("returns an error", func() {
+			_, revision, _, err := table.EventsSince(42)
+			Expect(err).To(Equal(addresstable.ErrRevisionUnavailable))
+			Expect(revision).To(Equal(uint64(0)))
+		})
+	})
+
+	Context("when the revision is no longer in the history", func() {
+		BeforeEach(func() {
+			for i := 0; i < 10001; i++ {
+				table.Add([]string{fmt.Sprintf("foo-%d.com", i)}, "192.0.0.1")
+			}
+		})
+
+		It("returns an error", func() {
+			_, _, _, err := table.EventsSince(0)
+			Expect(err).To(Equal(addresstable.ErrRevisionUnavailable))
+
+			events, _, _, err := table.EventsSince(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(10000))
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package addresstable
+
+import (
+	"container/heap"
+	"time"
+)
+
+type expiryItem struct {
+	key        entryKey
+	updateTime time.Time
+	index      int
+}
+
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].updateTime.Before(h[j].updateTime) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// trackExpiry and untrackExpiry must be called while holding the shard's
+// write lock.
+func (s *shard) trackExpiry(key entryKey, updateTime time.Time) {
+	if item, ok := s.expiryItems[key]; ok {
+		item.updateTime = updateTime
+		heap.Fix(&s.expiries, item.index)
+		return
+	}
+
+	item := &expiryItem{key: key, updateTime: updateTime}
+	heap.Push(&s.expiries, item)
+	s.expiryItems[key] = item
+}
+
+func (s *shard) untrackExpiry(key entryKey) {
+	if item, ok := s.expiryItems[key]; ok {
+		heap.Remove(&s.expiries, item.index)
+		delete(s.expiryItems, key)
+	}
+}
+
+// expiredEntries walks only the part of the heap that has expired, since an
+// entry that has not expired has no expired descendants.
+func (s *shard) expiredEntries(isStale func(time.Time) bool) []expiryItem {
+	expired := []expiryItem{}
+	pending := []int{0}
+	for len(pending) > 0 {
+		index := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if index >= len(s.expiries) || !isStale(s.expiries[index].updateTime) {
+			continue
+		}
+		expired = append(expired, *s.expiries[index])
+		pending = append(pending, 2*index+1, 2*index+2)
+	}
+	return expired
+}
@@ -0,0 +1,109 @@
+package addresstable
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	benchmarkHostnames          = 10000
+	benchmarkEntriesPerHostname = 10
+	benchmarkExpiredPerCycle    = 100
+)
+
+type benchmarkEntry struct {
+	hostname string
+	ip       string
+}
+
+// newBenchmarkTable spreads the update times evenly over the staleness
+// threshold, so advancing the clock by one step expires one entry.
+func newBenchmarkTable() (*AddressTable, *fakeclock.FakeClock, time.Duration, []benchmarkEntry) {
+	fakeClock := fakeclock.NewFakeClock(time.Now())
+	stalenessThreshold := time.Minute
+	table := NewAddressTable(stalenessThreshold, time.Hour, 0, fakeClock, lager.NewLogger("benchmark"))
+
+	entries := []benchmarkEntry{}
+	for e := 0; e < benchmarkEntriesPerHostname; e++ {
+		for h := 0; h < benchmarkHostnames; h++ {
+			entries = append(entries, benchmarkEntry{
+				hostname: fmt.Sprintf("app-%d.apps.internal", h),
+				ip:       fmt.Sprintf("10.0.%d.%d", e/256, e%256),
+			})
+		}
+	}
+
+	step := stalenessThreshold / time.Duration(len(entries))
+	for _, entry := range entries {
+		fakeClock.Increment(step)
+		table.Add([]string{entry.hostname}, entry.ip)
+	}
+	return table, fakeClock, step, entries
+}
+
+func BenchmarkPruneWithNothingExpired(b *testing.B) {
+	table, _, _, _ := newBenchmarkTable()
+	defer table.Shutdown()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.pruneStaleEntries()
+	}
+}
+
+// BenchmarkPruneWithFewExpired expires, prunes and re-registers a small
+// batch of entries on each cycle.
+func BenchmarkPruneWithFewExpired(b *testing.B) {
+	table, fakeClock, step, entries := newBenchmarkTable()
+	defer table.Shutdown()
+
+	oldest := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fakeClock.Increment(benchmarkExpiredPerCycle * step)
+		table.pruneStaleEntries()
+
+		for _, entry := range entries[oldest : oldest+benchmarkExpiredPerCycle] {
+			table.Add([]string{entry.hostname}, entry.ip)
+		}
+		oldest = (oldest + benchmarkExpiredPerCycle) % len(entries)
+	}
+}
+
+func BenchmarkLookupWhilePruning(b *testing.B) {
+	table, _, _, entries := newBenchmarkTable()
+	defer table.Shutdown()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				table.pruneStaleEntries()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			table.Lookup(entries[i%len(entries)].hostname)
+			i++
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,60 @@
+package addresstable
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const shardCount = 64
+
+type shard struct {
+	mutex        sync.RWMutex
+	addresses    map[string][]entry
+	tombstones   map[entryKey]tombstone
+	vacated      map[string]time.Time
+	expiries     expiryHeap
+	expiryItems  map[entryKey]*expiryItem
+	pending      []Event
+	pendingMutex sync.Mutex
+}
+
+func newShards() []*shard {
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{
+			addresses:   map[string][]entry{},
+			tombstones:  map[entryKey]tombstone{},
+			vacated:     map[string]time.Time{},
+			expiryItems: map[entryKey]*expiryItem{},
+		}
+	}
+	return shards
+}
+
+func (at *AddressTable) shardFor(hostname string) *shard {
+	hash := fnv.New32a()
+	hash.Write([]byte(hostname))
+	return at.shards[hash.Sum32()%uint32(len(at.shards))]
+}
+
+func (s *shard) entriesForHostname(hostname string) []entry {
+	if existing, ok := s.addresses[hostname]; ok {
+		return existing
+	} else {
+		return []entry{}
+	}
+}
+
+// removeEntry remembers when a hostname lost its last entry, so that it is
+// still known while its app is scaled to zero.
+func (s *shard) removeEntry(key entryKey, index int, now time.Time) {
+	entries := s.addresses[key.hostname]
+	if len(entries) == 1 {
+		delete(s.addresses, key.hostname)
+		s.vacated[key.hostname] = now
+	} else {
+		s.addresses[key.hostname] = append(entries[:index], entries[index+1:]...)
+	}
+	s.untrackExpiry(key)
+}
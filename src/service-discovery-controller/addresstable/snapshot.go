@@ -0,0 +1,275 @@
+package addresstable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const snapshotVersion = 1
+
+type snapshotFile struct {
+	Version     int             `json:"version"`
+	WrittenAtNS int64           `json:"written_at_ns,omitempty"`
+	Checksum    string          `json:"checksum"`
+	Addresses   json.RawMessage `json:"addresses"`
+}
+
+type snapshotAddress struct {
+	Hostname string          `json:"hostname"`
+	Entries  []snapshotEntry `json:"entries"`
+}
+
+type snapshotEntry struct {
+	IP                  string            `json:"ip"`
+	UpdatedAtNS         int64             `json:"updated_at_ns"`
+	EndpointUpdatedAtNS int64             `json:"endpoint_updated_at_ns,omitempty"`
+	Port                uint16            `json:"port,omitempty"`
+	AppGUID             string            `json:"app_guid,omitempty"`
+	ProcessGUID         string            `json:"process_guid,omitempty"`
+	InstanceIndex       string            `json:"instance_index,omitempty"`
+	AvailabilityZone    string            `json:"availability_zone,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"`
+	Source              string            `json:"source,omitempty"`
+	Sources             []string          `json:"sources,omitempty"`
+}
+
+// MarshalSnapshot encodes the table, including when each entry was last
+// updated and when the snapshot was taken, in the format WriteSnapshot writes
+// to disk.
+func (at *AddressTable) MarshalSnapshot() ([]byte, error) {
+	addresses := []snapshotAddress{}
+	for _, shard := range at.shards {
+		shard.mutex.RLock()
+		for hostname, entries := range shard.addresses {
+			snapshotEntries := make([]snapshotEntry, len(entries))
+			for i, entry := range entries {
+				snapshotEntries[i] = snapshotEntry{
+					IP:                  entry.ip,
+					UpdatedAtNS:         entry.updateTime.UnixNano(),
+					EndpointUpdatedAtNS: entry.endpointUpdatedAt,
+					Port:                entry.metadata.Port,
+					AppGUID:             entry.metadata.AppGUID,
+					ProcessGUID:         entry.metadata.ProcessGUID,
+					InstanceIndex:       entry.metadata.InstanceIndex,
+					AvailabilityZone:    entry.metadata.AvailabilityZone,
+					Tags:                entry.metadata.Tags,
+					Source:              entry.metadata.Source,
+					Sources:             entry.sources,
+				}
+			}
+			addresses = append(addresses, snapshotAddress{Hostname: hostname, Entries: snapshotEntries})
+		}
+		shard.mutex.RUnlock()
+	}
+
+	addressesJSON, err := json.Marshal(addresses)
+	if err != nil {
+		return nil, fmt.Errorf("marshal snapshot addresses: %s", err) // not tested
+	}
+
+	snapshotJSON, err := json.Marshal(snapshotFile{
+		Version:     snapshotVersion,
+		WrittenAtNS: at.clock.Now().UnixNano(),
+		Checksum:    checksum(addressesJSON),
+		Addresses:   addressesJSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal snapshot: %s", err) // not tested
+	}
+
+	return snapshotJSON, nil
+}
+
+func (at *AddressTable) WriteSnapshot(path string) error {
+	snapshotJSON, err := at.MarshalSnapshot()
+	if err != nil {
+		return err // not tested
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("create snapshot file: %s", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(snapshotJSON)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write snapshot file: %s", err)
+	}
+
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		return fmt.Errorf("rename snapshot file: %s", err)
+	}
+
+	return nil
+}
+
+func (at *AddressTable) LoadSnapshot(path string) (int, error) {
+	snapshotJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read snapshot file: %s", err)
+	}
+
+	return at.restoreSnapshot(snapshotJSON, false)
+}
+
+// RestoreSnapshot merges the snapshot of a peer into the table. Entries are
+// ordered by their endpoint update time rather than by when either table last
+// saw them, as the peer may have a different clock: entries that the table
+// has seen the same or a newer update or unregister for are skipped. For the
+// same reason, how long ago the peer last saw each entry is carried over onto
+// the local clock, taking the snapshot to have just been taken. It returns how
+// many entries were applied.
+func (at *AddressTable) RestoreSnapshot(snapshotJSON []byte) (int, error) {
+	return at.restoreSnapshot(snapshotJSON, true)
+}
+
+func (at *AddressTable) restoreSnapshot(snapshotJSON []byte, rebase bool) (int, error) {
+	var snapshot snapshotFile
+	err := json.Unmarshal(snapshotJSON, &snapshot)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal snapshot: %s", err)
+	}
+
+	if snapshot.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version: %d", snapshot.Version)
+	}
+
+	if checksum(snapshot.Addresses) != snapshot.Checksum {
+		return 0, fmt.Errorf("snapshot checksum mismatch")
+	}
+
+	var addresses []snapshotAddress
+	err = json.Unmarshal(snapshot.Addresses, &addresses)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal snapshot addresses: %s", err)
+	}
+
+	var clockOffset time.Duration
+	if rebase && snapshot.WrittenAtNS != 0 {
+		clockOffset = at.clock.Now().Sub(time.Unix(0, snapshot.WrittenAtNS))
+	}
+
+	var loaded int
+	for _, address := range addresses {
+		fqHostname := fqdn(address.Hostname)
+		shard := at.shardFor(fqHostname)
+		shard.mutex.Lock()
+		for _, snapshotEntry := range address.Entries {
+			updateTime := time.Unix(0, snapshotEntry.UpdatedAtNS).Add(clockOffset)
+			metadata := Metadata{
+				Port:             snapshotEntry.Port,
+				AppGUID:          snapshotEntry.AppGUID,
+				ProcessGUID:      snapshotEntry.ProcessGUID,
+				InstanceIndex:    snapshotEntry.InstanceIndex,
+				AvailabilityZone: snapshotEntry.AvailabilityZone,
+				Tags:             snapshotEntry.Tags,
+				Source:           snapshotEntry.Source,
+			}
+			sources := snapshotEntry.Sources
+			if len(sources) == 0 {
+				sources = []string{snapshotEntry.Source}
+			}
+			key := entryKey{hostname: fqHostname, ip: snapshotEntry.IP}
+			if removed, ok := shard.tombstones[key]; ok && removed.supersedes(snapshotEntry.EndpointUpdatedAtNS) {
+				continue
+			}
+			entries := shard.entriesForHostname(fqHostname)
+			entryIndex := indexOf(entries, snapshotEntry.IP)
+			if entryIndex == -1 {
+				newEntry := entry{ip: snapshotEntry.IP, updateTime: updateTime, endpointUpdatedAt: snapshotEntry.EndpointUpdatedAtNS, metadata: metadata, sources: sources}
+				shard.addresses[fqHostname] = append(entries, newEntry)
+				shard.trackExpiry(key, updateTime)
+				at.indexIP(snapshotEntry.IP, fqHostname)
+				shard.publish(EventAdded, fqHostname, newEntry)
+			} else if existing := &entries[entryIndex]; snapshotEntry.EndpointUpdatedAtNS > existing.endpointUpdatedAt {
+				metadataChanged := !existing.metadata.equal(metadata)
+				existing.endpointUpdatedAt = snapshotEntry.EndpointUpdatedAtNS
+				existing.metadata = metadata
+				for _, source := range sources {
+					existing.sources = withSource(existing.sources, source)
+				}
+				if existing.updateTime.Before(updateTime) {
+					existing.updateTime = updateTime
+					shard.trackExpiry(key, updateTime)
+				}
+				if metadataChanged {
+					shard.publish(EventRefreshed, fqHostname, *existing)
+				}
+			} else {
+				continue
+			}
+			loaded++
+		}
+		shard.mutex.Unlock()
+		at.flushEvents(shard)
+	}
+
+	return loaded, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type SnapshotWriter struct {
+	table    *AddressTable
+	path     string
+	interval time.Duration
+	clock    clock.Clock
+	logger   lager.Logger
+}
+
+func NewSnapshotWriter(table *AddressTable, path string, interval time.Duration, clock clock.Clock, logger lager.Logger) *SnapshotWriter {
+	return &SnapshotWriter{
+		table:    table,
+		path:     path,
+		interval: interval,
+		clock:    clock,
+		logger:   logger,
+	}
+}
+
+func (w *SnapshotWriter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := w.clock.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			w.write()
+		case <-signals:
+			w.write()
+			return nil
+		}
+	}
+}
+
+func (w *SnapshotWriter) write() {
+	err := w.table.WriteSnapshot(w.path)
+	if err != nil {
+		w.logger.Error("snapshot-write-failed", err, lager.Data{"path": w.path})
+		return
+	}
+	w.logger.Debug("snapshot-written", lager.Data{"path": w.path})
+}
@@ -0,0 +1,351 @@
+package addresstable_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"service-discovery-controller/addresstable"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Snapshot", func() {
+	var (
+		table              *addresstable.AddressTable
+		restoredTable      *addresstable.AddressTable
+		fakeClock          *fakeclock.FakeClock
+		stalenessThreshold time.Duration
+		pruningInterval    time.Duration
+		logger             *lagertest.TestLogger
+		snapshotDir        string
+		snapshotPath       string
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		stalenessThreshold = 5 * time.Second
+		pruningInterval = 1 * time.Second
+		logger = lagertest.NewTestLogger("test")
+		table = addresstable.NewAddressTable(stalenessThreshold, pruningInterval, 0, fakeClock, logger)
+		restoredTable = addresstable.NewAddressTable(stalenessThreshold, pruningInterval, 0, fakeClock, logger)
+
+		var err error
+		snapshotDir, err = ioutil.TempDir("", "snapshot")
+		Expect(err).NotTo(HaveOccurred())
+		snapshotPath = filepath.Join(snapshotDir, "address-table.json")
+	})
+
+	AfterEach(func() {
+		table.Shutdown()
+		restoredTable.Shutdown()
+		os.RemoveAll(snapshotDir)
+	})
+
+	Describe("WriteSnapshot and LoadSnapshot", func() {
+		BeforeEach(func() {
+			table.Add([]string{"foo.com"}, "192.0.0.1")
+			table.Add([]string{"foo.com"}, "192.0.0.2")
+			table.Add([]string{"bar.com"}, "192.0.0.3")
+		})
+
+		It("restores the addresses into another table", func() {
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+			loaded, err := restoredTable.LoadSnapshot(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(3))
+
+			Expect(restoredTable.Lookup("foo.com")).To(ConsistOf("192.0.0.1", "192.0.0.2"))
+			Expect(restoredTable.Lookup("bar.com")).To(ConsistOf("192.0.0.3"))
+			Expect(restoredTable.LookupHostnames("192.0.0.3")).To(Equal([]string{"bar.com."}))
+		})
+
+		It("restores the endpoint metadata", func() {
+			metadata := addresstable.Metadata{
+				Port:             8080,
+				AppGUID:          "some-app-guid",
+				ProcessGUID:      "some-process-guid",
+				InstanceIndex:    "1",
+				AvailabilityZone: "z1",
+				Tags:             map[string]string{"component": "api"},
+				Source:           "nats",
+			}
+			table.AddWithMetadata([]string{"baz.com"}, "192.0.0.4", 0, metadata)
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+			_, err := restoredTable.LoadSnapshot(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			endpoints := restoredTable.LookupEndpoints("baz.com")
+			Expect(endpoints).To(HaveLen(1))
+			Expect(endpoints[0].Metadata).To(Equal(metadata))
+		})
+
+		It("restores which route sources registered each entry", func() {
+			table.Apply([]addresstable.Change{
+				{Hostnames: []string{"baz.com"}, IP: "192.0.0.4", Metadata: addresstable.Metadata{Source: "nats"}},
+				{Hostnames: []string{"baz.com"}, IP: "192.0.0.4", Metadata: addresstable.Metadata{Source: "file"}},
+			})
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+			_, err := restoredTable.LoadSnapshot(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			restoredTable.Apply([]addresstable.Change{
+				{Remove: true, Hostnames: []string{"baz.com"}, IP: "192.0.0.4", Metadata: addresstable.Metadata{Source: "file"}},
+			})
+			Expect(restoredTable.Lookup("baz.com")).To(Equal([]string{"192.0.0.4"}))
+		})
+
+		It("writes a versioned and checksummed file", func() {
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			var snapshot map[string]interface{}
+			Expect(json.Unmarshal(contents, &snapshot)).To(Succeed())
+			Expect(snapshot).To(HaveKeyWithValue("version", BeEquivalentTo(1)))
+			Expect(snapshot).To(HaveKeyWithValue("checksum", HaveLen(64)))
+			Expect(snapshot).To(HaveKey("addresses"))
+		})
+
+		It("keeps the update times so stale entries are still pruned", func() {
+			fakeClock.Increment(stalenessThreshold - 1*time.Second)
+			table.Add([]string{"bar.com"}, "192.0.0.3")
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+			_, err := restoredTable.LoadSnapshot(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock.Increment(2 * time.Second)
+
+			Eventually(func() []string { return restoredTable.Lookup("foo.com") }).Should(BeEmpty())
+			Consistently(func() []string { return restoredTable.Lookup("bar.com") }).Should(ConsistOf("192.0.0.3"))
+		})
+
+		Context("when the snapshot has been tampered with", func() {
+			BeforeEach(func() {
+				Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+
+				contents, err := ioutil.ReadFile(snapshotPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				var snapshot map[string]interface{}
+				Expect(json.Unmarshal(contents, &snapshot)).To(Succeed())
+				snapshot["addresses"] = []interface{}{}
+				contents, err = json.Marshal(snapshot)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(snapshotPath, contents, 0600)).To(Succeed())
+			})
+
+			It("returns an error and loads nothing", func() {
+				_, err := restoredTable.LoadSnapshot(snapshotPath)
+				Expect(err).To(MatchError("snapshot checksum mismatch"))
+				Expect(restoredTable.GetAllAddresses()).To(BeEmpty())
+			})
+		})
+
+		Context("when the snapshot version is not supported", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(snapshotPath, []byte(`{"version": 42, "checksum": "", "addresses": []}`), 0600)).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				_, err := restoredTable.LoadSnapshot(snapshotPath)
+				Expect(err).To(MatchError("unsupported snapshot version: 42"))
+			})
+		})
+
+		Context("when the snapshot file does not exist", func() {
+			It("returns an error", func() {
+				_, err := restoredTable.LoadSnapshot(filepath.Join(snapshotDir, "missing.json"))
+				Expect(err).To(MatchError(ContainSubstring("read snapshot file")))
+			})
+		})
+
+		Context("when the snapshot file is garbage", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(snapshotPath, []byte(`garbage`), 0600)).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				_, err := restoredTable.LoadSnapshot(snapshotPath)
+				Expect(err).To(MatchError(ContainSubstring("unmarshal snapshot")))
+			})
+		})
+	})
+
+	Describe("MarshalSnapshot and RestoreSnapshot", func() {
+		var snapshotJSON []byte
+
+		BeforeEach(func() {
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 1, addresstable.Metadata{})
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.2", 1, addresstable.Metadata{})
+
+			var err error
+			snapshotJSON, err = table.MarshalSnapshot()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("restores the addresses into another table", func() {
+			loaded, err := restoredTable.RestoreSnapshot(snapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(2))
+
+			Expect(restoredTable.Lookup("foo.com")).To(ConsistOf("192.0.0.1", "192.0.0.2"))
+		})
+
+		It("does not overwrite entries that have been updated since", func() {
+			fakeClock.Increment(time.Second)
+			metadata := addresstable.Metadata{Port: 8080}
+			restoredTable.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 2, metadata)
+
+			loaded, err := restoredTable.RestoreSnapshot(snapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(1))
+
+			endpoints := restoredTable.LookupEndpoints("foo.com")
+			Expect(endpoints).To(HaveLen(2))
+			for _, endpoint := range endpoints {
+				if endpoint.IP == "192.0.0.1" {
+					Expect(endpoint.Metadata).To(Equal(metadata))
+				}
+			}
+		})
+
+		It("does not overwrite entries that have been updated since but were refreshed later by the peer", func() {
+			metadata := addresstable.Metadata{Port: 8080}
+			restoredTable.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 2, metadata)
+
+			fakeClock.Increment(time.Second)
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 1, addresstable.Metadata{})
+			snapshotJSON, err := table.MarshalSnapshot()
+			Expect(err).NotTo(HaveOccurred())
+
+			loaded, err := restoredTable.RestoreSnapshot(snapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(1))
+
+			endpoints := restoredTable.LookupEndpoints("foo.com")
+			Expect(endpoints).To(HaveLen(2))
+			for _, endpoint := range endpoints {
+				if endpoint.IP == "192.0.0.1" {
+					Expect(endpoint.Metadata).To(Equal(metadata))
+					Expect(endpoint.UpdateTime).To(BeTemporally("==", fakeClock.Now().Add(-time.Second)))
+				}
+			}
+		})
+
+		It("overwrites entries that the snapshot has a newer update for", func() {
+			restoredTable.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 2, addresstable.Metadata{Port: 8080})
+
+			fakeClock.Increment(time.Second)
+			metadata := addresstable.Metadata{Port: 9090}
+			table.AddWithMetadata([]string{"foo.com"}, "192.0.0.1", 3, metadata)
+			snapshotJSON, err := table.MarshalSnapshot()
+			Expect(err).NotTo(HaveOccurred())
+
+			loaded, err := restoredTable.RestoreSnapshot(snapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(2))
+
+			endpoints := restoredTable.LookupEndpoints("foo.com")
+			Expect(endpoints).To(HaveLen(2))
+			for _, endpoint := range endpoints {
+				if endpoint.IP == "192.0.0.1" {
+					Expect(endpoint.Metadata).To(Equal(metadata))
+					Expect(endpoint.UpdateTime).To(BeTemporally("==", fakeClock.Now()))
+				}
+			}
+		})
+
+		It("carries over how long ago the peer saw each entry onto the local clock", func() {
+			peerClock := fakeclock.NewFakeClock(fakeClock.Now().Add(time.Hour))
+			peerTable := addresstable.NewAddressTable(stalenessThreshold, pruningInterval, 0, peerClock, logger)
+			defer peerTable.Shutdown()
+			peerTable.AddWithMetadata([]string{"bar.com"}, "192.0.0.3", 1, addresstable.Metadata{})
+			peerClock.Increment(2 * time.Second)
+
+			peerSnapshotJSON, err := peerTable.MarshalSnapshot()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = restoredTable.RestoreSnapshot(peerSnapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+
+			endpoints := restoredTable.LookupEndpoints("bar.com")
+			Expect(endpoints).To(HaveLen(1))
+			Expect(endpoints[0].UpdateTime).To(BeTemporally("==", fakeClock.Now().Add(-2*time.Second)))
+
+			fakeClock.Increment(stalenessThreshold - time.Second)
+			Eventually(func() []string { return restoredTable.Lookup("bar.com") }).Should(BeEmpty())
+		})
+
+		It("does not restore entries that have been unregistered since", func() {
+			restoredTable.RemoveWithUpdatedAt([]string{"foo.com"}, "192.0.0.2", 2)
+
+			loaded, err := restoredTable.RestoreSnapshot(snapshotJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(1))
+
+			Expect(restoredTable.Lookup("foo.com")).To(ConsistOf("192.0.0.1"))
+		})
+
+		Context("when the snapshot is garbage", func() {
+			It("returns an error", func() {
+				_, err := restoredTable.RestoreSnapshot([]byte("garbage"))
+				Expect(err).To(MatchError(ContainSubstring("unmarshal snapshot")))
+			})
+		})
+	})
+
+	Describe("SnapshotWriter", func() {
+		var (
+			writer      *addresstable.SnapshotWriter
+			writerClock *fakeclock.FakeClock
+			process     ifrit.Process
+		)
+
+		BeforeEach(func() {
+			table.Add([]string{"foo.com"}, "192.0.0.1")
+			writerClock = fakeclock.NewFakeClock(time.Now())
+			writer = addresstable.NewSnapshotWriter(table, snapshotPath, 10*time.Second, writerClock, logger)
+			process = ifrit.Invoke(writer)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("writes a snapshot on every interval", func() {
+			Consistently(func() bool {
+				_, err := os.Stat(snapshotPath)
+				return err == nil
+			}).Should(BeFalse())
+
+			writerClock.WaitForWatcherAndIncrement(10 * time.Second)
+
+			Eventually(func() error {
+				_, err := restoredTable.LoadSnapshot(snapshotPath)
+				return err
+			}).Should(Succeed())
+			Expect(restoredTable.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+		})
+
+		It("writes a final snapshot when signaled", func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+
+			_, err := restoredTable.LoadSnapshot(snapshotPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoredTable.Lookup("foo.com")).To(Equal([]string{"192.0.0.1"}))
+		})
+	})
+})
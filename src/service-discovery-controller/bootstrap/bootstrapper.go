@@ -0,0 +1,157 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o fakes/address_table.go --fake-name AddressTable . AddressTable
+type AddressTable interface {
+	RestoreSnapshot(snapshotJSON []byte) (int, error)
+	SetWarm()
+}
+
+// Bootstrapper fills the address table from the snapshot of a running peer
+// once the route sources have started, so that a new instance does not have
+// to wait for every route to be registered again. Routes that the sources
+// have registered since are kept where they are newer than the snapshot. It
+// tries each peer in turn until one of them serves its snapshot or the
+// timeout passes. The table is declared warm when a snapshot is restored;
+// otherwise it warms up as if there had been no bootstrap. Done is closed once
+// it has either restored a snapshot or given up.
+type Bootstrapper struct {
+	done          chan struct{}
+	peers         []string
+	client        *http.Client
+	table         AddressTable
+	timeout       time.Duration
+	retryInterval time.Duration
+	clock         clock.Clock
+	logger        lager.Logger
+}
+
+func NewBootstrapper(
+	peers []string,
+	client *http.Client,
+	table AddressTable,
+	timeout time.Duration,
+	retryInterval time.Duration,
+	clock clock.Clock,
+	logger lager.Logger,
+) *Bootstrapper {
+	return &Bootstrapper{
+		done:          make(chan struct{}),
+		peers:         peers,
+		client:        client,
+		table:         table,
+		timeout:       timeout,
+		retryInterval: retryInterval,
+		clock:         clock,
+		logger:        logger,
+	}
+}
+
+// NewClient builds the client that fetches the snapshot from peers. It
+// presents the given certificate, as peers only serve their snapshot over
+// mutual TLS.
+func NewClient(caPath, clientCertPath, clientKeyPath, serverName string, timeout time.Duration) (*http.Client, error) {
+	caPemBytes, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("read bootstrap CA file: %s", err)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caPemBytes) {
+		return nil, fmt.Errorf("load bootstrap CA file into cert pool")
+	}
+
+	cert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load bootstrap client key pair: %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      caCertPool,
+		ServerName:   serverName,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+func (b *Bootstrapper) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *Bootstrapper) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	deadline := b.clock.Now().Add(b.timeout)
+	for !b.bootstrapFromPeers() {
+		remaining := deadline.Sub(b.clock.Now())
+		if remaining <= 0 {
+			b.logger.Info("bootstrap-timed-out", lager.Data{"timeout": b.timeout.String()})
+			break
+		}
+
+		wait := b.retryInterval
+		if remaining < wait {
+			wait = remaining
+		}
+
+		select {
+		case <-b.clock.After(wait):
+		case <-signals:
+			return nil
+		}
+	}
+
+	close(b.done)
+	close(ready)
+	<-signals
+	return nil
+}
+
+func (b *Bootstrapper) bootstrapFromPeers() bool {
+	for _, peer := range b.peers {
+		loaded, err := b.bootstrapFrom(peer)
+		if err != nil {
+			b.logger.Info("bootstrap-from-peer-failed", lager.Data{"peer": peer, "reason": err.Error()})
+			continue
+		}
+
+		b.table.SetWarm()
+		b.logger.Info("bootstrap-succeeded", lager.Data{"peer": peer, "entries": loaded})
+		return true
+	}
+	return false
+}
+
+func (b *Bootstrapper) bootstrapFrom(peer string) (int, error) {
+	resp, err := b.client.Get(strings.TrimSuffix(peer, "/") + "/v1/snapshot")
+	if err != nil {
+		return 0, fmt.Errorf("get snapshot: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("get snapshot: unexpected status %d", resp.StatusCode)
+	}
+
+	snapshotJSON, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("read snapshot: %s", err)
+	}
+
+	return b.table.RestoreSnapshot(snapshotJSON)
+}
@@ -0,0 +1,164 @@
+package bootstrap_test
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	. "service-discovery-controller/bootstrap"
+	"service-discovery-controller/bootstrap/fakes"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Bootstrapper", func() {
+	var (
+		firstPeer     *ghttp.Server
+		secondPeer    *ghttp.Server
+		addressTable  *fakes.AddressTable
+		fakeClock     *fakeclock.FakeClock
+		logger        *lagertest.TestLogger
+		timeout       time.Duration
+		retryInterval time.Duration
+		bootstrapper  *Bootstrapper
+		process       ifrit.Process
+	)
+
+	BeforeEach(func() {
+		firstPeer = ghttp.NewServer()
+		secondPeer = ghttp.NewServer()
+		firstPeer.SetAllowUnhandledRequests(true)
+		firstPeer.SetUnhandledRequestStatusCode(http.StatusServiceUnavailable)
+		secondPeer.SetAllowUnhandledRequests(true)
+		secondPeer.SetUnhandledRequestStatusCode(http.StatusServiceUnavailable)
+
+		addressTable = &fakes.AddressTable{}
+		addressTable.RestoreSnapshotReturns(3, nil)
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+		timeout = 10 * time.Second
+		retryInterval = 3 * time.Second
+	})
+
+	JustBeforeEach(func() {
+		bootstrapper = NewBootstrapper(
+			[]string{firstPeer.URL(), secondPeer.URL() + "/"},
+			http.DefaultClient,
+			addressTable,
+			timeout,
+			retryInterval,
+			fakeClock,
+			logger,
+		)
+		process = ifrit.Background(bootstrapper)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		firstPeer.Close()
+		secondPeer.Close()
+	})
+
+	Context("when the first peer serves its snapshot", func() {
+		BeforeEach(func() {
+			firstPeer.RouteToHandler("GET", "/v1/snapshot", ghttp.RespondWith(http.StatusOK, `{"version": 1}`))
+		})
+
+		It("restores the snapshot, declares the table warm and becomes ready", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+			Expect(bootstrapper.Done()).To(BeClosed())
+
+			Expect(addressTable.RestoreSnapshotCallCount()).To(Equal(1))
+			Expect(addressTable.RestoreSnapshotArgsForCall(0)).To(MatchJSON(`{"version": 1}`))
+			Expect(addressTable.SetWarmCallCount()).To(Equal(1))
+			Expect(secondPeer.ReceivedRequests()).To(BeEmpty())
+			Expect(logger).To(gbytes.Say("bootstrap-succeeded.*\"entries\":3"))
+		})
+	})
+
+	Context("when the first peer is not warm", func() {
+		BeforeEach(func() {
+			secondPeer.RouteToHandler("GET", "/v1/snapshot", ghttp.RespondWith(http.StatusOK, `{"version": 1}`))
+		})
+
+		It("bootstraps from the next peer", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+
+			Expect(firstPeer.ReceivedRequests()).To(HaveLen(1))
+			Expect(secondPeer.ReceivedRequests()).To(HaveLen(1))
+			Expect(addressTable.SetWarmCallCount()).To(Equal(1))
+			Expect(logger).To(gbytes.Say("bootstrap-from-peer-failed.*unexpected status 503"))
+		})
+	})
+
+	Context("when the snapshot of a peer cannot be restored", func() {
+		BeforeEach(func() {
+			firstPeer.RouteToHandler("GET", "/v1/snapshot", ghttp.RespondWith(http.StatusOK, `garbage`))
+			secondPeer.RouteToHandler("GET", "/v1/snapshot", ghttp.RespondWith(http.StatusOK, `{"version": 1}`))
+			addressTable.RestoreSnapshotReturnsOnCall(0, 0, errors.New("unmarshal snapshot: potato"))
+		})
+
+		It("bootstraps from the next peer", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+
+			Expect(addressTable.RestoreSnapshotCallCount()).To(Equal(2))
+			Expect(addressTable.SetWarmCallCount()).To(Equal(1))
+			Expect(logger).To(gbytes.Say("bootstrap-from-peer-failed.*unmarshal snapshot: potato"))
+		})
+	})
+
+	Context("when no peer serves its snapshot", func() {
+		It("retries every retry interval", func() {
+			Eventually(firstPeer.ReceivedRequests).Should(HaveLen(1))
+			Eventually(secondPeer.ReceivedRequests).Should(HaveLen(1))
+			Consistently(process.Ready()).ShouldNot(BeClosed())
+
+			secondPeer.RouteToHandler("GET", "/v1/snapshot", ghttp.RespondWith(http.StatusOK, `{"version": 1}`))
+			fakeClock.WaitForWatcherAndIncrement(retryInterval)
+
+			Eventually(process.Ready()).Should(BeClosed())
+			Expect(secondPeer.ReceivedRequests()).To(HaveLen(2))
+			Expect(addressTable.SetWarmCallCount()).To(Equal(1))
+		})
+
+		It("becomes ready without declaring the table warm once the timeout passes", func() {
+			fakeClock.WaitForWatcherAndIncrement(retryInterval)
+			fakeClock.WaitForWatcherAndIncrement(retryInterval)
+			fakeClock.WaitForWatcherAndIncrement(retryInterval)
+			Consistently(process.Ready()).ShouldNot(BeClosed())
+			Expect(bootstrapper.Done()).NotTo(BeClosed())
+
+			fakeClock.WaitForWatcherAndIncrement(timeout - 3*retryInterval)
+
+			Eventually(process.Ready()).Should(BeClosed())
+			Expect(bootstrapper.Done()).To(BeClosed())
+			Expect(firstPeer.ReceivedRequests()).To(HaveLen(5))
+			Expect(addressTable.SetWarmCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("bootstrap-timed-out"))
+		})
+
+		It("exits when signaled", func() {
+			Eventually(secondPeer.ReceivedRequests).Should(HaveLen(1))
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(process.Ready()).NotTo(BeClosed())
+		})
+	})
+})
+
+var _ = Describe("NewClient", func() {
+	Context("when the CA file does not exist", func() {
+		It("returns an error", func() {
+			_, err := NewClient("/does/not/exist", "", "", "", time.Second)
+			Expect(err).To(MatchError(ContainSubstring("read bootstrap CA file")))
+		})
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"gopkg.in/validator.v2"
 )
@@ -24,6 +25,19 @@ type Config struct {
 	MetricsEmitSeconds        int          `json:"metrics_emit_seconds" validate:"min=1"`
 	ResumePruningDelaySeconds int          `json:"resume_pruning_delay_seconds" validate:"min=0"`
 	WarmDurationSeconds       int          `json:"warm_duration_seconds" validate:"min=0"`
+	SnapshotPath              string       `json:"snapshot_path"`
+	SnapshotIntervalSeconds   int          `json:"snapshot_interval_seconds" validate:"min=0"`
+	MaxPrunePercent           int          `json:"max_prune_percent" validate:"min=0,max=100"`
+	MaxPruneCount             int          `json:"max_prune_count" validate:"min=0"`
+	InternalDomains           []string     `json:"internal_domains"`
+
+	NatsTLS NatsTLSConfig `json:"nats_tls"`
+
+	StaticRoutesPath           string         `json:"static_routes_path"`
+	StaticRoutesRefreshSeconds int            `json:"static_routes_refresh_seconds" validate:"min=0"`
+	RouteAPI                   RouteAPIConfig `json:"route_api"`
+
+	Bootstrap BootstrapConfig `json:"bootstrap"`
 }
 
 type NatsConfig struct {
@@ -33,6 +47,40 @@ type NatsConfig struct {
 	Pass string `json:"pass"`
 }
 
+// NatsTLSConfig configures encrypted connections to the NATS servers. The
+// client certificate is optional and only used when the servers ask for one.
+type NatsTLSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	ServerName string `json:"server_name"`
+}
+
+// RouteAPIConfig configures the HTTPS API that routes can be pushed to.
+// Clients must present a certificate signed by CACert and send bodies of no
+// more than MaxBodyBytes.
+type RouteAPIConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Address      string `json:"address"`
+	Port         int    `json:"port"`
+	CACert       string `json:"ca_cert"`
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+}
+
+// BootstrapConfig configures restoring the address table from a peer on
+// start. Peers are the base URLs of the other instances, which are asked for
+// their snapshot in turn until one serves it or TimeoutSeconds passes.
+type BootstrapConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Peers          []string `json:"peers"`
+	CACert         string   `json:"ca_cert"`
+	ClientCert     string   `json:"client_cert"`
+	ClientKey      string   `json:"client_key"`
+	ServerName     string   `json:"server_name"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
 func NewConfig(configJSON []byte) (*Config, error) {
 	sdcConfig := &Config{}
 	err := json.Unmarshal(configJSON, sdcConfig)
@@ -43,9 +91,102 @@ func NewConfig(configJSON []byte) (*Config, error) {
 	if err = validator.Validate(sdcConfig); err != nil {
 		return nil, fmt.Errorf("invalid config: %s", err)
 	}
+
+	if sdcConfig.SnapshotPath != "" && sdcConfig.SnapshotIntervalSeconds < 1 {
+		return nil, fmt.Errorf("invalid config: SnapshotIntervalSeconds: less than min")
+	}
+
+	if sdcConfig.StaticRoutesPath != "" && sdcConfig.StaticRoutesRefreshSeconds < 1 {
+		return nil, fmt.Errorf("invalid config: StaticRoutesRefreshSeconds: less than min")
+	}
+
+	if err = validateNatsTLS(sdcConfig.NatsTLS); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	if err = validateRouteAPI(sdcConfig.RouteAPI); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	if err = validateBootstrap(sdcConfig.Bootstrap); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	for i, domain := range sdcConfig.InternalDomains {
+		if strings.Trim(domain, ".") == "" {
+			return nil, fmt.Errorf("invalid config: InternalDomains[%d]: zero value", i)
+		}
+	}
 	return sdcConfig, err
 }
 
+func validateNatsTLS(natsTLS NatsTLSConfig) error {
+	if !natsTLS.Enabled {
+		return nil
+	}
+
+	if natsTLS.CACert == "" {
+		return fmt.Errorf("NatsTLS.CACert: zero value")
+	}
+
+	if (natsTLS.ClientCert == "") != (natsTLS.ClientKey == "") {
+		return fmt.Errorf("NatsTLS.ClientKey: must be set together with NatsTLS.ClientCert")
+	}
+
+	return nil
+}
+
+func validateRouteAPI(routeAPI RouteAPIConfig) error {
+	if !routeAPI.Enabled {
+		return nil
+	}
+
+	if routeAPI.Port < 1 || routeAPI.Port > 65535 {
+		return fmt.Errorf("RouteAPI.Port: must be between 1 and 65535")
+	}
+
+	if routeAPI.CACert == "" {
+		return fmt.Errorf("RouteAPI.CACert: zero value")
+	}
+
+	if routeAPI.MaxBodyBytes < 1 {
+		return fmt.Errorf("RouteAPI.MaxBodyBytes: must be at least 1")
+	}
+
+	return nil
+}
+
+func validateBootstrap(bootstrap BootstrapConfig) error {
+	if !bootstrap.Enabled {
+		return nil
+	}
+
+	for i, peer := range bootstrap.Peers {
+		peerURL, err := url.Parse(peer)
+		if err != nil || peerURL.Scheme != "https" || peerURL.Host == "" {
+			return fmt.Errorf("Bootstrap.Peers[%d]: must be an https URL", i)
+		}
+	}
+
+	if bootstrap.CACert == "" {
+		return fmt.Errorf("Bootstrap.CACert: zero value")
+	}
+
+	if bootstrap.ClientCert == "" {
+		return fmt.Errorf("Bootstrap.ClientCert: zero value")
+	}
+
+	if bootstrap.ClientKey == "" {
+		return fmt.Errorf("Bootstrap.ClientKey: zero value")
+	}
+
+	if bootstrap.TimeoutSeconds < 1 {
+		return fmt.Errorf("Bootstrap.TimeoutSeconds: less than min")
+	}
+
+	return nil
+}
+
 func (c *Config) NatsServers() []string {
 	var natsServers []string
 	for _, info := range c.Nats {
@@ -41,7 +41,37 @@ var _ = Describe("Config", func() {
 				"metrics_emit_seconds": 6,
 				"metron_port": 8080,
 				"resume_pruning_delay_seconds": 2,
-				"warm_duration_seconds": 5
+				"warm_duration_seconds": 5,
+				"snapshot_path": "/some/snapshot/path",
+				"snapshot_interval_seconds": 30,
+				"max_prune_percent": 25,
+				"max_prune_count": 1000,
+				"internal_domains": ["apps.internal.", "platform.internal."],
+				"nats_tls": {
+					"enabled": true,
+					"ca_cert": "some_path_nats_ca_cert",
+					"client_cert": "some_path_nats_client_cert",
+					"client_key": "some_path_nats_client_key",
+					"server_name": "nats.service.cf.internal"
+				},
+				"static_routes_path": "/some/static/routes/path",
+				"static_routes_refresh_seconds": 60,
+				"route_api": {
+					"enabled": true,
+					"address": "0.0.0.0",
+					"port": 8056,
+					"ca_cert": "some_path_route_api_ca_cert",
+					"max_body_bytes": 1048576
+				},
+				"bootstrap": {
+					"enabled": true,
+					"peers": ["https://10.0.0.2:8054", "https://10.0.0.3:8054"],
+					"ca_cert": "some_path_bootstrap_ca_cert",
+					"client_cert": "some_path_bootstrap_client_cert",
+					"client_key": "some_path_bootstrap_client_key",
+					"server_name": "service-discovery-controller.service.cf.internal",
+					"timeout_seconds": 30
+				}
 			}`)
 
 			parsedConfig, err := NewConfig(configJSON)
@@ -63,6 +93,36 @@ var _ = Describe("Config", func() {
 			Expect(parsedConfig.MetricsEmitSeconds).To(Equal(6))
 			Expect(parsedConfig.ResumePruningDelaySeconds).To(Equal(2))
 			Expect(parsedConfig.WarmDurationSeconds).To(Equal(5))
+			Expect(parsedConfig.SnapshotPath).To(Equal("/some/snapshot/path"))
+			Expect(parsedConfig.SnapshotIntervalSeconds).To(Equal(30))
+			Expect(parsedConfig.MaxPrunePercent).To(Equal(25))
+			Expect(parsedConfig.MaxPruneCount).To(Equal(1000))
+			Expect(parsedConfig.InternalDomains).To(Equal([]string{"apps.internal.", "platform.internal."}))
+			Expect(parsedConfig.NatsTLS).To(Equal(NatsTLSConfig{
+				Enabled:    true,
+				CACert:     "some_path_nats_ca_cert",
+				ClientCert: "some_path_nats_client_cert",
+				ClientKey:  "some_path_nats_client_key",
+				ServerName: "nats.service.cf.internal",
+			}))
+			Expect(parsedConfig.StaticRoutesPath).To(Equal("/some/static/routes/path"))
+			Expect(parsedConfig.StaticRoutesRefreshSeconds).To(Equal(60))
+			Expect(parsedConfig.RouteAPI).To(Equal(RouteAPIConfig{
+				Enabled:      true,
+				Address:      "0.0.0.0",
+				Port:         8056,
+				CACert:       "some_path_route_api_ca_cert",
+				MaxBodyBytes: 1048576,
+			}))
+			Expect(parsedConfig.Bootstrap).To(Equal(BootstrapConfig{
+				Enabled:        true,
+				Peers:          []string{"https://10.0.0.2:8054", "https://10.0.0.3:8054"},
+				CACert:         "some_path_bootstrap_ca_cert",
+				ClientCert:     "some_path_bootstrap_client_cert",
+				ClientKey:      "some_path_bootstrap_client_key",
+				ServerName:     "service-discovery-controller.service.cf.internal",
+				TimeoutSeconds: 30,
+			}))
 		})
 	})
 
@@ -113,7 +173,59 @@ var _ = Describe("Config", func() {
 		Entry("invalid ca_cert", "ca_cert", "", "CACert: zero value"),
 		Entry("invalid resume_pruning_delay_seconds", "resume_pruning_delay_seconds", -1, "ResumePruningDelaySeconds: less than min"),
 		Entry("invalid warm_duration_seconds", "warm_duration_seconds", -1, "WarmDurationSeconds: less than min"),
+		Entry("invalid snapshot_interval_seconds", "snapshot_interval_seconds", -1, "SnapshotIntervalSeconds: less than min"),
+		Entry("invalid static_routes_refresh_seconds", "static_routes_refresh_seconds", -1, "StaticRoutesRefreshSeconds: less than min"),
+		Entry("invalid max_prune_percent", "max_prune_percent", -1, "MaxPrunePercent: less than min"),
+		Entry("invalid max_prune_percent", "max_prune_percent", 101, "MaxPrunePercent: greater than max"),
+		Entry("invalid max_prune_count", "max_prune_count", -1, "MaxPruneCount: less than min"),
+		Entry("invalid internal_domains", "internal_domains", []string{"apps.internal.", "."}, "InternalDomains[1]: zero value"),
+		Entry("nats_tls without a ca_cert", "nats_tls", map[string]interface{}{"enabled": true}, "NatsTLS.CACert: zero value"),
+		Entry("nats_tls with a client_cert but no client_key", "nats_tls",
+			map[string]interface{}{"enabled": true, "ca_cert": "path_to_ca_cert", "client_cert": "path_to_cert"},
+			"NatsTLS.ClientKey: must be set together with NatsTLS.ClientCert"),
+		Entry("route_api without a port", "route_api", map[string]interface{}{"enabled": true, "ca_cert": "path_to_ca_cert"}, "RouteAPI.Port: must be between 1 and 65535"),
+		Entry("route_api without a ca_cert", "route_api", map[string]interface{}{"enabled": true, "port": 8056}, "RouteAPI.CACert: zero value"),
+		Entry("route_api without a max_body_bytes", "route_api", map[string]interface{}{"enabled": true, "port": 8056, "ca_cert": "path_to_ca_cert"}, "RouteAPI.MaxBodyBytes: must be at least 1"),
+		Entry("bootstrap with a peer that is not an https url", "bootstrap",
+			map[string]interface{}{"enabled": true, "peers": []string{"https://10.0.0.2:8054", "10.0.0.3:8054"}},
+			"Bootstrap.Peers[1]: must be an https URL"),
+		Entry("bootstrap without a ca_cert", "bootstrap",
+			map[string]interface{}{"enabled": true, "client_cert": "cert", "client_key": "key", "timeout_seconds": 30},
+			"Bootstrap.CACert: zero value"),
+		Entry("bootstrap without a client_cert", "bootstrap",
+			map[string]interface{}{"enabled": true, "ca_cert": "ca", "client_key": "key", "timeout_seconds": 30},
+			"Bootstrap.ClientCert: zero value"),
+		Entry("bootstrap without a client_key", "bootstrap",
+			map[string]interface{}{"enabled": true, "ca_cert": "ca", "client_cert": "cert", "timeout_seconds": 30},
+			"Bootstrap.ClientKey: zero value"),
+		Entry("bootstrap without a timeout_seconds", "bootstrap",
+			map[string]interface{}{"enabled": true, "ca_cert": "ca", "client_cert": "cert", "client_key": "key"},
+			"Bootstrap.TimeoutSeconds: less than min"),
 	)
+
+	Context("when a snapshot path is configured without an interval", func() {
+		It("returns an error", func() {
+			cfg := cloneMap(requiredFields)
+			cfg["snapshot_path"] = "/some/snapshot/path"
+
+			cfgBytes, _ := json.Marshal(cfg)
+			_, err := NewConfig(cfgBytes)
+
+			Expect(err).To(MatchError("invalid config: SnapshotIntervalSeconds: less than min"))
+		})
+	})
+
+	Context("when a static routes path is configured without a refresh interval", func() {
+		It("returns an error", func() {
+			cfg := cloneMap(requiredFields)
+			cfg["static_routes_path"] = "/some/static/routes/path"
+
+			cfgBytes, _ := json.Marshal(cfg)
+			_, err := NewConfig(cfgBytes)
+
+			Expect(err).To(MatchError("invalid config: StaticRoutesRefreshSeconds: less than min"))
+		})
+	})
 })
 
 func cloneMap(original map[string]interface{}) map[string]interface{} {
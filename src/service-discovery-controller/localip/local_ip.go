@@ -2,8 +2,20 @@ package localip
 
 import "net"
 
+// LocalIP returns the address of the interface that routes to the outside
+// world, preferring IPv4 and falling back to IPv6 on hosts without an IPv4
+// route. No packets are sent.
 func LocalIP() (string, error) {
-	addr, err := net.ResolveUDPAddr("udp", "1.2.3.4:1")
+	host, err := localIPFor("1.2.3.4:1")
+	if err != nil {
+		return localIPFor("[2001:db8::1]:1")
+	}
+
+	return host, nil
+}
+
+func localIPFor(address string) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return "", err
 	}
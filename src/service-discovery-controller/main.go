@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/signal"
 	"service-discovery-controller/addresstable"
+	"service-discovery-controller/bootstrap"
 	"service-discovery-controller/config"
 	"service-discovery-controller/mbus"
+	"service-discovery-controller/routesource"
 	"syscall"
 	"time"
 
@@ -48,6 +50,7 @@ func mainWithError() error {
 	}
 
 	addressTable := buildAddressTable(conf, logger)
+	snapshotFresh := loadSnapshot(conf, addressTable, logger)
 
 	metronAddress := fmt.Sprintf("127.0.0.1:%d", conf.MetronPort)
 	err = dropsonde.Initialize(metronAddress, "service-discovery-controller")
@@ -58,11 +61,27 @@ func mainWithError() error {
 
 	routeMessageRecorder := mbus.NewMetricsRecorder(clock.NewClock())
 
-	subscriber, err := buildSubscriber(conf, addressTable, routeMessageRecorder, logger)
+	var subscriber *mbus.Subscriber
+	if len(conf.Nats) > 0 {
+		subscriber, err = buildSubscriber(conf, addressTable, routeMessageRecorder, logger)
+		if err != nil {
+			logger.Error("Failed to build subscriber", err)
+			return err
+		}
+	} else {
+		logger.Info("nats-route-source-disabled")
+	}
+
+	routeSources := buildRouteSources(conf, subscriber, addressTable, logger)
+
+	bootstrapper, err := buildBootstrapper(conf, addressTable, logger)
 	if err != nil {
-		logger.Error("Failed to build subscriber", err)
+		logger.Error("Failed to build bootstrapper", err)
 		return err
 	}
+	if subscriber != nil && bootstrapper != nil {
+		subscriber.WarmAfter(bootstrapper.Done())
+	}
 
 	dnsRequestRecorder := &routes.MetricsRecorder{}
 
@@ -78,12 +97,19 @@ func mainWithError() error {
 		Getter: routeMessageRecorder.GetMaxSinceLastInterval,
 	}
 
+	pruneHeldSource := metrics.MetricSource{
+		Name:   "pruneHeld",
+		Unit:   "",
+		Getter: addressTable.GetPruneHeld,
+	}
+
 	metricsEmitter := metrics.NewMetricsEmitter(
 		logger,
 		time.Duration(conf.MetricsEmitSeconds)*time.Second,
 		metrics.NewUptimeSource(),
 		dnsRequestSource,
 		routeMessageSource,
+		pruneHeldSource,
 	)
 
 	metricsSender := &metrics.MetricsSender{
@@ -105,16 +131,45 @@ func mainWithError() error {
 		logger.Session("routes-server"),
 	)
 
-	members := grouper.Members{
-		{"subscriber", subscriber},
-		{"metrics-emitter", metricsEmitter},
-		{"log-level-server", logLevelServer},
-		{"routes-server", routesServer},
+	// The route sources start before the bootstrap, so that routes registered
+	// while it runs are applied rather than lost. The bootstrap only merges in
+	// the entries of the peer that are newer.
+	members := grouper.Members{}
+	for _, routeSource := range routeSources {
+		members = append(members, grouper.Member{routeSource.Name() + "-route-source", routeSource})
+	}
+	if bootstrapper != nil {
+		members = append(members, grouper.Member{"bootstrap", bootstrapper})
+	}
+	members = append(members,
+		grouper.Member{"metrics-emitter", metricsEmitter},
+		grouper.Member{"log-level-server", logLevelServer},
+		grouper.Member{"routes-server", routesServer},
+	)
+
+	if conf.SnapshotPath != "" {
+		snapshotWriter := addresstable.NewSnapshotWriter(
+			addressTable,
+			conf.SnapshotPath,
+			time.Duration(conf.SnapshotIntervalSeconds)*time.Second,
+			clock.NewClock(),
+			logger.Session("snapshot-writer"),
+		)
+		members = append(members, grouper.Member{"snapshot-writer", snapshotWriter})
 	}
 
 	group := grouper.NewOrdered(os.Interrupt, members)
 	monitor := ifrit.Invoke(sigmon.New(group))
 
+	// Invoke returns once the bootstrap has succeeded or timed out and the
+	// route sources have loaded their routes. Without NATS, nothing else warms
+	// the table; with NATS, the bootstrap or the warm timer of the subscriber,
+	// which waits for the bootstrap to be done, does, unless a fresh snapshot
+	// was loaded and there is no bootstrap.
+	if subscriber == nil || (bootstrapper == nil && snapshotFresh) {
+		addressTable.SetWarm()
+	}
+
 	go func() {
 		err := <-monitor.Wait()
 		if err != nil {
@@ -126,7 +181,9 @@ func mainWithError() error {
 
 	select {
 	case signal := <-signalChannel:
-		subscriber.Close()
+		if subscriber != nil {
+			subscriber.Close()
+		}
 		addressTable.Shutdown()
 		monitor.Signal(signal)
 		logger.Info("server-stopped")
@@ -135,12 +192,112 @@ func mainWithError() error {
 }
 
 func buildAddressTable(conf *config.Config, logger lager.Logger) *addresstable.AddressTable {
-	return addresstable.NewAddressTable(
+	addressTable := addresstable.NewAddressTable(
 		time.Duration(conf.StalenessThresholdSeconds)*time.Second,
 		time.Duration(conf.PruningIntervalSeconds)*time.Second,
 		time.Duration(conf.ResumePruningDelaySeconds)*time.Second,
 		clock.NewClock(),
 		logger.Session("address-table"))
+	addressTable.SetPruneLimits(conf.MaxPrunePercent, conf.MaxPruneCount)
+	return addressTable
+}
+
+// loadSnapshot returns whether a snapshot younger than the staleness
+// threshold was loaded.
+func loadSnapshot(conf *config.Config, addressTable *addresstable.AddressTable, logger lager.Logger) bool {
+	if conf.SnapshotPath == "" {
+		return false
+	}
+
+	info, err := os.Stat(conf.SnapshotPath)
+	if err != nil {
+		logger.Info("snapshot-not-loaded", lager.Data{"path": conf.SnapshotPath, "reason": err.Error()})
+		return false
+	}
+
+	loaded, err := addressTable.LoadSnapshot(conf.SnapshotPath)
+	if err != nil {
+		logger.Info("snapshot-not-loaded", lager.Data{"path": conf.SnapshotPath, "reason": err.Error()})
+		return false
+	}
+
+	// A snapshot older than the staleness threshold may hold instances that
+	// are long gone, so the table warms up as usual instead.
+	age := time.Since(info.ModTime())
+	if age >= time.Duration(conf.StalenessThresholdSeconds)*time.Second {
+		logger.Info("snapshot-loaded-stale", lager.Data{"path": conf.SnapshotPath, "entries": loaded, "age": age.String()})
+		return false
+	}
+
+	logger.Info("snapshot-loaded", lager.Data{"path": conf.SnapshotPath, "entries": loaded})
+	return true
+}
+
+func buildRouteSources(conf *config.Config, subscriber *mbus.Subscriber,
+	addressTable *addresstable.AddressTable, logger lager.Logger) []routesource.RouteSource {
+	routeSources := []routesource.RouteSource{}
+
+	if subscriber != nil {
+		routeSources = append(routeSources, subscriber)
+	}
+
+	if conf.StaticRoutesPath != "" {
+		routeSources = append(routeSources, routesource.NewFileSource(
+			conf.StaticRoutesPath,
+			conf.InternalDomains,
+			time.Duration(conf.StaticRoutesRefreshSeconds)*time.Second,
+			addressTable,
+			clock.NewClock(),
+			logger.Session("file-route-source"),
+		))
+	}
+
+	if conf.RouteAPI.Enabled {
+		routeSources = append(routeSources, routesource.NewAPISource(
+			conf.RouteAPI.Address,
+			conf.RouteAPI.Port,
+			conf.ServerCert,
+			conf.ServerKey,
+			conf.RouteAPI.CACert,
+			conf.RouteAPI.MaxBodyBytes,
+			conf.InternalDomains,
+			addressTable,
+			logger.Session("api-route-source"),
+		))
+	}
+
+	return routeSources
+}
+
+// buildBootstrapper returns nil when there are no peers to bootstrap from,
+// such as for the first instance of a deployment.
+func buildBootstrapper(conf *config.Config, addressTable *addresstable.AddressTable,
+	logger lager.Logger) (*bootstrap.Bootstrapper, error) {
+	if !conf.Bootstrap.Enabled || len(conf.Bootstrap.Peers) == 0 {
+		return nil, nil
+	}
+
+	timeout := time.Duration(conf.Bootstrap.TimeoutSeconds) * time.Second
+	client, err := bootstrap.NewClient(
+		conf.Bootstrap.CACert,
+		conf.Bootstrap.ClientCert,
+		conf.Bootstrap.ClientKey,
+		conf.Bootstrap.ServerName,
+		timeout,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return bootstrap.NewBootstrapper(
+		conf.Bootstrap.Peers,
+		client,
+		addressTable,
+		timeout,
+		time.Second,
+		clock.NewClock(),
+		logger.Session("bootstrap"),
+	), nil
 }
 
 func buildLogger() (lager.Logger, *lager.ReconfigurableSink) {
@@ -177,14 +334,28 @@ func buildSubscriber(conf *config.Config, addressTable *addresstable.AddressTabl
 
 	subscriberID := fmt.Sprintf("%s-%s", conf.Index, uuid)
 
+	provider := &mbus.NatsConnWithUrlProvider{
+		Url: strings.Join(conf.NatsServers(), ","),
+	}
+
+	if conf.NatsTLS.Enabled {
+		provider.TLSConfig, err = mbus.NewNatsTLSConfig(
+			conf.NatsTLS.CACert,
+			conf.NatsTLS.ClientCert,
+			conf.NatsTLS.ClientKey,
+			conf.NatsTLS.ServerName,
+		)
+		if err != nil {
+			return &mbus.Subscriber{}, err
+		}
+	}
+
 	subOpts := mbus.SubscriberOpts{
 		ID: subscriberID,
 		MinimumRegisterIntervalInSeconds: conf.ResumePruningDelaySeconds,
 		PruneThresholdInSeconds:          120,
-	}
-
-	provider := &mbus.NatsConnWithUrlProvider{
-		Url: strings.Join(conf.NatsServers(), ","),
+		AcceptTLS:                        provider.AcceptsTLS(),
+		InternalDomains:                  conf.InternalDomains,
 	}
 
 	localIP, err := localip.LocalIP()
@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"service-discovery-controller/addresstable"
 
 	"code.cloudfoundry.org/cf-networking-helpers/testsupport/metrics"
 
@@ -18,6 +21,8 @@ import (
 	"strings"
 
 	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/nats-io/gnatsd/server"
 	"github.com/nats-io/nats"
 	. "github.com/onsi/ginkgo"
@@ -146,7 +151,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 				respBody, err := ioutil.ReadAll(resp.Body)
 				Expect(err).ToNot(HaveOccurred())
 				return string(respBody)
-			}).Should(MatchJSON(`{
+			}).Should(matchHostsJSON(`{
 				"env": "",
 				"hosts": [
 				{
@@ -156,7 +161,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				}],
 				"service": ""
 			}`))
@@ -201,7 +207,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 			respBody, err := ioutil.ReadAll(resp.Body)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(respBody).To(MatchJSON(`{
+			Expect(respBody).To(matchHostsJSON(`{
 				"env": "",
 				"hosts": [
 				{
@@ -211,7 +217,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.2",
@@ -220,7 +227,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				}],
 				"service": ""
 			}`))
@@ -233,7 +241,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 			respBody, err := ioutil.ReadAll(resp.Body)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(respBody).To(MatchJSON(`{
+			Expect(respBody).To(matchHostsJSON(`{
 				"env": "",
 				"hosts": [
 				{
@@ -243,7 +251,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.2",
@@ -252,7 +261,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.3",
@@ -261,7 +271,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.4",
@@ -270,7 +281,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.5",
@@ -279,7 +291,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.6",
@@ -288,7 +301,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.7",
@@ -297,7 +311,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.8",
@@ -306,7 +321,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.9",
@@ -315,7 +331,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.10",
@@ -324,7 +341,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.11",
@@ -333,7 +351,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 				{
 					"ip_address": "192.168.0.12",
@@ -342,7 +361,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				},
 							{
 					"ip_address": "192.168.0.13",
@@ -351,7 +371,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 					"revision": "",
 					"service": "",
 					"service_repo_name": "",
-					"tags": {}
+					"tags": {},
+					"source": "nats"
 				}
 				],
 				"service": ""
@@ -371,7 +392,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 				Expect(err).ToNot(HaveOccurred())
 
 				return respBody
-			}, waitDuration).Should(MatchJSON(`{ "env": "", "hosts": [], "service": "" }`))
+			}, waitDuration).Should(matchHostsJSON(`{ "env": "", "hosts": [], "service": "", "not_found": true }`))
 		})
 
 		Context("when we hit the /routes endpoint", func() {
@@ -382,12 +403,16 @@ var _ = Describe("Service Discovery Controller process", func() {
 				respBody, err := ioutil.ReadAll(resp.Body)
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(respBody).To(Or(MatchJSON(`{
+				Expect(respBody).To(Or(matchHostsJSON(`{
 					"addresses": [{
 						"hostname": "app-id.internal.local.",
 						"ips": [
 							"192.168.0.1",
 							"192.168.0.2"
+							],
+						"hosts": [
+							{"ip_address": "192.168.0.1", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.2", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"}
 							]
 					}, {
 						"hostname": "large-id.internal.local.",
@@ -405,11 +430,26 @@ var _ = Describe("Service Discovery Controller process", func() {
 							"192.168.0.11",
 							"192.168.0.12",
 							"192.168.0.13"
+							],
+						"hosts": [
+							{"ip_address": "192.168.0.1", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.2", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.3", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.4", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.5", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.6", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.7", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.8", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.9", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.10", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.11", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.12", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+							{"ip_address": "192.168.0.13", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"}
 							]
 						}
 					]
 				}`),
-					MatchJSON(`{
+					matchHostsJSON(`{
 					"addresses": [
 						{
 							"hostname": "large-id.internal.local.",
@@ -427,12 +467,31 @@ var _ = Describe("Service Discovery Controller process", func() {
 								"192.168.0.11",
 								"192.168.0.12",
 								"192.168.0.13"
+							],
+							"hosts": [
+								{"ip_address": "192.168.0.1", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.2", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.3", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.4", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.5", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.6", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.7", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.8", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.9", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.10", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.11", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.12", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.13", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"}
 							]
 						}, {
 							"hostname": "app-id.internal.local.",
 							"ips": [
 								"192.168.0.1",
 								"192.168.0.2"
+							],
+							"hosts": [
+								{"ip_address": "192.168.0.1", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"},
+								{"ip_address": "192.168.0.2", "last_check_in": "", "port": 0, "revision": "", "service": "", "service_repo_name": "", "tags": {}, "source": "nats"}
 							]
 						}
 					]
@@ -484,7 +543,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 					respBody, err := ioutil.ReadAll(resp.Body)
 					Expect(err).ToNot(HaveOccurred())
 					return string(respBody)
-				}).Should(MatchJSON(`{
+				}).Should(matchHostsJSON(`{
 					"env": "",
 					"hosts": [
 					{
@@ -494,7 +553,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 						"revision": "",
 						"service": "",
 						"service_repo_name": "",
-						"tags": {}
+						"tags": {},
+						"source": "nats"
 					},
 					{
 						"ip_address": "192.168.0.2",
@@ -503,7 +563,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 						"revision": "",
 						"service": "",
 						"service_repo_name": "",
-						"tags": {}
+						"tags": {},
+						"source": "nats"
 					}],
 					"service": ""
 				}`))
@@ -576,7 +637,7 @@ var _ = Describe("Service Discovery Controller process", func() {
 						Expect(err).ToNot(HaveOccurred())
 
 						return respBody
-					}, waitDuration).Should(MatchJSON(`{
+					}, waitDuration).Should(matchHostsJSON(`{
 					"env": "",
 					"hosts": [
 					{
@@ -586,7 +647,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 						"revision": "",
 						"service": "",
 						"service_repo_name": "",
-						"tags": {}
+						"tags": {},
+						"source": "nats"
 					},
 					{
 						"ip_address": "192.168.0.2",
@@ -595,7 +657,8 @@ var _ = Describe("Service Discovery Controller process", func() {
 						"revision": "",
 						"service": "",
 						"service_repo_name": "",
-						"tags": {}
+						"tags": {},
+						"source": "nats"
 					}],
 					"service": ""
 				}`))
@@ -612,10 +675,11 @@ var _ = Describe("Service Discovery Controller process", func() {
 						Expect(err).ToNot(HaveOccurred())
 
 						return respBody
-					}, waitDuration).Should(MatchJSON(`{
+					}, waitDuration).Should(matchHostsJSON(`{
 					"env": "",
 					"hosts": [],
-					"service": ""
+					"service": "",
+					"not_found": true
 				}`))
 				})
 
@@ -724,6 +788,327 @@ var _ = Describe("Service Discovery Controller process", func() {
 		})
 	})
 
+	Context("when a snapshot of the address table exists", func() {
+		var snapshotDir string
+
+		BeforeEach(func() {
+			var err error
+			snapshotDir, err = ioutil.TempDir("", "snapshot")
+			Expect(err).ToNot(HaveOccurred())
+			snapshotPath := filepath.Join(snapshotDir, "address-table.json")
+
+			table := addresstable.NewAddressTable(time.Minute, time.Minute, 0, clock.NewClock(), lagertest.NewTestLogger("test"))
+			table.Add([]string{"app-id.internal.local."}, "192.168.0.1")
+			Expect(table.WriteSnapshot(snapshotPath)).To(Succeed())
+			table.Shutdown()
+
+			os.Remove(configPath)
+			configPath = writeConfigFile(fmt.Sprintf(`{
+				"address":"127.0.0.1",
+				"port":"%d",
+				"ca_cert": "%s",
+				"server_cert": "%s",
+				"server_key": "%s",
+				"nats":[
+					{
+						"host":"localhost",
+						"port":%d,
+						"user":"",
+						"pass":""
+					}
+				],
+				"staleness_threshold_seconds": 60,
+				"pruning_interval_seconds": %d,
+				"log_level_address": "%s",
+				"log_level_port": %d,
+				"metron_port": %d,
+				"metrics_emit_seconds": 2,
+				"resume_pruning_delay_seconds": 0,
+				"warm_duration_seconds": 60,
+				"snapshot_path": "%s",
+				"snapshot_interval_seconds": 1
+			}`,
+				port, caFile, serverCert, serverKey, natsServerPort, pruningIntervalSeconds, logLevelEndpointAddress, logLevelEndpointPort, fakeMetron.Port(), snapshotPath))
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			startCmd := exec.Command(pathToServer, "-c", configPath)
+			session, err = gexec.Start(startCmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 6*time.Second).Should(gbytes.Say("service-discovery-controller.server-started"))
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(snapshotDir)
+		})
+
+		It("is warm immediately and serves the addresses from the snapshot", func() {
+			Expect(session).To(gbytes.Say("service-discovery-controller.snapshot-loaded"))
+
+			url := fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port)
+			resp, err := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert).Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(respBody).To(matchHostsJSON(`{
+				"env": "",
+				"hosts": [
+				{
+					"ip_address": "192.168.0.1",
+					"last_check_in": "",
+					"port": 0,
+					"revision": "",
+					"service": "",
+					"service_repo_name": "",
+					"tags": {}
+				}],
+				"service": ""
+			}`))
+		})
+
+		Context("when the snapshot is older than the staleness threshold", func() {
+			BeforeEach(func() {
+				snapshotPath := filepath.Join(snapshotDir, "address-table.json")
+				writtenAt := time.Now().Add(-2 * time.Minute)
+				Expect(os.Chtimes(snapshotPath, writtenAt, writtenAt)).To(Succeed())
+			})
+
+			It("loads the snapshot but is not warm", func() {
+				Expect(session).To(gbytes.Say("service-discovery-controller.snapshot-loaded-stale"))
+
+				url := fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port)
+				resp, err := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert).Get(url)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Context("when bootstrapping from a running peer", func() {
+		var (
+			peerSession    *gexec.Session
+			peerPort       int
+			peerConfigPath string
+		)
+
+		BeforeEach(func() {
+			peerPort = ports.PickAPort()
+			peerConfigPath = writeConfigFile(fmt.Sprintf(`{
+				"address":"127.0.0.1",
+				"port":"%d",
+				"ca_cert": "%s",
+				"server_cert": "%s",
+				"server_key": "%s",
+				"nats":[
+					{
+						"host":"localhost",
+						"port":%d,
+						"user":"",
+						"pass":""
+					}
+				],
+				"staleness_threshold_seconds": 60,
+				"pruning_interval_seconds": %d,
+				"log_level_address": "%s",
+				"log_level_port": %d,
+				"metron_port": %d,
+				"metrics_emit_seconds": 2,
+				"resume_pruning_delay_seconds": 0,
+				"warm_duration_seconds": 0
+			}`,
+				peerPort, caFile, serverCert, serverKey, natsServerPort, pruningIntervalSeconds, logLevelEndpointAddress, ports.PickAPort(), fakeMetron.Port()))
+
+			var err error
+			peerSession, err = gexec.Start(exec.Command(pathToServer, "-c", peerConfigPath), GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(peerSession, 6*time.Second).Should(gbytes.Say("service-discovery-controller.server-started"))
+
+			routeEmitter = newFakeRouteEmitter("nats://" + natsServer.Addr().String())
+			register(routeEmitter, "192.168.0.1", "app-id.internal.local.")
+			Expect(routeEmitter.Flush()).ToNot(HaveOccurred())
+
+			client := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert)
+			Eventually(func() int {
+				resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", peerPort))
+				if err != nil {
+					return 0
+				}
+				respBody, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return strings.Count(string(respBody), "192.168.0.1")
+			}).Should(Equal(1))
+
+			os.Remove(configPath)
+			configPath = writeConfigFile(fmt.Sprintf(`{
+				"address":"127.0.0.1",
+				"port":"%d",
+				"ca_cert": "%s",
+				"server_cert": "%s",
+				"server_key": "%s",
+				"nats":[
+					{
+						"host":"localhost",
+						"port":%d,
+						"user":"",
+						"pass":""
+					}
+				],
+				"staleness_threshold_seconds": 60,
+				"pruning_interval_seconds": %d,
+				"log_level_address": "%s",
+				"log_level_port": %d,
+				"metron_port": %d,
+				"metrics_emit_seconds": 2,
+				"resume_pruning_delay_seconds": 0,
+				"warm_duration_seconds": 60,
+				"bootstrap": {
+					"enabled": true,
+					"peers": ["https://127.0.0.1:%d"],
+					"ca_cert": "%s",
+					"client_cert": "%s",
+					"client_key": "%s",
+					"timeout_seconds": 5
+				}
+			}`,
+				port, caFile, serverCert, serverKey, natsServerPort, pruningIntervalSeconds, logLevelEndpointAddress, logLevelEndpointPort, fakeMetron.Port(),
+				peerPort, caFile, serverCert, serverKey))
+
+			session, err = gexec.Start(exec.Command(pathToServer, "-c", configPath), GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 6*time.Second).Should(gbytes.Say("service-discovery-controller.server-started"))
+		})
+
+		AfterEach(func() {
+			peerSession.Kill()
+			os.Remove(peerConfigPath)
+			routeEmitter.Close()
+		})
+
+		It("is warm immediately and serves the addresses of the peer", func() {
+			Expect(session).To(gbytes.Say("service-discovery-controller.bootstrap.bootstrap-succeeded"))
+
+			url := fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port)
+			resp, err := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert).Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(respBody).To(matchHostsJSON(`{
+				"env": "",
+				"hosts": [
+				{
+					"ip_address": "192.168.0.1",
+					"last_check_in": "",
+					"port": 0,
+					"revision": "",
+					"service": "",
+					"service_repo_name": "",
+					"source": "nats",
+					"tags": {}
+				}],
+				"service": ""
+			}`))
+		})
+
+		It("takes routes registered after the bootstrap from nats", func() {
+			register(routeEmitter, "192.168.0.2", "app-id.internal.local.")
+			Expect(routeEmitter.Flush()).ToNot(HaveOccurred())
+
+			client := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert)
+			Eventually(func() string {
+				resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port))
+				Expect(err).ToNot(HaveOccurred())
+				respBody, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return string(respBody)
+			}).Should(SatisfyAll(ContainSubstring("192.168.0.1"), ContainSubstring("192.168.0.2")))
+		})
+	})
+
+	Context("when a static routes file is configured instead of nats", func() {
+		var staticRoutesDir string
+
+		BeforeEach(func() {
+			var err error
+			staticRoutesDir, err = ioutil.TempDir("", "static-routes")
+			Expect(err).ToNot(HaveOccurred())
+			staticRoutesPath := filepath.Join(staticRoutesDir, "static_routes.yml")
+			Expect(ioutil.WriteFile(staticRoutesPath, []byte(`---
+routes:
+- hostnames: [app-id.internal.local.]
+  ip: 192.168.0.1
+`), 0644)).To(Succeed())
+
+			os.Remove(configPath)
+			configPath = writeConfigFile(fmt.Sprintf(`{
+				"address":"127.0.0.1",
+				"port":"%d",
+				"ca_cert": "%s",
+				"server_cert": "%s",
+				"server_key": "%s",
+				"staleness_threshold_seconds": %d,
+				"pruning_interval_seconds": %d,
+				"log_level_address": "%s",
+				"log_level_port": %d,
+				"metron_port": %d,
+				"metrics_emit_seconds": 2,
+				"resume_pruning_delay_seconds": 0,
+				"warm_duration_seconds": 60,
+				"static_routes_path": "%s",
+				"static_routes_refresh_seconds": %d
+			}`,
+				port, caFile, serverCert, serverKey, stalenessThresholdSeconds, pruningIntervalSeconds, logLevelEndpointAddress, logLevelEndpointPort, fakeMetron.Port(), staticRoutesPath, pruningIntervalSeconds))
+
+			startCmd := exec.Command(pathToServer, "-c", configPath)
+			session, err = gexec.Start(startCmd, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 6*time.Second).Should(gbytes.Say("service-discovery-controller.server-started"))
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(staticRoutesDir)
+		})
+
+		It("is warm immediately and keeps serving the static routes", func() {
+			url := fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port)
+			client := testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert)
+			expectedJSON := `{
+				"env": "",
+				"hosts": [
+				{
+					"ip_address": "192.168.0.1",
+					"last_check_in": "",
+					"port": 0,
+					"revision": "",
+					"service": "",
+					"service_repo_name": "",
+					"source": "file",
+					"tags": {}
+				}],
+				"service": ""
+			}`
+
+			resp, err := client.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(respBody).To(matchHostsJSON(expectedJSON))
+
+			Consistently(func() []byte {
+				resp, err := client.Get(url)
+				Expect(err).ToNot(HaveOccurred())
+				respBody, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return respBody
+			}, 3*time.Second).Should(matchHostsJSON(expectedJSON))
+		})
+	})
+
 	Context("when the log level endpoint fails to start successfully", func() {
 		var conflictingServer *http.Server
 
@@ -786,6 +1171,28 @@ var _ = Describe("Service Discovery Controller process", func() {
 	})
 })
 
+var (
+	lastCheckIn = regexp.MustCompile(`"last_check_in":"[^"]*"`)
+	maxAge      = regexp.MustCompile(`,"max_age":\d+`)
+)
+
+// matchHostsJSON matches like MatchJSON, ignoring the last_check_in and
+// max_age of the hosts since they depend on when the controller received the
+// registration.
+func matchHostsJSON(expected string) types.GomegaMatcher {
+	return WithTransform(func(actual interface{}) string {
+		var body string
+		switch actual := actual.(type) {
+		case []byte:
+			body = string(actual)
+		case string:
+			body = actual
+		}
+		body = lastCheckIn.ReplaceAllString(body, `"last_check_in":""`)
+		return maxAge.ReplaceAllString(body, "")
+	}, MatchJSON(expected))
+}
+
 func requestLogChange(logLevel string, port int) *http.Response {
 	client := &http.Client{}
 	postBody := strings.NewReader(logLevel)
@@ -2,22 +2,36 @@
 package fakes
 
 import (
+	"service-discovery-controller/addresstable"
 	"service-discovery-controller/mbus"
 	"sync"
 )
 
 type AddressTable struct {
-	AddStub        func(infraNames []string, ip string)
-	addMutex       sync.RWMutex
-	addArgsForCall []struct {
-		infraNames []string
-		ip         string
-	}
-	RemoveStub        func(infraNames []string, ip string)
-	removeMutex       sync.RWMutex
-	removeArgsForCall []struct {
-		infraNames []string
-		ip         string
+	AddWithMetadataStub        func(infraNames []string, ip string, endpointUpdatedAt int64, metadata addresstable.Metadata) int
+	addWithMetadataMutex       sync.RWMutex
+	addWithMetadataArgsForCall []struct {
+		infraNames        []string
+		ip                string
+		endpointUpdatedAt int64
+		metadata          addresstable.Metadata
+	}
+	addWithMetadataReturns struct {
+		result1 int
+	}
+	addWithMetadataReturnsOnCall map[int]struct {
+		result1 int
+	}
+	ApplyStub        func(changes []addresstable.Change) []int
+	applyMutex       sync.RWMutex
+	applyArgsForCall []struct {
+		changes []addresstable.Change
+	}
+	applyReturns struct {
+		result1 []int
+	}
+	applyReturnsOnCall map[int]struct {
+		result1 []int
 	}
 	PausePruningStub         func()
 	pausePruningMutex        sync.RWMutex
@@ -32,64 +46,113 @@ type AddressTable struct {
 	invocationsMutex         sync.RWMutex
 }
 
-func (fake *AddressTable) Add(infraNames []string, ip string) {
+func (fake *AddressTable) AddWithMetadata(infraNames []string, ip string, endpointUpdatedAt int64, metadata addresstable.Metadata) int {
 	var infraNamesCopy []string
 	if infraNames != nil {
 		infraNamesCopy = make([]string, len(infraNames))
 		copy(infraNamesCopy, infraNames)
 	}
-	fake.addMutex.Lock()
-	fake.addArgsForCall = append(fake.addArgsForCall, struct {
-		infraNames []string
-		ip         string
-	}{infraNamesCopy, ip})
-	fake.recordInvocation("Add", []interface{}{infraNamesCopy, ip})
-	fake.addMutex.Unlock()
-	if fake.AddStub != nil {
-		fake.AddStub(infraNames, ip)
+	fake.addWithMetadataMutex.Lock()
+	ret, specificReturn := fake.addWithMetadataReturnsOnCall[len(fake.addWithMetadataArgsForCall)]
+	fake.addWithMetadataArgsForCall = append(fake.addWithMetadataArgsForCall, struct {
+		infraNames        []string
+		ip                string
+		endpointUpdatedAt int64
+		metadata          addresstable.Metadata
+	}{infraNamesCopy, ip, endpointUpdatedAt, metadata})
+	fake.recordInvocation("AddWithMetadata", []interface{}{infraNamesCopy, ip, endpointUpdatedAt, metadata})
+	fake.addWithMetadataMutex.Unlock()
+	if fake.AddWithMetadataStub != nil {
+		return fake.AddWithMetadataStub(infraNames, ip, endpointUpdatedAt, metadata)
+	}
+	if specificReturn {
+		return ret.result1
 	}
+	return fake.addWithMetadataReturns.result1
 }
 
-func (fake *AddressTable) AddCallCount() int {
-	fake.addMutex.RLock()
-	defer fake.addMutex.RUnlock()
-	return len(fake.addArgsForCall)
+func (fake *AddressTable) AddWithMetadataCallCount() int {
+	fake.addWithMetadataMutex.RLock()
+	defer fake.addWithMetadataMutex.RUnlock()
+	return len(fake.addWithMetadataArgsForCall)
 }
 
-func (fake *AddressTable) AddArgsForCall(i int) ([]string, string) {
-	fake.addMutex.RLock()
-	defer fake.addMutex.RUnlock()
-	return fake.addArgsForCall[i].infraNames, fake.addArgsForCall[i].ip
+func (fake *AddressTable) AddWithMetadataArgsForCall(i int) ([]string, string, int64, addresstable.Metadata) {
+	fake.addWithMetadataMutex.RLock()
+	defer fake.addWithMetadataMutex.RUnlock()
+	return fake.addWithMetadataArgsForCall[i].infraNames, fake.addWithMetadataArgsForCall[i].ip, fake.addWithMetadataArgsForCall[i].endpointUpdatedAt, fake.addWithMetadataArgsForCall[i].metadata
 }
 
-func (fake *AddressTable) Remove(infraNames []string, ip string) {
-	var infraNamesCopy []string
-	if infraNames != nil {
-		infraNamesCopy = make([]string, len(infraNames))
-		copy(infraNamesCopy, infraNames)
+func (fake *AddressTable) AddWithMetadataReturns(result1 int) {
+	fake.AddWithMetadataStub = nil
+	fake.addWithMetadataReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *AddressTable) AddWithMetadataReturnsOnCall(i int, result1 int) {
+	fake.AddWithMetadataStub = nil
+	if fake.addWithMetadataReturnsOnCall == nil {
+		fake.addWithMetadataReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.addWithMetadataReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *AddressTable) Apply(changes []addresstable.Change) []int {
+	var changesCopy []addresstable.Change
+	if changes != nil {
+		changesCopy = make([]addresstable.Change, len(changes))
+		copy(changesCopy, changes)
+	}
+	fake.applyMutex.Lock()
+	ret, specificReturn := fake.applyReturnsOnCall[len(fake.applyArgsForCall)]
+	fake.applyArgsForCall = append(fake.applyArgsForCall, struct {
+		changes []addresstable.Change
+	}{changesCopy})
+	fake.recordInvocation("Apply", []interface{}{changesCopy})
+	fake.applyMutex.Unlock()
+	if fake.ApplyStub != nil {
+		return fake.ApplyStub(changes)
 	}
-	fake.removeMutex.Lock()
-	fake.removeArgsForCall = append(fake.removeArgsForCall, struct {
-		infraNames []string
-		ip         string
-	}{infraNamesCopy, ip})
-	fake.recordInvocation("Remove", []interface{}{infraNamesCopy, ip})
-	fake.removeMutex.Unlock()
-	if fake.RemoveStub != nil {
-		fake.RemoveStub(infraNames, ip)
+	if specificReturn {
+		return ret.result1
 	}
+	return fake.applyReturns.result1
 }
 
-func (fake *AddressTable) RemoveCallCount() int {
-	fake.removeMutex.RLock()
-	defer fake.removeMutex.RUnlock()
-	return len(fake.removeArgsForCall)
+func (fake *AddressTable) ApplyCallCount() int {
+	fake.applyMutex.RLock()
+	defer fake.applyMutex.RUnlock()
+	return len(fake.applyArgsForCall)
 }
 
-func (fake *AddressTable) RemoveArgsForCall(i int) ([]string, string) {
-	fake.removeMutex.RLock()
-	defer fake.removeMutex.RUnlock()
-	return fake.removeArgsForCall[i].infraNames, fake.removeArgsForCall[i].ip
+func (fake *AddressTable) ApplyArgsForCall(i int) []addresstable.Change {
+	fake.applyMutex.RLock()
+	defer fake.applyMutex.RUnlock()
+	return fake.applyArgsForCall[i].changes
+}
+
+func (fake *AddressTable) ApplyReturns(result1 []int) {
+	fake.ApplyStub = nil
+	fake.applyReturns = struct {
+		result1 []int
+	}{result1}
+}
+
+func (fake *AddressTable) ApplyReturnsOnCall(i int, result1 []int) {
+	fake.ApplyStub = nil
+	if fake.applyReturnsOnCall == nil {
+		fake.applyReturnsOnCall = make(map[int]struct {
+			result1 []int
+		})
+	}
+	fake.applyReturnsOnCall[i] = struct {
+		result1 []int
+	}{result1}
 }
 
 func (fake *AddressTable) PausePruning() {
@@ -143,10 +206,10 @@ func (fake *AddressTable) SetWarmCallCount() int {
 func (fake *AddressTable) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.addMutex.RLock()
-	defer fake.addMutex.RUnlock()
-	fake.removeMutex.RLock()
-	defer fake.removeMutex.RUnlock()
+	fake.addWithMetadataMutex.RLock()
+	defer fake.addWithMetadataMutex.RUnlock()
+	fake.applyMutex.RLock()
+	defer fake.applyMutex.RUnlock()
 	fake.pausePruningMutex.RLock()
 	defer fake.pausePruningMutex.RUnlock()
 	fake.resumePruningMutex.RLock()
@@ -1,11 +1,58 @@
 package mbus
 
-import "github.com/nats-io/nats"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nats-io/nats"
+)
 
 type NatsConnWithUrlProvider struct {
-	Url string
+	Url       string
+	TLSConfig *tls.Config
 }
 
 func (p *NatsConnWithUrlProvider) Connection(opts ...nats.Option) (NatsConn, error) {
+	if p.TLSConfig != nil {
+		opts = append([]nats.Option{nats.Secure(p.TLSConfig)}, opts...)
+	}
 	return nats.Connect(p.Url, opts...)
 }
+
+// AcceptsTLS reports whether connections from this provider are encrypted.
+func (p *NatsConnWithUrlProvider) AcceptsTLS() bool {
+	return p.TLSConfig != nil
+}
+
+// NewNatsTLSConfig builds the TLS configuration for connecting to NATS. The
+// server certificate is verified against the CA and serverName, when set.
+// The client certificate is only presented when both its paths are set.
+func NewNatsTLSConfig(caPath, clientCertPath, clientKeyPath, serverName string) (*tls.Config, error) {
+	caPemBytes, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("read nats CA file: %s", err)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caPemBytes) {
+		return nil, fmt.Errorf("load nats CA file into cert pool")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    caCertPool,
+		ServerName: serverName,
+	}
+
+	if clientCertPath != "" && clientKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load nats client key pair: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.BuildNameToCertificate()
+	}
+
+	return tlsConfig, nil
+}
@@ -10,8 +10,13 @@ import (
 
 	"fmt"
 
+	"net"
+
 	"os"
 
+	"service-discovery-controller/addresstable"
+	"service-discovery-controller/routesource"
+
 	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 	"github.com/nats-io/nats"
@@ -19,7 +24,12 @@ import (
 )
 
 const (
-	registerMessagesReceived = "registerMessagesReceived"
+	registerMessagesReceived  = "registerMessagesReceived"
+	outOfOrderMessagesDropped = "outOfOrderMessagesDropped"
+	malformedMessagesRejected = "malformedMessagesRejected"
+	invalidIPMessagesRejected = "invalidIPMessagesRejected"
+	invalidHostnamesRejected  = "invalidHostnamesRejected"
+	externalHostnamesRejected = "externalHostnamesRejected"
 )
 
 type ServiceDiscoveryStartMessage struct {
@@ -27,6 +37,8 @@ type ServiceDiscoveryStartMessage struct {
 	Host                             string `json:"host"`
 	MinimumRegisterIntervalInSeconds int    `json:"minimumRegisterIntervalInSeconds"`
 	PruneThresholdInSeconds          int    `json:"pruneThresholdInSeconds"`
+	AcceptTLS                        bool   `json:"acceptTLS"`
+	BatchVersion                     int    `json:"batchVersion"`
 }
 
 type SubscriberOpts struct {
@@ -34,18 +46,67 @@ type SubscriberOpts struct {
 	MinimumRegisterIntervalInSeconds int
 	PruneThresholdInSeconds          int
 	AcceptTLS                        bool
+	InternalDomains                  []string
 }
 
 type RegistryMessage struct {
-	IP                string   `json:"host"`
-	InfraNames        []string `json:"uris"`
-	EndpointUpdatedAt int64    `json:"endpoint_updated_at_ns"`
+	IP                string            `json:"host"`
+	InfraNames        []string          `json:"uris"`
+	EndpointUpdatedAt int64             `json:"endpoint_updated_at_ns"`
+	Port              uint16            `json:"port"`
+	AppGUID           string            `json:"app_guid"`
+	ProcessGUID       string            `json:"process_guid"`
+	InstanceIndex     string            `json:"instance_index"`
+	AvailabilityZone  string            `json:"availability_zone"`
+	Tags              map[string]string `json:"tags"`
+}
+
+// BatchMessageVersion is the version of RegistryBatchMessage the subscriber
+// understands. It is advertised in the start message, so that route-emitters
+// only publish batches the subscriber can read.
+const BatchMessageVersion = 1
+
+// RegistryBatchMessage carries many register or unregister messages, which
+// are applied to the address table at once.
+type RegistryBatchMessage struct {
+	Version  int               `json:"version"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+func (m *RegistryMessage) Metadata() addresstable.Metadata {
+	return addresstable.Metadata{
+		Port:             m.Port,
+		AppGUID:          m.AppGUID,
+		ProcessGUID:      m.ProcessGUID,
+		InstanceIndex:    m.InstanceIndex,
+		AvailabilityZone: m.AvailabilityZone,
+		Tags:             m.Tags,
+		Source:           routesource.NATS,
+	}
+}
+
+// normalizeIP rewrites the IP in its canonical form, so that the same IPv6
+// address written in different ways maps to the same address table entry.
+// An empty IP is left as it is. Unspecified and multicast addresses are
+// rejected, as no instance can be reached on them.
+func (m *RegistryMessage) normalizeIP() bool {
+	if m.IP == "" {
+		return true
+	}
+
+	ip := net.ParseIP(m.IP)
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+
+	m.IP = ip.String()
+	return true
 }
 
 //go:generate counterfeiter -o fakes/address_table.go --fake-name AddressTable . AddressTable
 type AddressTable interface {
-	Add(infraNames []string, ip string)
-	Remove(infraNames []string, ip string)
+	AddWithMetadata(infraNames []string, ip string, endpointUpdatedAt int64, metadata addresstable.Metadata) int
+	Apply(changes []addresstable.Change) []int
 	PausePruning()
 	ResumePruning()
 	SetWarm()
@@ -63,6 +124,7 @@ type Subscriber struct {
 	once             sync.Once
 	metricsSender    metricsSender
 	clock            clock.Clock
+	warmAfter        <-chan struct{}
 }
 
 //go:generate counterfeiter -o fakes/nats_conn.go --fake-name NatsConn . NatsConn
@@ -113,6 +175,14 @@ func NewSubscriber(
 	}
 }
 
+// WarmAfter holds off declaring the table warm once the warming duration has
+// passed until done is closed as well, so that the table is not served while
+// a bootstrap is still merging in the routes of a peer. It must be called
+// before the subscriber is run.
+func (s *Subscriber) WarmAfter(done <-chan struct{}) {
+	s.warmAfter = done
+}
+
 func (s *Subscriber) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	err := s.RunOnce()
 	if err != nil {
@@ -201,6 +271,9 @@ func (s *Subscriber) RunOnce() error {
 
 		go func() {
 			<-s.clock.After(s.warmingDuration)
+			if s.warmAfter != nil {
+				<-s.warmAfter
+			}
 			s.table.SetWarm()
 		}()
 	})
@@ -230,6 +303,10 @@ func (s *Subscriber) sendStartMessage() error {
 	return nil
 }
 
+func (s *Subscriber) Name() string {
+	return routesource.NATS
+}
+
 func (s *Subscriber) Close() {
 	if s.natsClient != nil {
 		s.natsClient.Close()
@@ -268,22 +345,18 @@ func (s *Subscriber) setupGreetMsgHandler() error {
 
 func (s *Subscriber) setupAddressMessageHandler() error {
 	_, err := s.natsClient.Subscribe("service-discovery.register", nats.MsgHandler(func(msg *nats.Msg) {
-		registryMessage := &RegistryMessage{}
-		err := json.Unmarshal(msg.Data, registryMessage)
-		if err != nil || registryMessage.IP == "" || len(registryMessage.InfraNames) == 0 {
-			s.logger.Info("AddressMessageHandler received a malformed register message", lager.Data(map[string]interface{}{
-				"msgJson": string(msg.Data),
-			}))
+		registryMessage, ok := s.parseRegistryMessage("register", msg.Data)
+		if !ok {
 			return
 		}
 
-		s.recorder.RecordMessageTransitTime(registryMessage.EndpointUpdatedAt)
-		s.metricsSender.IncrementCounter(registerMessagesReceived)
-
 		s.logger.Debug("AddressMessageHandler register msg received", lager.Data(map[string]interface{}{
 			"msgJson": string(msg.Data),
 		}))
-		s.table.Add(registryMessage.InfraNames, registryMessage.IP)
+		dropped := s.table.AddWithMetadata(registryMessage.InfraNames, registryMessage.IP, registryMessage.EndpointUpdatedAt, registryMessage.Metadata())
+		if dropped > 0 {
+			s.dropOutOfOrderMessage("register", msg.Data)
+		}
 	}))
 
 	if err != nil {
@@ -292,18 +365,27 @@ func (s *Subscriber) setupAddressMessageHandler() error {
 	}
 
 	_, err = s.natsClient.Subscribe("service-discovery.unregister", nats.MsgHandler(func(msg *nats.Msg) {
-		registryMessage := &RegistryMessage{}
-		err := json.Unmarshal(msg.Data, registryMessage)
-		if err != nil || len(registryMessage.InfraNames) == 0 {
-			s.logger.Info("AddressMessageHandler received a malformed unregister message", lager.Data(map[string]interface{}{
-				"msgJson": string(msg.Data),
-			}))
+		registryMessage, ok := s.parseRegistryMessage("unregister", msg.Data)
+		if !ok {
 			return
 		}
+
 		s.logger.Debug("AddressMessageHandler unregister msg received", lager.Data(map[string]interface{}{
 			"msgJson": string(msg.Data),
 		}))
-		s.table.Remove(registryMessage.InfraNames, registryMessage.IP)
+		// Unregister through Apply so that only the register from NATS is
+		// taken back, and routes that another source registered are kept.
+		for _, dropped := range s.table.Apply([]addresstable.Change{{
+			Remove:            true,
+			Hostnames:         registryMessage.InfraNames,
+			IP:                registryMessage.IP,
+			EndpointUpdatedAt: registryMessage.EndpointUpdatedAt,
+			Metadata:          registryMessage.Metadata(),
+		}}) {
+			if dropped > 0 {
+				s.dropOutOfOrderMessage("unregister", msg.Data)
+			}
+		}
 	}))
 
 	if err != nil {
@@ -311,15 +393,158 @@ func (s *Subscriber) setupAddressMessageHandler() error {
 		return err
 	}
 
+	_, err = s.natsClient.Subscribe("service-discovery.register.batch", nats.MsgHandler(func(msg *nats.Msg) {
+		s.handleBatchMessage("register", msg)
+	}))
+
+	if err != nil {
+		s.logger.Error("setupAddressMessageHandler unable to subscribe to service-discovery.register.batch", err)
+		return err
+	}
+
+	_, err = s.natsClient.Subscribe("service-discovery.unregister.batch", nats.MsgHandler(func(msg *nats.Msg) {
+		s.handleBatchMessage("unregister", msg)
+	}))
+
+	if err != nil {
+		s.logger.Error("setupAddressMessageHandler unable to subscribe to service-discovery.unregister.batch", err)
+		return err
+	}
+
 	return nil
 }
 
+// handleBatchMessage applies every valid message of a batch with a single
+// address table mutation. Invalid messages are rejected one by one, as they
+// would be when published on their own.
+func (s *Subscriber) handleBatchMessage(messageType string, msg *nats.Msg) {
+	batch := &RegistryBatchMessage{}
+	err := json.Unmarshal(msg.Data, batch)
+	if err != nil || batch.Version != BatchMessageVersion {
+		s.rejectMalformedMessage(messageType+" batch", msg.Data)
+		return
+	}
+
+	changes := make([]addresstable.Change, 0, len(batch.Messages))
+	applied := make([]json.RawMessage, 0, len(batch.Messages))
+	for _, data := range batch.Messages {
+		registryMessage, ok := s.parseRegistryMessage(messageType, data)
+		if !ok {
+			continue
+		}
+
+		changes = append(changes, addresstable.Change{
+			Remove:            messageType == "unregister",
+			Hostnames:         registryMessage.InfraNames,
+			IP:                registryMessage.IP,
+			EndpointUpdatedAt: registryMessage.EndpointUpdatedAt,
+			Metadata:          registryMessage.Metadata(),
+		})
+		applied = append(applied, data)
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	s.logger.Debug("AddressMessageHandler "+messageType+" batch msg received", lager.Data(map[string]interface{}{
+		"messages": len(changes),
+	}))
+	for i, dropped := range s.table.Apply(changes) {
+		if dropped > 0 {
+			s.dropOutOfOrderMessage(messageType, applied[i])
+		}
+	}
+}
+
+// parseRegistryMessage decodes and validates a register or unregister
+// message, recording the transit time of registers. It returns false when
+// the message was rejected.
+func (s *Subscriber) parseRegistryMessage(messageType string, data []byte) (*RegistryMessage, bool) {
+	registryMessage := &RegistryMessage{}
+	err := json.Unmarshal(data, registryMessage)
+	if err != nil || (messageType == "register" && registryMessage.IP == "") {
+		s.rejectMalformedMessage(messageType, data)
+		return nil, false
+	}
+
+	if !s.validateRegistryMessage(messageType, registryMessage, data) {
+		return nil, false
+	}
+
+	if messageType == "register" {
+		s.recorder.RecordMessageTransitTime(registryMessage.EndpointUpdatedAt)
+		s.metricsSender.IncrementCounter(registerMessagesReceived)
+	}
+
+	return registryMessage, true
+}
+
+// validateRegistryMessage normalizes the IP of the message and drops the
+// hostnames that are not valid DNS names or not under one of the internal
+// domains, counting each rejection. It returns false when nothing is left of
+// the message to apply to the address table.
+func (s *Subscriber) validateRegistryMessage(messageType string, registryMessage *RegistryMessage, data []byte) bool {
+	if len(registryMessage.InfraNames) == 0 {
+		s.rejectMalformedMessage(messageType, data)
+		return false
+	}
+
+	if !registryMessage.normalizeIP() {
+		s.metricsSender.IncrementCounter(invalidIPMessagesRejected)
+		s.logger.Info("AddressMessageHandler received a malformed "+messageType+" message", lager.Data(map[string]interface{}{
+			"msgJson": string(data),
+		}))
+		return false
+	}
+
+	internalNames := make([]string, 0, len(registryMessage.InfraNames))
+	for _, name := range registryMessage.InfraNames {
+		if !routesource.ValidHostname(name) {
+			s.metricsSender.IncrementCounter(invalidHostnamesRejected)
+			s.logger.Debug("AddressMessageHandler dropped invalid hostname from "+messageType+" msg", lager.Data(map[string]interface{}{
+				"hostname": name,
+			}))
+			continue
+		}
+
+		if !routesource.InDomains(name, s.subOpts.InternalDomains) {
+			s.metricsSender.IncrementCounter(externalHostnamesRejected)
+			s.logger.Debug("AddressMessageHandler dropped external hostname from "+messageType+" msg", lager.Data(map[string]interface{}{
+				"hostname": name,
+			}))
+			continue
+		}
+
+		internalNames = append(internalNames, name)
+	}
+
+	registryMessage.InfraNames = internalNames
+	return len(internalNames) > 0
+}
+
+func (s *Subscriber) rejectMalformedMessage(messageType string, data []byte) {
+	s.metricsSender.IncrementCounter(malformedMessagesRejected)
+	s.logger.Info("AddressMessageHandler received a malformed "+messageType+" message", lager.Data(map[string]interface{}{
+		"msgJson": string(data),
+	}))
+}
+
+func (s *Subscriber) dropOutOfOrderMessage(messageType string, data []byte) {
+	s.metricsSender.IncrementCounter(outOfOrderMessagesDropped)
+	s.logger.Debug("AddressMessageHandler dropped out of order "+messageType+" msg", lager.Data(map[string]interface{}{
+		"msgJson": string(data),
+	}))
+}
+
 func (s *Subscriber) subscriptionOptionsJSON() []byte {
 	discoveryMessageJson, err := json.Marshal(ServiceDiscoveryStartMessage{
 		Id:   s.subOpts.ID,
 		Host: s.localIP,
 		MinimumRegisterIntervalInSeconds: s.subOpts.MinimumRegisterIntervalInSeconds,
 		PruneThresholdInSeconds:          s.subOpts.PruneThresholdInSeconds,
+		AcceptTLS:                        s.subOpts.AcceptTLS,
+		BatchVersion:                     BatchMessageVersion,
 	})
 
 	if err != nil {
@@ -4,9 +4,11 @@ import (
 	. "service-discovery-controller/mbus"
 
 	"encoding/json"
+	"strings"
 
 	"time"
 
+	"service-discovery-controller/addresstable"
 	"service-discovery-controller/mbus/fakes"
 
 	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
@@ -96,6 +98,28 @@ var _ = Describe("Subscriber", func() {
 		Eventually(addressTable.SetWarmCallCount).Should(Equal(1))
 	})
 
+	Context("when warming is held off until a bootstrap is done", func() {
+		var bootstrapDone chan struct{}
+
+		BeforeEach(func() {
+			subscriber.Close()
+			Eventually(startMsgChan).Should(Receive())
+
+			bootstrapDone = make(chan struct{})
+			subscriber = NewSubscriber(provider, subOpts, warmingDuration, addressTable, localIP, messageRecorder, subcriberLogger, metricsSender, fakeClock)
+			subscriber.WarmAfter(bootstrapDone)
+			Expect(subscriber.RunOnce()).To(Succeed())
+		})
+
+		It("notifies the address table it is warm only once the bootstrap is done", func() {
+			fakeClock.Increment(warmingDuration + time.Second)
+			Consistently(addressTable.SetWarmCallCount).Should(Equal(0))
+
+			close(bootstrapDone)
+			Eventually(addressTable.SetWarmCallCount).Should(Equal(1))
+		})
+	})
+
 	It("sends a start message and logs", func() {
 		var msg *nats.Msg
 		var serviceDiscoveryData ServiceDiscoveryStartMessage
@@ -111,6 +135,8 @@ var _ = Describe("Subscriber", func() {
 		Expect(serviceDiscoveryData.MinimumRegisterIntervalInSeconds).To(Equal(subOpts.MinimumRegisterIntervalInSeconds))
 		Expect(serviceDiscoveryData.PruneThresholdInSeconds).To(Equal(subOpts.PruneThresholdInSeconds))
 		Expect(serviceDiscoveryData.Host).ToNot(BeEmpty())
+		Expect(serviceDiscoveryData.AcceptTLS).To(BeFalse())
+		Expect(serviceDiscoveryData.BatchVersion).To(Equal(BatchMessageVersion))
 
 		Eventually(subcriberLogger).Should(HaveLogged(
 			Info(
@@ -118,6 +144,26 @@ var _ = Describe("Subscriber", func() {
 			)))
 	})
 
+	Context("when the subscriber accepts TLS", func() {
+		BeforeEach(func() {
+			subscriber.Close()
+			Eventually(startMsgChan).Should(Receive())
+
+			subOpts.AcceptTLS = true
+			subscriber = NewSubscriber(provider, subOpts, warmingDuration, addressTable, localIP, messageRecorder, subcriberLogger, metricsSender, fakeClock)
+			Expect(subscriber.RunOnce()).To(Succeed())
+		})
+
+		It("advertises it in the start message", func() {
+			var msg *nats.Msg
+			var serviceDiscoveryData ServiceDiscoveryStartMessage
+
+			Eventually(startMsgChan, 4).Should(Receive(&msg))
+			Expect(json.Unmarshal(msg.Data, &serviceDiscoveryData)).To(Succeed())
+			Expect(serviceDiscoveryData.AcceptTLS).To(BeTrue())
+		})
+	})
+
 	It("when a greeting message is received it responds and logs", func() {
 		Expect(fakeRouteEmitter.PublishRequest("service-discovery.greet", "service-discovery.greet.test.response", []byte{})).To(Succeed())
 		Expect(fakeRouteEmitter.Flush()).To(Succeed())
@@ -262,13 +308,65 @@ var _ = Describe("Subscriber", func() {
 
 			Eventually(func() int {
 				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
-				return addressTable.AddCallCount()
+				return addressTable.AddWithMetadataCallCount()
 			}).Should(Equal(1))
 
-			hostnames, ip := addressTable.AddArgsForCall(0)
+			hostnames, ip, endpointUpdatedAt, metadata := addressTable.AddWithMetadataArgsForCall(0)
 
 			Expect(hostnames).To(Equal([]string{"foo.com", "0.foo.com"}))
 			Expect(ip).To(Equal("192.168.0.1"))
+			Expect(endpointUpdatedAt).To(BeZero())
+			Expect(metadata).To(Equal(addresstable.Metadata{Source: "nats"}))
+		})
+
+		It("should write IPv6 addresses to the address table in canonical form", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data: []byte(`{
+					"host": "FD00:0:0::0001",
+					"uris": ["foo.com"]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return addressTable.AddWithMetadataCallCount()
+			}).Should(Equal(1))
+
+			_, ip, _, _ := addressTable.AddWithMetadataArgsForCall(0)
+			Expect(ip).To(Equal("fd00::1"))
+		})
+
+		It("should write the instance metadata to the address table", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data: []byte(`{
+					"host": "192.168.0.1",
+					"uris": ["foo.com"],
+					"port": 8080,
+					"app_guid": "some-app-guid",
+					"process_guid": "some-process-guid",
+					"instance_index": "2",
+					"availability_zone": "z1",
+					"tags": {"component": "api"}
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return addressTable.AddWithMetadataCallCount()
+			}).Should(Equal(1))
+
+			_, _, _, metadata := addressTable.AddWithMetadataArgsForCall(0)
+			Expect(metadata).To(Equal(addresstable.Metadata{
+				Port:             8080,
+				AppGUID:          "some-app-guid",
+				ProcessGUID:      "some-process-guid",
+				InstanceIndex:    "2",
+				AvailabilityZone: "z1",
+				Tags:             map[string]string{"component": "api"},
+				Source:           "nats",
+			}))
 		})
 
 		It("should record the time it took to get from BBS to the SDC", func() {
@@ -327,7 +425,7 @@ var _ = Describe("Subscriber", func() {
 						Data("msgJson", json),
 					)))
 
-				Expect(addressTable.AddCallCount()).To(Equal(0))
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
 			})
 		})
 
@@ -350,7 +448,31 @@ var _ = Describe("Subscriber", func() {
 						Data("msgJson", json),
 					)))
 
-				Expect(addressTable.AddCallCount()).To(Equal(0))
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a registration message contains an invalid ip", func() {
+			It("should not add", func() {
+				json := `{
+					"host": "not-an-ip",
+					"uris": ["foo.com", "0.foo.com"]
+				}`
+				natsRegistryMsg := nats.Msg{
+					Subject: "service-discovery.register",
+					Data:    []byte(json),
+				}
+
+				Eventually(func() lager.Logger {
+					fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+					return subcriberLogger
+				}).Should(HaveLogged(
+					Info(
+						Message("test.AddressMessageHandler received a malformed register message"),
+						Data("msgJson", json),
+					)))
+
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
 			})
 		})
 
@@ -373,11 +495,197 @@ var _ = Describe("Subscriber", func() {
 						Data("msgJson", json),
 					)))
 
-				Expect(addressTable.AddCallCount()).To(Equal(0))
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
 			})
 		})
 	})
 
+	Context("when a registration message contains an unspecified ip", func() {
+		It("should not add and counts the rejection", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data: []byte(`{
+					"host": "0.0.0.0",
+					"uris": ["foo.com"]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return metricsSender.IncrementCounterCallCount()
+			}).Should(BeNumerically(">", 0))
+
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("invalidIPMessagesRejected"))
+			Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a malformed registration message is received", func() {
+		It("counts the rejection", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data:    []byte(`garbage`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return metricsSender.IncrementCounterCallCount()
+			}).Should(BeNumerically(">", 0))
+
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("malformedMessagesRejected"))
+		})
+	})
+
+	Context("when a registration message contains invalid hostnames", func() {
+		It("adds only the valid hostnames and counts each invalid one", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data: []byte(`{
+					"host": "192.168.0.1",
+					"uris": ["foo.com.", "foo_bar.com", "-foo.com", "foo..com", "` + strings.Repeat("a", 64) + `.com"]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return addressTable.AddWithMetadataCallCount()
+			}).Should(Equal(1))
+
+			hostnames, _, _, _ := addressTable.AddWithMetadataArgsForCall(0)
+			Expect(hostnames).To(Equal([]string{"foo.com."}))
+
+			for i := 0; i < 4; i++ {
+				Expect(metricsSender.IncrementCounterArgsForCall(i)).To(Equal("invalidHostnamesRejected"))
+			}
+		})
+
+		Context("when none of the hostnames are valid", func() {
+			It("should not add", func() {
+				natsRegistryMsg := nats.Msg{
+					Subject: "service-discovery.register",
+					Data: []byte(`{
+						"host": "192.168.0.1",
+						"uris": ["foo bar.com"]
+					}`),
+				}
+
+				Eventually(func() int {
+					fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+					return metricsSender.IncrementCounterCallCount()
+				}).Should(BeNumerically(">", 0))
+
+				Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("invalidHostnamesRejected"))
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when internal domains are configured", func() {
+		BeforeEach(func() {
+			subscriber.Close()
+			subOpts.InternalDomains = []string{"apps.internal.", "Platform.Internal"}
+			subscriber = NewSubscriber(provider, subOpts, warmingDuration, addressTable, localIP, messageRecorder, subcriberLogger, metricsSender, fakeClock)
+			Expect(subscriber.RunOnce()).To(Succeed())
+		})
+
+		It("adds only the hostnames under those domains and counts the others", func() {
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data: []byte(`{
+					"host": "192.168.0.1",
+					"uris": ["app.apps.internal", "app.example.com", "api.platform.internal.", "apps.internal", "app.notapps.internal"]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return addressTable.AddWithMetadataCallCount()
+			}).Should(Equal(1))
+
+			hostnames, _, _, _ := addressTable.AddWithMetadataArgsForCall(0)
+			Expect(hostnames).To(Equal([]string{"app.apps.internal", "api.platform.internal."}))
+
+			for i := 0; i < 3; i++ {
+				Expect(metricsSender.IncrementCounterArgsForCall(i)).To(Equal("externalHostnamesRejected"))
+			}
+			Expect(metricsSender.IncrementCounterArgsForCall(3)).To(Equal("registerMessagesReceived"))
+		})
+
+		It("removes only the hostnames under those domains", func() {
+			natsUnRegisterMsg := nats.Msg{
+				Subject: "service-discovery.unregister",
+				Data: []byte(`{
+					"host": "192.168.0.1",
+					"uris": ["app.example.com", "app.apps.internal"]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsUnRegisterMsg)
+				return addressTable.ApplyCallCount()
+			}).Should(Equal(1))
+
+			changes := addressTable.ApplyArgsForCall(0)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Hostnames).To(Equal([]string{"app.apps.internal"}))
+		})
+
+		Context("when none of the hostnames are under those domains", func() {
+			It("should not add", func() {
+				natsRegistryMsg := nats.Msg{
+					Subject: "service-discovery.register",
+					Data: []byte(`{
+						"host": "192.168.0.1",
+						"uris": ["app.example.com"]
+					}`),
+				}
+
+				Eventually(func() int {
+					fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+					return metricsSender.IncrementCounterCallCount()
+				}).Should(BeNumerically(">", 0))
+
+				Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("externalHostnamesRejected"))
+				Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the address table drops a registration message as out of order", func() {
+		BeforeEach(func() {
+			addressTable.AddWithMetadataReturns(1)
+		})
+
+		It("increments the dropped messages counter and logs the message", func() {
+			json := `{
+				"host": "192.168.0.1",
+				"uris": ["foo.com"],
+				"endpoint_updated_at_ns": 200
+			}`
+			natsRegistryMsg := nats.Msg{
+				Subject: "service-discovery.register",
+				Data:    []byte(json),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsRegistryMsg)
+				return addressTable.AddWithMetadataCallCount()
+			}).Should(Equal(1))
+
+			_, _, endpointUpdatedAt, _ := addressTable.AddWithMetadataArgsForCall(0)
+			Expect(endpointUpdatedAt).To(Equal(int64(200)))
+
+			Eventually(metricsSender.IncrementCounterCallCount).Should(Equal(2))
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("registerMessagesReceived"))
+			Expect(metricsSender.IncrementCounterArgsForCall(1)).To(Equal("outOfOrderMessagesDropped"))
+			Expect(subcriberLogger).To(HaveLogged(
+				Debug(
+					Message("test.AddressMessageHandler dropped out of order register msg"),
+					Data("msgJson", json),
+				)))
+		})
+	})
+
 	Context("when an unregister message is received", func() {
 		It("should remove it from the address table", func() {
 			natsUnRegisterMsg := nats.Msg{
@@ -390,12 +698,56 @@ var _ = Describe("Subscriber", func() {
 
 			Eventually(func() int {
 				fakeRouteEmitter.PublishMsg(&natsUnRegisterMsg)
-				return addressTable.RemoveCallCount()
+				return addressTable.ApplyCallCount()
+			}).Should(Equal(1))
+
+			Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{
+				{Remove: true, Hostnames: []string{"foo.com", "0.foo.com"}, IP: "192.168.0.1", Metadata: addresstable.Metadata{Source: "nats"}},
+			}))
+		})
+
+		It("should pass the endpoint update time to the address table", func() {
+			natsUnRegisterMsg := nats.Msg{
+				Subject: "service-discovery.unregister",
+				Data: []byte(`{
+					"host": "192.168.0.1",
+					"uris": ["foo.com"],
+					"endpoint_updated_at_ns": 200
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsUnRegisterMsg)
+				return addressTable.ApplyCallCount()
 			}).Should(Equal(1))
 
-			uris, host := addressTable.RemoveArgsForCall(0)
-			Expect(uris).To(Equal([]string{"foo.com", "0.foo.com"}))
-			Expect(host).To(Equal("192.168.0.1"))
+			changes := addressTable.ApplyArgsForCall(0)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].EndpointUpdatedAt).To(Equal(int64(200)))
+		})
+
+		Context("when the address table drops the message as out of order", func() {
+			BeforeEach(func() {
+				addressTable.ApplyReturns([]int{1})
+			})
+
+			It("increments the dropped messages counter", func() {
+				natsUnRegisterMsg := nats.Msg{
+					Subject: "service-discovery.unregister",
+					Data: []byte(`{
+						"host": "192.168.0.1",
+						"uris": ["foo.com"],
+						"endpoint_updated_at_ns": 200
+					}`),
+				}
+
+				Eventually(func() int {
+					fakeRouteEmitter.PublishMsg(&natsUnRegisterMsg)
+					return metricsSender.IncrementCounterCallCount()
+				}).Should(Equal(1))
+
+				Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("outOfOrderMessagesDropped"))
+			})
 		})
 
 		It("should log the message", func() {
@@ -436,7 +788,7 @@ var _ = Describe("Subscriber", func() {
 						Data("msgJson", json),
 					)))
 
-				Expect(addressTable.RemoveCallCount()).To(Equal(0))
+				Expect(addressTable.ApplyCallCount()).To(Equal(0))
 			})
 		})
 
@@ -452,10 +804,12 @@ var _ = Describe("Subscriber", func() {
 
 				Eventually(func() int {
 					fakeRouteEmitter.PublishMsg(&natsUnRegisterMsg)
-					return addressTable.RemoveCallCount()
+					return addressTable.ApplyCallCount()
 				}).Should(BeNumerically(">", 0))
 
-				Expect(addressTable.RemoveArgsForCall(0)).To(Equal([]string{"foo.com", "0.foo.com"}))
+				changes := addressTable.ApplyArgsForCall(0)
+				Expect(changes).To(HaveLen(1))
+				Expect(changes[0].Hostnames).To(Equal([]string{"foo.com", "0.foo.com"}))
 			})
 		})
 
@@ -476,11 +830,141 @@ var _ = Describe("Subscriber", func() {
 						Data("msgJson", json),
 					)))
 
-				Expect(addressTable.RemoveCallCount()).To(Equal(0))
+				Expect(addressTable.ApplyCallCount()).To(Equal(0))
 			})
 		})
 	})
 
+	Context("when a register batch message is received", func() {
+		It("applies every message to the address table at once", func() {
+			natsBatchMsg := nats.Msg{
+				Subject: "service-discovery.register.batch",
+				Data: []byte(`{
+					"version": 1,
+					"messages": [
+						{"host": "192.168.0.1", "uris": ["foo.com"], "port": 8080, "endpoint_updated_at_ns": 200},
+						{"host": "192.168.0.2", "uris": ["foo.com", "bar.com"]}
+					]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsBatchMsg)
+				return addressTable.ApplyCallCount()
+			}).Should(BeNumerically(">", 0))
+
+			Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{
+				{Hostnames: []string{"foo.com"}, IP: "192.168.0.1", EndpointUpdatedAt: 200, Metadata: addresstable.Metadata{Port: 8080, Source: "nats"}},
+				{Hostnames: []string{"foo.com", "bar.com"}, IP: "192.168.0.2", Metadata: addresstable.Metadata{Source: "nats"}},
+			}))
+			Expect(addressTable.AddWithMetadataCallCount()).To(Equal(0))
+			Expect(messageRecorder.RecordMessageTransitTimeArgsForCall(0)).To(Equal(int64(200)))
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("registerMessagesReceived"))
+			Expect(metricsSender.IncrementCounterArgsForCall(1)).To(Equal("registerMessagesReceived"))
+		})
+
+		It("rejects the invalid messages and applies the rest", func() {
+			natsBatchMsg := nats.Msg{
+				Subject: "service-discovery.register.batch",
+				Data: []byte(`{
+					"version": 1,
+					"messages": [
+						{"uris": ["foo.com"]},
+						{"host": "not-an-ip", "uris": ["foo.com"]},
+						{"host": "192.168.0.2", "uris": ["bar.com"]}
+					]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsBatchMsg)
+				return addressTable.ApplyCallCount()
+			}).Should(BeNumerically(">", 0))
+
+			Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{
+				{Hostnames: []string{"bar.com"}, IP: "192.168.0.2", Metadata: addresstable.Metadata{Source: "nats"}},
+			}))
+			Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("malformedMessagesRejected"))
+			Expect(metricsSender.IncrementCounterArgsForCall(1)).To(Equal("invalidIPMessagesRejected"))
+		})
+
+		Context("when the batch has an unknown version", func() {
+			It("rejects the whole batch", func() {
+				json := `{"version": 2, "messages": [{"host": "192.168.0.1", "uris": ["foo.com"]}]}`
+				natsBatchMsg := nats.Msg{
+					Subject: "service-discovery.register.batch",
+					Data:    []byte(json),
+				}
+
+				Eventually(func() lager.Logger {
+					fakeRouteEmitter.PublishMsg(&natsBatchMsg)
+					return subcriberLogger
+				}).Should(HaveLogged(
+					Info(
+						Message("test.AddressMessageHandler received a malformed register batch message"),
+						Data("msgJson", json),
+					)))
+
+				Expect(metricsSender.IncrementCounterArgsForCall(0)).To(Equal("malformedMessagesRejected"))
+				Expect(addressTable.ApplyCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the address table drops some of the messages as out of order", func() {
+			BeforeEach(func() {
+				addressTable.ApplyReturns([]int{0, 1})
+			})
+
+			It("counts and logs each dropped message", func() {
+				droppedJson := `{"host": "192.168.0.2", "uris": ["foo.com"], "endpoint_updated_at_ns": 100}`
+				natsBatchMsg := nats.Msg{
+					Subject: "service-discovery.register.batch",
+					Data:    []byte(`{"version": 1, "messages": [{"host": "192.168.0.1", "uris": ["foo.com"]}, ` + droppedJson + `]}`),
+				}
+
+				Eventually(func() int {
+					fakeRouteEmitter.PublishMsg(&natsBatchMsg)
+					return addressTable.ApplyCallCount()
+				}).Should(BeNumerically(">", 0))
+
+				Eventually(metricsSender.IncrementCounterCallCount).Should(BeNumerically(">=", 3))
+				Expect(metricsSender.IncrementCounterArgsForCall(2)).To(Equal("outOfOrderMessagesDropped"))
+				Expect(subcriberLogger).To(HaveLogged(
+					Debug(
+						Message("test.AddressMessageHandler dropped out of order register msg"),
+						Data("msgJson", droppedJson),
+					)))
+			})
+		})
+	})
+
+	Context("when an unregister batch message is received", func() {
+		It("removes every message from the address table at once", func() {
+			natsBatchMsg := nats.Msg{
+				Subject: "service-discovery.unregister.batch",
+				Data: []byte(`{
+					"version": 1,
+					"messages": [
+						{"host": "192.168.0.1", "uris": ["foo.com"], "endpoint_updated_at_ns": 200},
+						{"uris": ["bar.com"]}
+					]
+				}`),
+			}
+
+			Eventually(func() int {
+				fakeRouteEmitter.PublishMsg(&natsBatchMsg)
+				return addressTable.ApplyCallCount()
+			}).Should(BeNumerically(">", 0))
+
+			Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{
+				{Remove: true, Hostnames: []string{"foo.com"}, IP: "192.168.0.1", EndpointUpdatedAt: 200, Metadata: addresstable.Metadata{Source: "nats"}},
+				{Remove: true, Hostnames: []string{"bar.com"}, Metadata: addresstable.Metadata{Source: "nats"}},
+			}))
+			Expect(addressTable.ApplyCallCount()).To(Equal(1))
+			Expect(messageRecorder.RecordMessageTransitTimeCallCount()).To(Equal(0))
+		})
+	})
+
 	Describe("Edge error cases", func() {
 		var (
 			natsConn *fakes.NatsConn
@@ -635,6 +1119,27 @@ var _ = Describe("Subscriber", func() {
 			})
 		})
 
+		Context("when calling run and subscribing to register batches fails", func() {
+			BeforeEach(func() {
+				natsConn.PublishMsgReturnsOnCall(0, nil)
+				natsConn.SubscribeReturnsOnCall(3, nil, errors.New("NO SUBSCRIBE when register batch"))
+
+				subscriber = NewSubscriber(provider, subOpts, warmingDuration, addressTable, localIP, messageRecorder, subcriberLogger, metricsSender, fakeClock)
+			})
+
+			It("returns an error and logs it", func() {
+				err := subscriber.RunOnce()
+				Expect(err).To(MatchError("NO SUBSCRIBE when register batch"))
+				Expect(natsConn.CloseCallCount()).To(Equal(1))
+
+				Expect(subcriberLogger).To(HaveLogged(
+					Error(
+						err,
+						Message("test.setupAddressMessageHandler unable to subscribe to service-discovery.register.batch"),
+					)))
+			})
+		})
+
 		Context("when sending a greet message and fails to flush", func() {
 			BeforeEach(func() {
 				provider.ConnectionReturns(natsConn, nil)
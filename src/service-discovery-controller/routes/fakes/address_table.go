@@ -2,30 +2,31 @@
 package fakes
 
 import (
+	"service-discovery-controller/addresstable"
 	"service-discovery-controller/routes"
 	"sync"
 )
 
 type AddressTable struct {
-	LookupStub        func(hostname string) []string
-	lookupMutex       sync.RWMutex
-	lookupArgsForCall []struct {
+	LookupEndpointsStub        func(hostname string) []addresstable.Endpoint
+	lookupEndpointsMutex       sync.RWMutex
+	lookupEndpointsArgsForCall []struct {
 		hostname string
 	}
-	lookupReturns struct {
-		result1 []string
+	lookupEndpointsReturns struct {
+		result1 []addresstable.Endpoint
 	}
-	lookupReturnsOnCall map[int]struct {
-		result1 []string
+	lookupEndpointsReturnsOnCall map[int]struct {
+		result1 []addresstable.Endpoint
 	}
-	GetAllAddressesStub        func() map[string][]string
-	getAllAddressesMutex       sync.RWMutex
-	getAllAddressesArgsForCall []struct{}
-	getAllAddressesReturns     struct {
-		result1 map[string][]string
+	GetAllEndpointsStub        func() map[string][]addresstable.Endpoint
+	getAllEndpointsMutex       sync.RWMutex
+	getAllEndpointsArgsForCall []struct{}
+	getAllEndpointsReturns     struct {
+		result1 map[string][]addresstable.Endpoint
 	}
-	getAllAddressesReturnsOnCall map[int]struct {
-		result1 map[string][]string
+	getAllEndpointsReturnsOnCall map[int]struct {
+		result1 map[string][]addresstable.Endpoint
 	}
 	IsWarmStub        func() bool
 	isWarmMutex       sync.RWMutex
@@ -36,95 +37,163 @@ type AddressTable struct {
 	isWarmReturnsOnCall map[int]struct {
 		result1 bool
 	}
+	RevisionStub        func() uint64
+	revisionMutex       sync.RWMutex
+	revisionArgsForCall []struct{}
+	revisionReturns     struct {
+		result1 uint64
+	}
+	revisionReturnsOnCall map[int]struct {
+		result1 uint64
+	}
+	EventsSinceStub        func(revision uint64) ([]addresstable.Event, uint64, <-chan struct{}, error)
+	eventsSinceMutex       sync.RWMutex
+	eventsSinceArgsForCall []struct {
+		revision uint64
+	}
+	eventsSinceReturns struct {
+		result1 []addresstable.Event
+		result2 uint64
+		result3 <-chan struct{}
+		result4 error
+	}
+	eventsSinceReturnsOnCall map[int]struct {
+		result1 []addresstable.Event
+		result2 uint64
+		result3 <-chan struct{}
+		result4 error
+	}
+	PruningStatusStub        func() addresstable.PruningStatus
+	pruningStatusMutex       sync.RWMutex
+	pruningStatusArgsForCall []struct{}
+	pruningStatusReturns     struct {
+		result1 addresstable.PruningStatus
+	}
+	pruningStatusReturnsOnCall map[int]struct {
+		result1 addresstable.PruningStatus
+	}
+	KnownStub        func(hostname string) bool
+	knownMutex       sync.RWMutex
+	knownArgsForCall []struct {
+		hostname string
+	}
+	knownReturns struct {
+		result1 bool
+	}
+	knownReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	LookupHostnamesStub        func(ip string) []string
+	lookupHostnamesMutex       sync.RWMutex
+	lookupHostnamesArgsForCall []struct {
+		ip string
+	}
+	lookupHostnamesReturns struct {
+		result1 []string
+	}
+	lookupHostnamesReturnsOnCall map[int]struct {
+		result1 []string
+	}
+	MarshalSnapshotStub        func() ([]byte, error)
+	marshalSnapshotMutex       sync.RWMutex
+	marshalSnapshotArgsForCall []struct{}
+	marshalSnapshotReturns     struct {
+		result1 []byte
+		result2 error
+	}
+	marshalSnapshotReturnsOnCall map[int]struct {
+		result1 []byte
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *AddressTable) Lookup(hostname string) []string {
-	fake.lookupMutex.Lock()
-	ret, specificReturn := fake.lookupReturnsOnCall[len(fake.lookupArgsForCall)]
-	fake.lookupArgsForCall = append(fake.lookupArgsForCall, struct {
+func (fake *AddressTable) LookupEndpoints(hostname string) []addresstable.Endpoint {
+	fake.lookupEndpointsMutex.Lock()
+	ret, specificReturn := fake.lookupEndpointsReturnsOnCall[len(fake.lookupEndpointsArgsForCall)]
+	fake.lookupEndpointsArgsForCall = append(fake.lookupEndpointsArgsForCall, struct {
 		hostname string
 	}{hostname})
-	fake.recordInvocation("Lookup", []interface{}{hostname})
-	fake.lookupMutex.Unlock()
-	if fake.LookupStub != nil {
-		return fake.LookupStub(hostname)
+	fake.recordInvocation("LookupEndpoints", []interface{}{hostname})
+	fake.lookupEndpointsMutex.Unlock()
+	if fake.LookupEndpointsStub != nil {
+		return fake.LookupEndpointsStub(hostname)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	return fake.lookupReturns.result1
+	return fake.lookupEndpointsReturns.result1
 }
 
-func (fake *AddressTable) LookupCallCount() int {
-	fake.lookupMutex.RLock()
-	defer fake.lookupMutex.RUnlock()
-	return len(fake.lookupArgsForCall)
+func (fake *AddressTable) LookupEndpointsCallCount() int {
+	fake.lookupEndpointsMutex.RLock()
+	defer fake.lookupEndpointsMutex.RUnlock()
+	return len(fake.lookupEndpointsArgsForCall)
 }
 
-func (fake *AddressTable) LookupArgsForCall(i int) string {
-	fake.lookupMutex.RLock()
-	defer fake.lookupMutex.RUnlock()
-	return fake.lookupArgsForCall[i].hostname
+func (fake *AddressTable) LookupEndpointsArgsForCall(i int) string {
+	fake.lookupEndpointsMutex.RLock()
+	defer fake.lookupEndpointsMutex.RUnlock()
+	return fake.lookupEndpointsArgsForCall[i].hostname
 }
 
-func (fake *AddressTable) LookupReturns(result1 []string) {
-	fake.LookupStub = nil
-	fake.lookupReturns = struct {
-		result1 []string
+func (fake *AddressTable) LookupEndpointsReturns(result1 []addresstable.Endpoint) {
+	fake.LookupEndpointsStub = nil
+	fake.lookupEndpointsReturns = struct {
+		result1 []addresstable.Endpoint
 	}{result1}
 }
 
-func (fake *AddressTable) LookupReturnsOnCall(i int, result1 []string) {
-	fake.LookupStub = nil
-	if fake.lookupReturnsOnCall == nil {
-		fake.lookupReturnsOnCall = make(map[int]struct {
-			result1 []string
+func (fake *AddressTable) LookupEndpointsReturnsOnCall(i int, result1 []addresstable.Endpoint) {
+	fake.LookupEndpointsStub = nil
+	if fake.lookupEndpointsReturnsOnCall == nil {
+		fake.lookupEndpointsReturnsOnCall = make(map[int]struct {
+			result1 []addresstable.Endpoint
 		})
 	}
-	fake.lookupReturnsOnCall[i] = struct {
-		result1 []string
+	fake.lookupEndpointsReturnsOnCall[i] = struct {
+		result1 []addresstable.Endpoint
 	}{result1}
 }
 
-func (fake *AddressTable) GetAllAddresses() map[string][]string {
-	fake.getAllAddressesMutex.Lock()
-	ret, specificReturn := fake.getAllAddressesReturnsOnCall[len(fake.getAllAddressesArgsForCall)]
-	fake.getAllAddressesArgsForCall = append(fake.getAllAddressesArgsForCall, struct{}{})
-	fake.recordInvocation("GetAllAddresses", []interface{}{})
-	fake.getAllAddressesMutex.Unlock()
-	if fake.GetAllAddressesStub != nil {
-		return fake.GetAllAddressesStub()
+func (fake *AddressTable) GetAllEndpoints() map[string][]addresstable.Endpoint {
+	fake.getAllEndpointsMutex.Lock()
+	ret, specificReturn := fake.getAllEndpointsReturnsOnCall[len(fake.getAllEndpointsArgsForCall)]
+	fake.getAllEndpointsArgsForCall = append(fake.getAllEndpointsArgsForCall, struct{}{})
+	fake.recordInvocation("GetAllEndpoints", []interface{}{})
+	fake.getAllEndpointsMutex.Unlock()
+	if fake.GetAllEndpointsStub != nil {
+		return fake.GetAllEndpointsStub()
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	return fake.getAllAddressesReturns.result1
+	return fake.getAllEndpointsReturns.result1
 }
 
-func (fake *AddressTable) GetAllAddressesCallCount() int {
-	fake.getAllAddressesMutex.RLock()
-	defer fake.getAllAddressesMutex.RUnlock()
-	return len(fake.getAllAddressesArgsForCall)
+func (fake *AddressTable) GetAllEndpointsCallCount() int {
+	fake.getAllEndpointsMutex.RLock()
+	defer fake.getAllEndpointsMutex.RUnlock()
+	return len(fake.getAllEndpointsArgsForCall)
 }
 
-func (fake *AddressTable) GetAllAddressesReturns(result1 map[string][]string) {
-	fake.GetAllAddressesStub = nil
-	fake.getAllAddressesReturns = struct {
-		result1 map[string][]string
+func (fake *AddressTable) GetAllEndpointsReturns(result1 map[string][]addresstable.Endpoint) {
+	fake.GetAllEndpointsStub = nil
+	fake.getAllEndpointsReturns = struct {
+		result1 map[string][]addresstable.Endpoint
 	}{result1}
 }
 
-func (fake *AddressTable) GetAllAddressesReturnsOnCall(i int, result1 map[string][]string) {
-	fake.GetAllAddressesStub = nil
-	if fake.getAllAddressesReturnsOnCall == nil {
-		fake.getAllAddressesReturnsOnCall = make(map[int]struct {
-			result1 map[string][]string
+func (fake *AddressTable) GetAllEndpointsReturnsOnCall(i int, result1 map[string][]addresstable.Endpoint) {
+	fake.GetAllEndpointsStub = nil
+	if fake.getAllEndpointsReturnsOnCall == nil {
+		fake.getAllEndpointsReturnsOnCall = make(map[int]struct {
+			result1 map[string][]addresstable.Endpoint
 		})
 	}
-	fake.getAllAddressesReturnsOnCall[i] = struct {
-		result1 map[string][]string
+	fake.getAllEndpointsReturnsOnCall[i] = struct {
+		result1 map[string][]addresstable.Endpoint
 	}{result1}
 }
 
@@ -168,15 +237,303 @@ func (fake *AddressTable) IsWarmReturnsOnCall(i int, result1 bool) {
 	}{result1}
 }
 
+func (fake *AddressTable) Revision() uint64 {
+	fake.revisionMutex.Lock()
+	ret, specificReturn := fake.revisionReturnsOnCall[len(fake.revisionArgsForCall)]
+	fake.revisionArgsForCall = append(fake.revisionArgsForCall, struct{}{})
+	fake.recordInvocation("Revision", []interface{}{})
+	fake.revisionMutex.Unlock()
+	if fake.RevisionStub != nil {
+		return fake.RevisionStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.revisionReturns.result1
+}
+
+func (fake *AddressTable) RevisionCallCount() int {
+	fake.revisionMutex.RLock()
+	defer fake.revisionMutex.RUnlock()
+	return len(fake.revisionArgsForCall)
+}
+
+func (fake *AddressTable) RevisionReturns(result1 uint64) {
+	fake.RevisionStub = nil
+	fake.revisionReturns = struct {
+		result1 uint64
+	}{result1}
+}
+
+func (fake *AddressTable) RevisionReturnsOnCall(i int, result1 uint64) {
+	fake.RevisionStub = nil
+	if fake.revisionReturnsOnCall == nil {
+		fake.revisionReturnsOnCall = make(map[int]struct {
+			result1 uint64
+		})
+	}
+	fake.revisionReturnsOnCall[i] = struct {
+		result1 uint64
+	}{result1}
+}
+
+func (fake *AddressTable) EventsSince(revision uint64) ([]addresstable.Event, uint64, <-chan struct{}, error) {
+	fake.eventsSinceMutex.Lock()
+	ret, specificReturn := fake.eventsSinceReturnsOnCall[len(fake.eventsSinceArgsForCall)]
+	fake.eventsSinceArgsForCall = append(fake.eventsSinceArgsForCall, struct {
+		revision uint64
+	}{revision})
+	fake.recordInvocation("EventsSince", []interface{}{revision})
+	fake.eventsSinceMutex.Unlock()
+	if fake.EventsSinceStub != nil {
+		return fake.EventsSinceStub(revision)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3, ret.result4
+	}
+	return fake.eventsSinceReturns.result1, fake.eventsSinceReturns.result2, fake.eventsSinceReturns.result3, fake.eventsSinceReturns.result4
+}
+
+func (fake *AddressTable) EventsSinceCallCount() int {
+	fake.eventsSinceMutex.RLock()
+	defer fake.eventsSinceMutex.RUnlock()
+	return len(fake.eventsSinceArgsForCall)
+}
+
+func (fake *AddressTable) EventsSinceArgsForCall(i int) uint64 {
+	fake.eventsSinceMutex.RLock()
+	defer fake.eventsSinceMutex.RUnlock()
+	return fake.eventsSinceArgsForCall[i].revision
+}
+
+func (fake *AddressTable) EventsSinceReturns(result1 []addresstable.Event, result2 uint64, result3 <-chan struct{}, result4 error) {
+	fake.EventsSinceStub = nil
+	fake.eventsSinceReturns = struct {
+		result1 []addresstable.Event
+		result2 uint64
+		result3 <-chan struct{}
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *AddressTable) EventsSinceReturnsOnCall(i int, result1 []addresstable.Event, result2 uint64, result3 <-chan struct{}, result4 error) {
+	fake.EventsSinceStub = nil
+	if fake.eventsSinceReturnsOnCall == nil {
+		fake.eventsSinceReturnsOnCall = make(map[int]struct {
+			result1 []addresstable.Event
+			result2 uint64
+			result3 <-chan struct{}
+			result4 error
+		})
+	}
+	fake.eventsSinceReturnsOnCall[i] = struct {
+		result1 []addresstable.Event
+		result2 uint64
+		result3 <-chan struct{}
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *AddressTable) PruningStatus() addresstable.PruningStatus {
+	fake.pruningStatusMutex.Lock()
+	ret, specificReturn := fake.pruningStatusReturnsOnCall[len(fake.pruningStatusArgsForCall)]
+	fake.pruningStatusArgsForCall = append(fake.pruningStatusArgsForCall, struct{}{})
+	fake.recordInvocation("PruningStatus", []interface{}{})
+	fake.pruningStatusMutex.Unlock()
+	if fake.PruningStatusStub != nil {
+		return fake.PruningStatusStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.pruningStatusReturns.result1
+}
+
+func (fake *AddressTable) PruningStatusCallCount() int {
+	fake.pruningStatusMutex.RLock()
+	defer fake.pruningStatusMutex.RUnlock()
+	return len(fake.pruningStatusArgsForCall)
+}
+
+func (fake *AddressTable) PruningStatusReturns(result1 addresstable.PruningStatus) {
+	fake.PruningStatusStub = nil
+	fake.pruningStatusReturns = struct {
+		result1 addresstable.PruningStatus
+	}{result1}
+}
+
+func (fake *AddressTable) PruningStatusReturnsOnCall(i int, result1 addresstable.PruningStatus) {
+	fake.PruningStatusStub = nil
+	if fake.pruningStatusReturnsOnCall == nil {
+		fake.pruningStatusReturnsOnCall = make(map[int]struct {
+			result1 addresstable.PruningStatus
+		})
+	}
+	fake.pruningStatusReturnsOnCall[i] = struct {
+		result1 addresstable.PruningStatus
+	}{result1}
+}
+
+func (fake *AddressTable) Known(hostname string) bool {
+	fake.knownMutex.Lock()
+	ret, specificReturn := fake.knownReturnsOnCall[len(fake.knownArgsForCall)]
+	fake.knownArgsForCall = append(fake.knownArgsForCall, struct {
+		hostname string
+	}{hostname})
+	fake.recordInvocation("Known", []interface{}{hostname})
+	fake.knownMutex.Unlock()
+	if fake.KnownStub != nil {
+		return fake.KnownStub(hostname)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.knownReturns.result1
+}
+
+func (fake *AddressTable) KnownCallCount() int {
+	fake.knownMutex.RLock()
+	defer fake.knownMutex.RUnlock()
+	return len(fake.knownArgsForCall)
+}
+
+func (fake *AddressTable) KnownArgsForCall(i int) string {
+	fake.knownMutex.RLock()
+	defer fake.knownMutex.RUnlock()
+	return fake.knownArgsForCall[i].hostname
+}
+
+func (fake *AddressTable) KnownReturns(result1 bool) {
+	fake.KnownStub = nil
+	fake.knownReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *AddressTable) KnownReturnsOnCall(i int, result1 bool) {
+	fake.KnownStub = nil
+	if fake.knownReturnsOnCall == nil {
+		fake.knownReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.knownReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *AddressTable) LookupHostnames(ip string) []string {
+	fake.lookupHostnamesMutex.Lock()
+	ret, specificReturn := fake.lookupHostnamesReturnsOnCall[len(fake.lookupHostnamesArgsForCall)]
+	fake.lookupHostnamesArgsForCall = append(fake.lookupHostnamesArgsForCall, struct {
+		ip string
+	}{ip})
+	fake.recordInvocation("LookupHostnames", []interface{}{ip})
+	fake.lookupHostnamesMutex.Unlock()
+	if fake.LookupHostnamesStub != nil {
+		return fake.LookupHostnamesStub(ip)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.lookupHostnamesReturns.result1
+}
+
+func (fake *AddressTable) LookupHostnamesCallCount() int {
+	fake.lookupHostnamesMutex.RLock()
+	defer fake.lookupHostnamesMutex.RUnlock()
+	return len(fake.lookupHostnamesArgsForCall)
+}
+
+func (fake *AddressTable) LookupHostnamesArgsForCall(i int) string {
+	fake.lookupHostnamesMutex.RLock()
+	defer fake.lookupHostnamesMutex.RUnlock()
+	return fake.lookupHostnamesArgsForCall[i].ip
+}
+
+func (fake *AddressTable) LookupHostnamesReturns(result1 []string) {
+	fake.LookupHostnamesStub = nil
+	fake.lookupHostnamesReturns = struct {
+		result1 []string
+	}{result1}
+}
+
+func (fake *AddressTable) LookupHostnamesReturnsOnCall(i int, result1 []string) {
+	fake.LookupHostnamesStub = nil
+	if fake.lookupHostnamesReturnsOnCall == nil {
+		fake.lookupHostnamesReturnsOnCall = make(map[int]struct {
+			result1 []string
+		})
+	}
+	fake.lookupHostnamesReturnsOnCall[i] = struct {
+		result1 []string
+	}{result1}
+}
+
+func (fake *AddressTable) MarshalSnapshot() ([]byte, error) {
+	fake.marshalSnapshotMutex.Lock()
+	ret, specificReturn := fake.marshalSnapshotReturnsOnCall[len(fake.marshalSnapshotArgsForCall)]
+	fake.marshalSnapshotArgsForCall = append(fake.marshalSnapshotArgsForCall, struct{}{})
+	fake.recordInvocation("MarshalSnapshot", []interface{}{})
+	fake.marshalSnapshotMutex.Unlock()
+	if fake.MarshalSnapshotStub != nil {
+		return fake.MarshalSnapshotStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.marshalSnapshotReturns.result1, fake.marshalSnapshotReturns.result2
+}
+
+func (fake *AddressTable) MarshalSnapshotCallCount() int {
+	fake.marshalSnapshotMutex.RLock()
+	defer fake.marshalSnapshotMutex.RUnlock()
+	return len(fake.marshalSnapshotArgsForCall)
+}
+
+func (fake *AddressTable) MarshalSnapshotReturns(result1 []byte, result2 error) {
+	fake.MarshalSnapshotStub = nil
+	fake.marshalSnapshotReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *AddressTable) MarshalSnapshotReturnsOnCall(i int, result1 []byte, result2 error) {
+	fake.MarshalSnapshotStub = nil
+	if fake.marshalSnapshotReturnsOnCall == nil {
+		fake.marshalSnapshotReturnsOnCall = make(map[int]struct {
+			result1 []byte
+			result2 error
+		})
+	}
+	fake.marshalSnapshotReturnsOnCall[i] = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *AddressTable) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.lookupMutex.RLock()
-	defer fake.lookupMutex.RUnlock()
-	fake.getAllAddressesMutex.RLock()
-	defer fake.getAllAddressesMutex.RUnlock()
+	fake.lookupEndpointsMutex.RLock()
+	defer fake.lookupEndpointsMutex.RUnlock()
+	fake.getAllEndpointsMutex.RLock()
+	defer fake.getAllEndpointsMutex.RUnlock()
 	fake.isWarmMutex.RLock()
 	defer fake.isWarmMutex.RUnlock()
+	fake.revisionMutex.RLock()
+	defer fake.revisionMutex.RUnlock()
+	fake.eventsSinceMutex.RLock()
+	defer fake.eventsSinceMutex.RUnlock()
+	fake.pruningStatusMutex.RLock()
+	defer fake.pruningStatusMutex.RUnlock()
+	fake.knownMutex.RLock()
+	defer fake.knownMutex.RUnlock()
+	fake.lookupHostnamesMutex.RLock()
+	defer fake.lookupHostnamesMutex.RUnlock()
+	fake.marshalSnapshotMutex.RLock()
+	defer fake.marshalSnapshotMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
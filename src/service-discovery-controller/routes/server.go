@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"path"
+	"service-discovery-controller/addresstable"
 	"service-discovery-controller/config"
+	"strconv"
 
 	"code.cloudfoundry.org/cf-networking-helpers/metrics"
 	"code.cloudfoundry.org/cf-networking-helpers/middleware"
@@ -36,12 +39,48 @@ type host struct {
 	Service         string                 `json:"service"`
 	ServiceRepoName string                 `json:"service_repo_name"`
 	Tags            map[string]interface{} `json:"tags"`
+	Source          string                 `json:"source,omitempty"`
+	MaxAge          *int                   `json:"max_age,omitempty"`
 }
 
+// registration sets NotFound when the hostname has never had endpoints, or
+// lost its last one long ago, so that clients can answer that the name does not
+// exist. A hostname whose app was just scaled to zero gets no hosts instead.
 type registration struct {
-	Hosts   []host `json:"hosts"`
-	Env     string `json:"env"`
-	Service string `json:"service"`
+	Hosts    []host `json:"hosts"`
+	Env      string `json:"env"`
+	Service  string `json:"service"`
+	NotFound bool   `json:"not_found,omitempty"`
+}
+
+type watchEvent struct {
+	Revision uint64 `json:"revision"`
+	Type     string `json:"type"`
+	Hostname string `json:"hostname"`
+	Host     host   `json:"host"`
+}
+
+type watch struct {
+	Revision uint64       `json:"revision"`
+	Events   []watchEvent `json:"events"`
+}
+
+// reverse sets NotFound when the IP is not registered under any hostname.
+type reverse struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+	NotFound  bool     `json:"not_found,omitempty"`
+}
+
+type pruning struct {
+	Paused       bool `json:"paused"`
+	Held         bool `json:"held"`
+	StaleEntries int  `json:"stale_entries"`
+	TotalEntries int  `json:"total_entries"`
+}
+
+type health struct {
+	Warm bool `json:"warm"`
 }
 
 type routes struct {
@@ -51,15 +90,27 @@ type routes struct {
 type address struct {
 	Hostname string   `json:"hostname"`
 	Ips      []string `json:"ips"`
+	Hosts    []host   `json:"hosts"`
 }
 
 //go:generate counterfeiter -o fakes/address_table.go --fake-name AddressTable . AddressTable
 type AddressTable interface {
-	Lookup(hostname string) []string
-	GetAllAddresses() map[string][]string
+	LookupEndpoints(hostname string) []addresstable.Endpoint
+	Known(hostname string) bool
+	GetAllEndpoints() map[string][]addresstable.Endpoint
 	IsWarm() bool
+	Revision() uint64
+	EventsSince(revision uint64) ([]addresstable.Event, uint64, <-chan struct{}, error)
+	PruningStatus() addresstable.PruningStatus
+	LookupHostnames(ip string) []string
+	MarshalSnapshot() ([]byte, error)
 }
 
+const (
+	defaultWatchWait = 30 * time.Second
+	maxWatchWait     = 60 * time.Second
+)
+
 //go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . MetricsSender
 type MetricsSender interface {
 	SendDuration(string, time.Duration)
@@ -97,6 +148,11 @@ func (s *Server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 
 	mux.HandleFunc("/v1/registration/", metricsWrap("Registration", http.HandlerFunc(s.handleRegistrationRequest)).ServeHTTP)
 	mux.HandleFunc("/routes", s.handleRoutesRequest)
+	mux.HandleFunc("/v1/reverse/", s.handleReverseRequest)
+	mux.HandleFunc("/v1/watch", s.handleWatchRequest)
+	mux.HandleFunc("/v1/pruning", s.handlePruningRequest)
+	mux.HandleFunc("/v1/health", s.handleHealthRequest)
+	mux.HandleFunc("/v1/snapshot", s.handleSnapshotRequest)
 
 	tlsConfig, err := s.buildTLSServerConfig()
 	if err != nil {
@@ -174,19 +230,17 @@ func (s *Server) handleRegistrationRequest(resp http.ResponseWriter, req *http.R
 	}
 
 	lookupStartTime := time.Now()
-	ips := s.addressTable.Lookup(serviceKey)
+	endpoints := s.addressTable.LookupEndpoints(serviceKey)
 	lookupDuration := time.Now().Sub(lookupStartTime)
 	s.metricsSender.SendDuration("addressTableLookupTime", lookupDuration)
-	hosts := make([]host, cap(ips))
-	for index, ip := range ips {
-		hosts[index] = host{
-			IPAddress: ip,
-			Tags:      make(map[string]interface{}),
-		}
+	hosts := s.endpointsToHosts(endpoints)
+
+	if maxAge, ok := s.maxAge(endpoints); ok {
+		resp.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge))
 	}
 
 	var err error
-	json, err := json.Marshal(registration{Hosts: hosts})
+	json, err := json.Marshal(registration{Hosts: hosts, NotFound: len(hosts) == 0 && !s.addressTable.Known(serviceKey)})
 	if err != nil {
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
@@ -205,13 +259,47 @@ func (s *Server) handleRegistrationRequest(resp http.ResponseWriter, req *http.R
 	}))
 }
 
+// maxAge is how many seconds the endpoints may be cached for: until the
+// first of them would be pruned unless it is registered again.
+func (s *Server) maxAge(endpoints []addresstable.Endpoint) (int, bool) {
+	maxAge := -1
+	for _, endpoint := range endpoints {
+		remaining, ok := s.secondsUntilStale(endpoint)
+		if !ok {
+			continue
+		}
+		if maxAge == -1 || remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	return maxAge, maxAge >= 0
+}
+
+func (s *Server) secondsUntilStale(endpoint addresstable.Endpoint) (int, bool) {
+	threshold := time.Duration(s.config.StalenessThresholdSeconds) * time.Second
+	if threshold <= 0 || endpoint.UpdateTime.IsZero() {
+		return 0, false
+	}
+
+	remaining := int((threshold - time.Since(endpoint.UpdateTime)) / time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
 func (s *Server) handleRoutesRequest(resp http.ResponseWriter, req *http.Request) {
-	availableAddresses := s.addressTable.GetAllAddresses()
+	availableEndpoints := s.addressTable.GetAllEndpoints()
 	addresses := []address{}
-	for i, availableAddress := range availableAddresses {
+	for i, endpoints := range availableEndpoints {
+		ips := make([]string, len(endpoints))
+		for index, endpoint := range endpoints {
+			ips[index] = endpoint.IP
+		}
 		addresses = append(addresses, address{
 			Hostname: i,
-			Ips:      availableAddress,
+			Ips:      ips,
+			Hosts:    s.endpointsToHosts(endpoints),
 		})
 	}
 
@@ -231,3 +319,228 @@ func (s *Server) handleRoutesRequest(resp http.ResponseWriter, req *http.Request
 		"responseJson": string(json),
 	}))
 }
+
+func (s *Server) handleReverseRequest(resp http.ResponseWriter, req *http.Request) {
+	ip := path.Base(req.URL.Path)
+	if net.ParseIP(ip) == nil {
+		http.Error(resp, fmt.Sprintf("invalid ip: %s", ip), http.StatusBadRequest)
+		return
+	}
+
+	if !s.addressTable.IsWarm() {
+		http.Error(resp, "address table is not warm", http.StatusInternalServerError)
+		s.logger.Debug("failed-request", lager.Data{
+			"ip":     ip,
+			"reason": "address-table-not-warm",
+		})
+		return
+	}
+
+	hostnames := s.addressTable.LookupHostnames(ip)
+
+	json, err := json.Marshal(reverse{IP: ip, Hostnames: hostnames, NotFound: len(hostnames) == 0})
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = resp.Write(json)
+	if err != nil {
+		s.logger.Debug("Error writing to http response body")
+	}
+
+	s.logger.Debug("HTTPServer access", lager.Data(map[string]interface{}{
+		"ip":           ip,
+		"responseJson": string(json),
+	}))
+}
+
+func (s *Server) handlePruningRequest(resp http.ResponseWriter, req *http.Request) {
+	status := s.addressTable.PruningStatus()
+
+	json, err := json.Marshal(pruning{
+		Paused:       status.Paused,
+		Held:         status.Held,
+		StaleEntries: status.StaleEntries,
+		TotalEntries: status.TotalEntries,
+	})
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = resp.Write(json)
+	if err != nil {
+		s.logger.Debug("Error writing to http response body")
+	}
+}
+
+func (s *Server) handleHealthRequest(resp http.ResponseWriter, req *http.Request) {
+	if !s.addressTable.IsWarm() {
+		http.Error(resp, "address table is not warm", http.StatusServiceUnavailable)
+		return
+	}
+
+	json, err := json.Marshal(health{Warm: true})
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = resp.Write(json)
+	if err != nil {
+		s.logger.Debug("Error writing to http response body")
+	}
+}
+
+// handleSnapshotRequest serves the whole table, with the time each entry was
+// last updated, so that a peer that is starting up can bootstrap from it.
+func (s *Server) handleSnapshotRequest(resp http.ResponseWriter, req *http.Request) {
+	if !s.addressTable.IsWarm() {
+		http.Error(resp, "address table is not warm", http.StatusServiceUnavailable)
+		return
+	}
+
+	snapshotJSON, err := s.addressTable.MarshalSnapshot()
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	_, err = resp.Write(snapshotJSON)
+	if err != nil {
+		s.logger.Debug("Error writing to http response body")
+	}
+}
+
+func (s *Server) handleWatchRequest(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	var since uint64
+	hasSince := query.Get("since") != ""
+	if hasSince {
+		var err error
+		since, err = strconv.ParseUint(query.Get("since"), 10, 64)
+		if err != nil {
+			http.Error(resp, fmt.Sprintf("invalid since: %s", query.Get("since")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	wait := defaultWatchWait
+	if query.Get("wait") != "" {
+		waitSeconds, err := strconv.Atoi(query.Get("wait"))
+		if err != nil || waitSeconds < 0 {
+			http.Error(resp, fmt.Sprintf("invalid wait: %s", query.Get("wait")), http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(waitSeconds) * time.Second
+		if wait > maxWatchWait {
+			wait = maxWatchWait
+		}
+	}
+
+	// Without since, the caller only wants the current revision to watch
+	// from, which is available however many events have been published.
+	if !hasSince {
+		s.writeWatchResponse(resp, s.addressTable.Revision(), nil)
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		events, revision, changed, err := s.addressTable.EventsSince(since)
+		if err == addresstable.ErrRevisionUnavailable {
+			http.Error(resp, fmt.Sprintf("revision %d is unavailable, current revision is %d", since, revision), http.StatusGone)
+			return
+		}
+
+		if len(events) > 0 {
+			s.writeWatchResponse(resp, revision, events)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			s.writeWatchResponse(resp, revision, events)
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) writeWatchResponse(resp http.ResponseWriter, revision uint64, events []addresstable.Event) {
+	watchEvents := make([]watchEvent, len(events))
+	for index, event := range events {
+		watchEvents[index] = watchEvent{
+			Revision: event.Revision,
+			Type:     string(event.Type),
+			Hostname: event.Hostname,
+			Host:     s.endpointsToHosts([]addresstable.Endpoint{event.Endpoint})[0],
+		}
+	}
+
+	json, err := json.Marshal(watch{Revision: revision, Events: watchEvents})
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = resp.Write(json)
+	if err != nil {
+		s.logger.Debug("Error writing to http response body")
+	}
+}
+
+// endpointsToHosts gives each host the seconds it has left before it would be
+// pruned unless it is registered again, so that clients keeping a copy of the
+// table, which are not told when an endpoint is only registered again, can
+// tell when their copy of it has run out.
+func (s *Server) endpointsToHosts(endpoints []addresstable.Endpoint) []host {
+	hosts := make([]host, len(endpoints))
+	for index, endpoint := range endpoints {
+		hosts[index] = host{
+			IPAddress:   endpoint.IP,
+			LastCheckIn: lastCheckIn(endpoint.UpdateTime),
+			Port:        int32(endpoint.Metadata.Port),
+			Tags:        metadataToTags(endpoint.Metadata),
+			Source:      endpoint.Metadata.Source,
+		}
+		if remaining, ok := s.secondsUntilStale(endpoint); ok {
+			hosts[index].MaxAge = &remaining
+		}
+	}
+	return hosts
+}
+
+func lastCheckIn(updateTime time.Time) string {
+	if updateTime.IsZero() {
+		return ""
+	}
+	return updateTime.UTC().Format(time.RFC3339)
+}
+
+func metadataToTags(metadata addresstable.Metadata) map[string]interface{} {
+	tags := make(map[string]interface{})
+	for key, value := range metadata.Tags {
+		tags[key] = value
+	}
+
+	structuredTags := map[string]string{
+		"app_guid":          metadata.AppGUID,
+		"process_guid":      metadata.ProcessGUID,
+		"instance_index":    metadata.InstanceIndex,
+		"availability_zone": metadata.AvailabilityZone,
+	}
+	for key, value := range structuredTags {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
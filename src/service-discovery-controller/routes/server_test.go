@@ -4,16 +4,20 @@ import (
 	"test-helpers"
 
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"service-discovery-controller/addresstable"
 	"service-discovery-controller/config"
 	. "service-discovery-controller/routes"
 	"service-discovery-controller/routes/fakes"
 	"strconv"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 
@@ -36,6 +40,7 @@ var _ = Describe("Server", func() {
 		testLogger         *lagertest.TestLogger
 		client             *http.Client
 		server             *Server
+		sdcConfig          *config.Config
 		port               int
 	)
 
@@ -45,7 +50,7 @@ var _ = Describe("Server", func() {
 		port = ports.PickAPort()
 
 		testLogger = lagertest.NewTestLogger("test")
-		config := &config.Config{
+		sdcConfig = &config.Config{
 			Port:       strconv.Itoa(port),
 			Address:    "127.0.0.1",
 			CACert:     caFile,
@@ -55,7 +60,7 @@ var _ = Describe("Server", func() {
 		addressTable = &fakes.AddressTable{}
 		dnsRequestRecorder = &fakes.DNSRequestRecorder{}
 		metricsSender = &fakes.MetricsSender{}
-		server = NewServer(addressTable, config, dnsRequestRecorder, metricsSender, testLogger)
+		server = NewServer(addressTable, sdcConfig, dnsRequestRecorder, metricsSender, testLogger)
 		client = testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert)
 	})
 
@@ -64,11 +69,11 @@ var _ = Describe("Server", func() {
 
 		BeforeEach(func() {
 			serverProc = ifrit.Invoke(server)
-			addressTable.LookupStub = func(hostname string) []string {
+			addressTable.LookupEndpointsStub = func(hostname string) []addresstable.Endpoint {
 				if hostname == "app-id.internal.local." {
-					return []string{"192.168.0.2"}
+					return []addresstable.Endpoint{{IP: "192.168.0.2"}}
 				}
-				return []string{}
+				return []addresstable.Endpoint{}
 			}
 			addressTable.IsWarmReturns(true)
 
@@ -106,6 +111,38 @@ var _ = Describe("Server", func() {
 			}`))
 		})
 
+		It("says when a hostname has no addresses", func() {
+			resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/registration/unknown.internal.local.", port))
+			Expect(err).ToNot(HaveOccurred())
+
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(respBody).To(MatchJSON(`{
+				"env": "",
+				"hosts": [],
+				"service": "",
+				"not_found": true
+			}`))
+			Expect(addressTable.KnownArgsForCall(0)).To(Equal("unknown.internal.local."))
+		})
+
+		It("answers with no hosts for a hostname whose app was scaled to zero", func() {
+			addressTable.KnownReturns(true)
+
+			resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/registration/scaled-to-zero.internal.local.", port))
+			Expect(err).ToNot(HaveOccurred())
+
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(respBody).To(MatchJSON(`{
+				"env": "",
+				"hosts": [],
+				"service": ""
+			}`))
+		})
+
 		It("invokes the dns request recorder", func() {
 			Expect(dnsRequestRecorder.RecordRequestCallCount()).To(BeNumerically(">=", 1))
 		})
@@ -118,6 +155,536 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	Context("when the endpoints have been registered a while ago", func() {
+		BeforeEach(func() {
+			server = NewServer(addressTable, &config.Config{
+				Port:                      strconv.Itoa(port),
+				Address:                   "127.0.0.1",
+				CACert:                    caFile,
+				ServerCert:                serverCert,
+				ServerKey:                 serverKey,
+				StalenessThresholdSeconds: 30,
+			}, dnsRequestRecorder, metricsSender, testLogger)
+			serverProc = ifrit.Invoke(server)
+
+			endpoints := []addresstable.Endpoint{
+				{IP: "192.168.0.1", UpdateTime: time.Now().Add(-10*time.Second + 500*time.Millisecond)},
+				{IP: "192.168.0.2", UpdateTime: time.Now().Add(-20*time.Second - 500*time.Millisecond)},
+			}
+			addressTable.LookupEndpointsReturns(endpoints)
+			addressTable.GetAllEndpointsReturns(map[string][]addresstable.Endpoint{"app-id.internal.local.": endpoints})
+			addressTable.IsWarmReturns(true)
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		It("lets them be cached until the first of them would go stale", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/registration/app-id.internal.local.", port))
+				return err
+			}).Should(Succeed())
+
+			Expect(resp.Header.Get("Cache-Control")).To(Equal("max-age=9"))
+		})
+
+		It("tells clients of /routes how long each host has left", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/routes", port))
+				return err
+			}).Should(Succeed())
+
+			var body struct {
+				Addresses []struct {
+					Hosts []struct {
+						IPAddress string `json:"ip_address"`
+						MaxAge    int    `json:"max_age"`
+					} `json:"hosts"`
+				} `json:"addresses"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body.Addresses).To(HaveLen(1))
+			Expect(body.Addresses[0].Hosts).To(HaveLen(2))
+			Expect(body.Addresses[0].Hosts[0].MaxAge).To(Equal(20))
+			Expect(body.Addresses[0].Hosts[1].MaxAge).To(Equal(9))
+		})
+	})
+
+	Context("when the endpoints have metadata", func() {
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			metadata := addresstable.Metadata{
+				Port:             8080,
+				AppGUID:          "some-app-guid",
+				ProcessGUID:      "some-process-guid",
+				InstanceIndex:    "2",
+				AvailabilityZone: "z1",
+				Tags:             map[string]string{"component": "api"},
+				Source:           "file",
+			}
+			updateTime := time.Date(2018, time.March, 1, 12, 30, 0, 0, time.UTC)
+			addressTable.LookupEndpointsReturns([]addresstable.Endpoint{{IP: "192.168.0.2", UpdateTime: updateTime, Metadata: metadata}})
+			addressTable.GetAllEndpointsReturns(map[string][]addresstable.Endpoint{
+				"app-id.internal.local.": {{IP: "192.168.0.2", UpdateTime: updateTime, Metadata: metadata}},
+			})
+			addressTable.IsWarmReturns(true)
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		get := func(path string) string {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d%s", port, path))
+				return err
+			}).Should(BeNil())
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			return string(respBodyBytes)
+		}
+
+		It("returns the metadata and source in the registration hosts", func() {
+			Expect(get("/v1/registration/app-id.internal.local.")).To(MatchJSON(`{
+				"env": "",
+				"hosts": [
+				{
+					"ip_address": "192.168.0.2",
+					"last_check_in": "2018-03-01T12:30:00Z",
+					"port": 8080,
+					"revision": "",
+					"service": "",
+					"service_repo_name": "",
+					"tags": {
+						"component": "api",
+						"app_guid": "some-app-guid",
+						"process_guid": "some-process-guid",
+						"instance_index": "2",
+						"availability_zone": "z1"
+					},
+					"source": "file"
+				}],
+				"service": ""
+			}`))
+		})
+
+		It("returns the metadata and source in the routes hosts", func() {
+			Expect(get("/routes")).To(MatchJSON(`{
+				"addresses": [{
+					"hostname": "app-id.internal.local.",
+					"ips": ["192.168.0.2"],
+					"hosts": [
+					{
+						"ip_address": "192.168.0.2",
+						"last_check_in": "2018-03-01T12:30:00Z",
+						"port": 8080,
+						"revision": "",
+						"service": "",
+						"service_repo_name": "",
+						"tags": {
+							"component": "api",
+							"app_guid": "some-app-guid",
+							"process_guid": "some-process-guid",
+							"instance_index": "2",
+							"availability_zone": "z1"
+						},
+						"source": "file"
+					}]
+				}]
+			}`))
+		})
+	})
+
+	Context("when the hostnames for an ip are requested", func() {
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			addressTable.IsWarmReturns(true)
+			addressTable.LookupHostnamesStub = func(ip string) []string {
+				if ip == "10.255.0.2" {
+					return []string{"0.app-id.apps.internal.", "app-id.apps.internal."}
+				}
+				return []string{}
+			}
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		getReverse := func(ip string) *http.Response {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/reverse/%s", port, ip))
+				return err
+			}).Should(BeNil())
+			return resp
+		}
+
+		It("returns the hostnames the ip is registered under", func() {
+			resp := getReverse("10.255.0.2")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(respBodyBytes)).To(MatchJSON(`{
+				"ip": "10.255.0.2",
+				"hostnames": ["0.app-id.apps.internal.", "app-id.apps.internal."]
+			}`))
+			Expect(addressTable.LookupHostnamesArgsForCall(0)).To(Equal("10.255.0.2"))
+		})
+
+		It("says when the ip is not registered", func() {
+			resp := getReverse("10.255.0.3")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(respBodyBytes)).To(MatchJSON(`{
+				"ip": "10.255.0.3",
+				"hostnames": [],
+				"not_found": true
+			}`))
+		})
+
+		Context("when the ip is invalid", func() {
+			It("returns bad request", func() {
+				resp := getReverse("not-an-ip")
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+				Expect(addressTable.LookupHostnamesCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the address table is not warm", func() {
+			BeforeEach(func() {
+				addressTable.IsWarmReturns(false)
+			})
+
+			It("returns an internal server error", func() {
+				resp := getReverse("10.255.0.2")
+				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+				Expect(addressTable.LookupHostnamesCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the pruning status is requested", func() {
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			addressTable.PruningStatusReturns(addresstable.PruningStatus{
+				Held:         true,
+				StaleEntries: 60,
+				TotalEntries: 100,
+			})
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		It("returns whether pruning is held", func() {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/pruning", port))
+				return err
+			}).Should(BeNil())
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(respBodyBytes)).To(MatchJSON(`{
+				"paused": false,
+				"held": true,
+				"stale_entries": 60,
+				"total_entries": 100
+			}`))
+		})
+	})
+
+	Context("when the health is requested", func() {
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			addressTable.IsWarmReturns(true)
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		getHealth := func() *http.Response {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/health", port))
+				return err
+			}).Should(BeNil())
+			return resp
+		}
+
+		It("reports that the address table is warm", func() {
+			resp := getHealth()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(respBodyBytes)).To(MatchJSON(`{"warm": true}`))
+		})
+
+		Context("when the address table is not warm", func() {
+			BeforeEach(func() {
+				addressTable.IsWarmReturns(false)
+			})
+
+			It("returns service unavailable", func() {
+				resp := getHealth()
+				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+				respBodyBytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(respBodyBytes)).To(Equal("address table is not warm\n"))
+			})
+		})
+	})
+
+	Context("when the snapshot is requested", func() {
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			addressTable.IsWarmReturns(true)
+			addressTable.MarshalSnapshotReturns([]byte(`{"version": 1}`), nil)
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		getSnapshot := func() *http.Response {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/snapshot", port))
+				return err
+			}).Should(BeNil())
+			return resp
+		}
+
+		It("returns the snapshot of the address table", func() {
+			resp := getSnapshot()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(respBodyBytes)).To(MatchJSON(`{"version": 1}`))
+		})
+
+		Context("when the address table is not warm", func() {
+			BeforeEach(func() {
+				addressTable.IsWarmReturns(false)
+			})
+
+			It("returns service unavailable so peers do not bootstrap from it", func() {
+				resp := getSnapshot()
+				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(addressTable.MarshalSnapshotCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the snapshot cannot be marshaled", func() {
+			BeforeEach(func() {
+				addressTable.MarshalSnapshotReturns(nil, errors.New("potato"))
+			})
+
+			It("returns an internal server error", func() {
+				resp := getSnapshot()
+				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Context("when watching for changes", func() {
+		var (
+			changed chan struct{}
+			events  []addresstable.Event
+		)
+
+		BeforeEach(func() {
+			serverProc = ifrit.Invoke(server)
+			changed = make(chan struct{})
+			events = []addresstable.Event{}
+			addressTable.EventsSinceStub = func(revision uint64) ([]addresstable.Event, uint64, <-chan struct{}, error) {
+				select {
+				case <-changed:
+					return events, 8, nil, nil
+				default:
+					return []addresstable.Event{}, 7, changed, nil
+				}
+			}
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+		})
+
+		watch := func(query string) (int, string) {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/watch%s", port, query))
+				return err
+			}).Should(BeNil())
+
+			respBodyBytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			return resp.StatusCode, string(respBodyBytes)
+		}
+
+		Context("when since is not provided", func() {
+			BeforeEach(func() {
+				addressTable.RevisionReturns(7)
+			})
+
+			It("returns the current revision without waiting", func() {
+				status, body := watch("")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(MatchJSON(`{"revision": 7, "events": []}`))
+				Expect(addressTable.EventsSinceCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when there are events after the revision", func() {
+			BeforeEach(func() {
+				events = []addresstable.Event{{
+					Revision: 8,
+					Type:     addresstable.EventAdded,
+					Hostname: "app-id.internal.local.",
+					Endpoint: addresstable.Endpoint{
+						IP:       "192.168.0.2",
+						Metadata: addresstable.Metadata{Port: 8080},
+					},
+				}}
+				close(changed)
+			})
+
+			It("returns them", func() {
+				status, body := watch("?since=7")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(MatchJSON(`{
+					"revision": 8,
+					"events": [{
+						"revision": 8,
+						"type": "added",
+						"hostname": "app-id.internal.local.",
+						"host": {
+							"ip_address": "192.168.0.2",
+							"last_check_in": "",
+							"port": 8080,
+							"revision": "",
+							"service": "",
+							"service_repo_name": "",
+							"tags": {}
+						}
+					}]
+				}`))
+				Expect(addressTable.EventsSinceArgsForCall(0)).To(Equal(uint64(7)))
+			})
+		})
+
+		Context("when there are no events after the revision", func() {
+			It("waits for the next change", func() {
+				events = []addresstable.Event{{Revision: 8, Type: addresstable.EventRemoved}}
+				bodies := make(chan string)
+				go func() {
+					defer GinkgoRecover()
+					_, body := watch("?since=7")
+					bodies <- body
+				}()
+
+				Consistently(bodies).ShouldNot(Receive())
+				close(changed)
+				Eventually(bodies).Should(Receive(ContainSubstring(`"type":"removed"`)))
+			})
+
+			It("returns no events once the wait has elapsed", func() {
+				status, body := watch("?since=7&wait=0")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(MatchJSON(`{"revision": 7, "events": []}`))
+			})
+		})
+
+		Context("when the revision is unavailable", func() {
+			BeforeEach(func() {
+				addressTable.EventsSinceStub = nil
+				addressTable.EventsSinceReturns(nil, 7, nil, addresstable.ErrRevisionUnavailable)
+			})
+
+			It("returns gone", func() {
+				status, body := watch("?since=1")
+				Expect(status).To(Equal(http.StatusGone))
+				Expect(body).To(ContainSubstring("revision 1 is unavailable, current revision is 7"))
+			})
+		})
+
+		Context("when the query is invalid", func() {
+			It("returns bad request", func() {
+				status, body := watch("?since=banana")
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(body).To(ContainSubstring("invalid since: banana"))
+
+				status, body = watch("?since=1&wait=-1")
+				Expect(status).To(Equal(http.StatusBadRequest))
+				Expect(body).To(ContainSubstring("invalid wait: -1"))
+			})
+		})
+	})
+
+	Context("when the address table has published more events than it keeps", func() {
+		var table *addresstable.AddressTable
+
+		BeforeEach(func() {
+			table = addresstable.NewAddressTable(time.Minute, time.Minute, 0, clock.NewClock(), testLogger)
+			for i := 0; i <= 10000; i++ {
+				table.Add([]string{fmt.Sprintf("app-%d.internal.local.", i)}, "192.168.0.2")
+			}
+			server = NewServer(table, sdcConfig, dnsRequestRecorder, metricsSender, testLogger)
+			serverProc = ifrit.Invoke(server)
+		})
+
+		AfterEach(func() {
+			serverProc.Signal(os.Interrupt)
+			Eventually(serverProc.Wait()).Should(Receive())
+			table.Shutdown()
+		})
+
+		It("still returns the current revision to watches without since", func() {
+			var resp *http.Response
+			var err error
+			Eventually(func() error {
+				resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/v1/watch", port))
+				return err
+			}).Should(BeNil())
+
+			respBody, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(respBody).To(MatchJSON(`{"revision": 10001, "events": []}`))
+		})
+	})
+
 	Context("when the address table is not warm", func() {
 		var (
 			resp *http.Response
@@ -0,0 +1,166 @@
+package routesource
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"service-discovery-controller/addresstable"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/pivotal-cf/paraphernalia/secure/tlsconfig"
+)
+
+// APISource registers the routes pushed to it over HTTPS. Clients
+// authenticate with a certificate signed by its own CA. Routes are registered
+// with a POST of a Routes document to /v1/routes and unregistered with a
+// DELETE of one, of no more than maxBodyBytes. Like routes from NATS, pushed
+// routes are pruned unless they are pushed again within the staleness
+// threshold.
+type APISource struct {
+	address         string
+	port            int
+	serverCert      string
+	serverKey       string
+	caCert          string
+	maxBodyBytes    int64
+	internalDomains []string
+	table           AddressTable
+	logger          lager.Logger
+}
+
+func NewAPISource(
+	address string,
+	port int,
+	serverCert, serverKey, caCert string,
+	maxBodyBytes int64,
+	internalDomains []string,
+	table AddressTable,
+	logger lager.Logger,
+) *APISource {
+	return &APISource{
+		address:         address,
+		port:            port,
+		serverCert:      serverCert,
+		serverKey:       serverKey,
+		caCert:          caCert,
+		maxBodyBytes:    maxBodyBytes,
+		internalDomains: internalDomains,
+		table:           table,
+		logger:          logger,
+	}
+}
+
+func (a *APISource) Name() string {
+	return API
+}
+
+func (a *APISource) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/routes", a.handleRoutesRequest)
+
+	tlsConfig, err := a.buildTLSServerConfig()
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", a.address, a.port),
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+
+	exited := make(chan error)
+	go func() {
+		exited <- httpServer.ListenAndServeTLS("", "")
+	}()
+
+	time.Sleep(time.Microsecond)
+	close(ready)
+	a.logger.Info("server-started")
+
+	select {
+	case err := <-exited:
+		a.logger.Info(fmt.Sprintf("route API server exiting with: %v", err))
+		return err
+	case signal := <-signals:
+		httpServer.Close()
+		a.logger.Info(fmt.Sprintf("route API server exiting with signal: %v", signal))
+		return nil
+	}
+}
+
+func (a *APISource) buildTLSServerConfig() (*tls.Config, error) {
+	caCert, err := ioutil.ReadFile(a.caCert)
+	if err != nil {
+		return nil, fmt.Errorf("read route API CA file: %s", err)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("load route API CA file into cert pool")
+	}
+
+	cert, err := tls.LoadX509KeyPair(a.serverCert, a.serverKey)
+	if err != nil {
+		return nil, fmt.Errorf("load route API key pair: %s", err)
+	}
+
+	tlsConfig := tlsconfig.Build(
+		tlsconfig.WithIdentity(cert),
+		tlsconfig.WithInternalServiceDefaults(),
+	)
+
+	serverConfig := tlsConfig.Server(tlsconfig.WithClientAuthentication(caCertPool))
+	serverConfig.BuildNameToCertificate()
+	return serverConfig, nil
+}
+
+func (a *APISource) handleRoutesRequest(resp http.ResponseWriter, req *http.Request) {
+	var remove bool
+	switch req.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		remove = true
+	default:
+		resp.Header().Set("Allow", "POST, DELETE")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Reading only fails on a client that went away or a body over the limit,
+	// and only the latter can still be answered.
+	body, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, a.maxBodyBytes))
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("routes must be at most %d bytes", a.maxBodyBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	routes := Routes{}
+	err = json.Unmarshal(body, &routes)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("invalid routes: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = validateRoutes(routes.Routes, a.internalDomains)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("invalid routes: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	changes := make([]addresstable.Change, len(routes.Routes))
+	for i, route := range routes.Routes {
+		changes[i] = route.change(API, remove)
+	}
+	a.table.Apply(changes)
+
+	a.logger.Debug("routes-applied", lager.Data{
+		"method": req.Method,
+		"routes": len(changes),
+	})
+	resp.WriteHeader(http.StatusNoContent)
+}
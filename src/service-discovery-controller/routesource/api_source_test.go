@@ -0,0 +1,129 @@
+package routesource_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"service-discovery-controller/addresstable"
+	. "service-discovery-controller/routesource"
+	"service-discovery-controller/routesource/fakes"
+	"strings"
+	"test-helpers"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("APISource", func() {
+	var (
+		addressTable *fakes.AddressTable
+		process      ifrit.Process
+		client       *http.Client
+		port         int
+		caFile       string
+	)
+
+	BeforeEach(func() {
+		var serverCert, serverKey string
+		var clientCert tls.Certificate
+		caFile, serverCert, serverKey, clientCert = testhelpers.GenerateCaAndMutualTlsCerts()
+		client = testhelpers.NewClient(testhelpers.CertPool(caFile), clientCert)
+
+		addressTable = &fakes.AddressTable{}
+		port = ports.PickAPort()
+		source := NewAPISource("127.0.0.1", port, serverCert, serverKey, caFile, 1024, []string{"platform.internal."}, addressTable, lagertest.NewTestLogger("test"))
+		Expect(source.Name()).To(Equal("api"))
+		process = ifrit.Invoke(source)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	request := func(c *http.Client, method, body string) (*http.Response, error) {
+		req, err := http.NewRequest(method, fmt.Sprintf("https://127.0.0.1:%d/v1/routes", port), strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		var resp *http.Response
+		Eventually(func() error {
+			resp, err = c.Do(req)
+			if err != nil && strings.Contains(err.Error(), "connection refused") {
+				return err
+			}
+			return nil
+		}).Should(Succeed())
+		return resp, err
+	}
+
+	It("registers the routes that are posted, tagged with their source", func() {
+		resp, err := request(client, "POST", `{"routes": [{"hostnames": ["uaa.platform.internal"], "ip": "10.0.0.5", "port": 8443}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+		Expect(addressTable.ApplyCallCount()).To(Equal(1))
+		Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{{
+			Hostnames: []string{"uaa.platform.internal"},
+			IP:        "10.0.0.5",
+			Metadata:  addresstable.Metadata{Port: 8443, Source: "api"},
+		}}))
+	})
+
+	It("unregisters the routes that are deleted", func() {
+		resp, err := request(client, "DELETE", `{"routes": [{"hostnames": ["uaa.platform.internal"], "ip": "10.0.0.5"}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+		Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{{
+			Remove:    true,
+			Hostnames: []string{"uaa.platform.internal"},
+			IP:        "10.0.0.5",
+			Metadata:  addresstable.Metadata{Source: "api"},
+		}}))
+	})
+
+	It("rejects invalid routes", func() {
+		resp, err := request(client, "POST", `{"routes": [{"hostnames": ["uaa.example.com"], "ip": "10.0.0.5"}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`routes[0]: hostname "uaa.example.com" is not under an internal domain`))
+		Expect(addressTable.ApplyCallCount()).To(Equal(0))
+	})
+
+	It("rejects malformed requests", func() {
+		resp, err := request(client, "POST", `garbage`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(addressTable.ApplyCallCount()).To(Equal(0))
+	})
+
+	It("rejects bodies over the limit", func() {
+		resp, err := request(client, "POST", `{"routes": [{"hostnames": ["`+strings.Repeat("a", 1024)+`.platform.internal."], "ip": "10.0.0.5"}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(addressTable.ApplyCallCount()).To(Equal(0))
+	})
+
+	It("only allows POST and DELETE", func() {
+		resp, err := request(client, "GET", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("rejects clients without a certificate signed by its CA", func() {
+		_, _, _, otherClientCert := testhelpers.GenerateCaAndMutualTlsCerts()
+		otherClient := testhelpers.NewClient(testhelpers.CertPool(caFile), otherClientCert)
+
+		_, err := request(otherClient, "POST", `{"routes": []}`)
+		Expect(err).To(HaveOccurred())
+		Expect(addressTable.ApplyCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,150 @@
+package routesource
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"service-discovery-controller/addresstable"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"gopkg.in/yaml.v2"
+)
+
+// FileSource registers the routes in a YAML or JSON file, for platform
+// services whose addresses are pinned. The file is polled rather than watched,
+// and read again every refresh interval: routes that are still in it are
+// registered again, so that they are never pruned, and routes that were
+// removed from it are unregistered.
+type FileSource struct {
+	path            string
+	internalDomains []string
+	refreshInterval time.Duration
+	table           AddressTable
+	clock           clock.Clock
+	logger          lager.Logger
+	contents        []byte
+	routes          []Route
+}
+
+func NewFileSource(
+	path string,
+	internalDomains []string,
+	refreshInterval time.Duration,
+	table AddressTable,
+	clock clock.Clock,
+	logger lager.Logger,
+) *FileSource {
+	return &FileSource{
+		path:            path,
+		internalDomains: internalDomains,
+		refreshInterval: refreshInterval,
+		table:           table,
+		clock:           clock,
+		logger:          logger,
+	}
+}
+
+func (f *FileSource) Name() string {
+	return File
+}
+
+// Run fails when the file cannot be loaded on start. Later, a file that
+// cannot be loaded is logged and the routes last loaded are kept.
+func (f *FileSource) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	err := f.refresh()
+	if err != nil {
+		return err
+	}
+
+	close(ready)
+
+	ticker := f.clock.NewTicker(f.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C():
+			err := f.refresh()
+			if err != nil {
+				f.logger.Error("static-routes-not-reloaded", err, lager.Data{"path": f.path})
+			}
+		}
+	}
+}
+
+func (f *FileSource) refresh() error {
+	contents, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("read static routes file: %s", err)
+	}
+
+	routes := f.routes
+	if !bytes.Equal(contents, f.contents) {
+		routes, err = f.parse(contents)
+		if err != nil {
+			return err
+		}
+	}
+
+	changes := removedRoutes(f.routes, routes)
+	for _, route := range routes {
+		changes = append(changes, route.change(File, false))
+	}
+	f.table.Apply(changes)
+
+	if !bytes.Equal(contents, f.contents) {
+		f.logger.Info("static-routes-loaded", lager.Data{"path": f.path, "routes": len(routes)})
+	}
+	f.contents = contents
+	f.routes = routes
+	return nil
+}
+
+func (f *FileSource) parse(contents []byte) ([]Route, error) {
+	staticRoutes := Routes{}
+	err := yaml.Unmarshal(contents, &staticRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("parse static routes file: %s", err)
+	}
+
+	err = validateRoutes(staticRoutes.Routes, f.internalDomains)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static routes file: %s", err)
+	}
+
+	return staticRoutes.Routes, nil
+}
+
+// removedRoutes unregisters every hostname and IP pair of the old routes that
+// is not in the new routes. The unregisters only take back the registers of
+// the file source, so a pair that another source also registered is kept.
+func removedRoutes(oldRoutes, newRoutes []Route) []addresstable.Change {
+	current := map[string]map[string]bool{}
+	for _, route := range newRoutes {
+		if current[route.IP] == nil {
+			current[route.IP] = map[string]bool{}
+		}
+		for _, hostname := range route.Hostnames {
+			current[route.IP][fqdn(hostname)] = true
+		}
+	}
+
+	var changes []addresstable.Change
+	for _, route := range oldRoutes {
+		removed := Route{IP: route.IP}
+		for _, hostname := range route.Hostnames {
+			if !current[route.IP][fqdn(hostname)] {
+				removed.Hostnames = append(removed.Hostnames, hostname)
+			}
+		}
+		if len(removed.Hostnames) > 0 {
+			changes = append(changes, removed.change(File, true))
+		}
+	}
+	return changes
+}
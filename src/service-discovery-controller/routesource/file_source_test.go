@@ -0,0 +1,168 @@
+package routesource_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"service-discovery-controller/addresstable"
+	. "service-discovery-controller/routesource"
+	"service-discovery-controller/routesource/fakes"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("FileSource", func() {
+	var (
+		dir             string
+		path            string
+		addressTable    *fakes.AddressTable
+		fakeClock       *fakeclock.FakeClock
+		logger          *lagertest.TestLogger
+		source          *FileSource
+		refreshInterval time.Duration
+	)
+
+	writeRoutes := func(contents string) {
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "static-routes")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "routes.yml")
+
+		addressTable = &fakes.AddressTable{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+		refreshInterval = 10 * time.Second
+		source = NewFileSource(path, []string{"platform.internal."}, refreshInterval, addressTable, fakeClock, logger)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("is named file", func() {
+		Expect(source.Name()).To(Equal("file"))
+	})
+
+	Context("when the file is valid", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			writeRoutes(`
+routes:
+- hostnames: [uaa.platform.internal, login.platform.internal.]
+  ip: 10.0.0.5
+  port: 8443
+  tags:
+    component: uaa
+- hostnames: [credhub.platform.internal]
+  ip: FD00::0005
+`)
+			process = ifrit.Invoke(source)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("registers the routes tagged with their source", func() {
+			Expect(addressTable.ApplyCallCount()).To(Equal(1))
+			Expect(addressTable.ApplyArgsForCall(0)).To(Equal([]addresstable.Change{
+				{
+					Hostnames: []string{"uaa.platform.internal", "login.platform.internal."},
+					IP:        "10.0.0.5",
+					Metadata:  addresstable.Metadata{Port: 8443, Tags: map[string]string{"component": "uaa"}, Source: "file"},
+				},
+				{
+					Hostnames: []string{"credhub.platform.internal"},
+					IP:        "fd00::5",
+					Metadata:  addresstable.Metadata{Source: "file"},
+				},
+			}))
+			Expect(logger).To(gbytes.Say("test.static-routes-loaded"))
+		})
+
+		It("registers the routes again on every refresh", func() {
+			fakeClock.WaitForWatcherAndIncrement(refreshInterval)
+			Eventually(addressTable.ApplyCallCount).Should(Equal(2))
+			Expect(addressTable.ApplyArgsForCall(1)).To(Equal(addressTable.ApplyArgsForCall(0)))
+		})
+
+		Context("when routes are removed from the file", func() {
+			BeforeEach(func() {
+				writeRoutes(`{"routes": [{"hostnames": ["uaa.platform.internal"], "ip": "10.0.0.5", "port": 8443}]}`)
+			})
+
+			It("unregisters them on the next refresh", func() {
+				fakeClock.WaitForWatcherAndIncrement(refreshInterval)
+				Eventually(addressTable.ApplyCallCount).Should(Equal(2))
+				Expect(addressTable.ApplyArgsForCall(1)).To(Equal([]addresstable.Change{
+					{
+						Remove:    true,
+						Hostnames: []string{"login.platform.internal."},
+						IP:        "10.0.0.5",
+						Metadata:  addresstable.Metadata{Source: "file"},
+					},
+					{
+						Remove:    true,
+						Hostnames: []string{"credhub.platform.internal"},
+						IP:        "fd00::5",
+						Metadata:  addresstable.Metadata{Source: "file"},
+					},
+					{
+						Hostnames: []string{"uaa.platform.internal"},
+						IP:        "10.0.0.5",
+						Metadata:  addresstable.Metadata{Port: 8443, Source: "file"},
+					},
+				}))
+			})
+		})
+
+		Context("when the file becomes invalid", func() {
+			BeforeEach(func() {
+				writeRoutes(`routes: [{hostnames: [uaa.example.com], ip: 10.0.0.5}]`)
+			})
+
+			It("keeps the routes last loaded and logs the error", func() {
+				fakeClock.WaitForWatcherAndIncrement(refreshInterval)
+				Eventually(logger).Should(gbytes.Say("test.static-routes-not-reloaded"))
+				Expect(addressTable.ApplyCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when the file does not exist", func() {
+		It("fails to start", func() {
+			err := source.Run(make(chan os.Signal), make(chan struct{}))
+			Expect(err).To(MatchError(ContainSubstring("read static routes file")))
+		})
+	})
+
+	DescribeTable("when the file has an invalid route",
+		func(contents, errorString string) {
+			writeRoutes(contents)
+			err := source.Run(make(chan os.Signal), make(chan struct{}))
+			Expect(err).To(MatchError(errorString))
+			Expect(addressTable.ApplyCallCount()).To(Equal(0))
+		},
+		Entry("invalid ip", `routes: [{hostnames: [uaa.platform.internal], ip: not-an-ip}]`,
+			`invalid static routes file: routes[0]: invalid ip "not-an-ip"`),
+		Entry("no hostnames", `routes: [{ip: 10.0.0.5}]`,
+			"invalid static routes file: routes[0]: no hostnames for ip 10.0.0.5"),
+		Entry("invalid hostname", `routes: [{hostnames: [uaa_platform.internal], ip: 10.0.0.5}]`,
+			`invalid static routes file: routes[0]: invalid hostname "uaa_platform.internal"`),
+		Entry("external hostname", `routes: [{hostnames: [uaa.example.com], ip: 10.0.0.5}]`,
+			`invalid static routes file: routes[0]: hostname "uaa.example.com" is not under an internal domain`),
+	)
+})
@@ -0,0 +1,56 @@
+package routesource
+
+import "strings"
+
+const (
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+// ValidHostname reports whether name is a DNS name made of letters, digits
+// and hyphens, with no label empty, longer than 63 characters or starting or
+// ending with a hyphen. A trailing dot is allowed.
+func ValidHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > maxHostnameLength {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > maxLabelLength {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// InDomains reports whether name is under one of domains. Every name is when
+// there are no domains.
+func InDomains(name string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	name = fqdn(strings.ToLower(name))
+	for _, domain := range domains {
+		if strings.HasSuffix(name, "."+fqdn(strings.ToLower(domain))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
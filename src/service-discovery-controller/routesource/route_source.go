@@ -0,0 +1,91 @@
+package routesource
+
+import (
+	"fmt"
+	"net"
+	"service-discovery-controller/addresstable"
+
+	"github.com/tedsuo/ifrit"
+)
+
+// Names of the route sources, which every address table entry they add is
+// tagged with.
+const (
+	NATS = "nats"
+	File = "file"
+	API  = "api"
+)
+
+// RouteSource keeps the address table up to date with the routes registered
+// in one place.
+type RouteSource interface {
+	ifrit.Runner
+	Name() string
+}
+
+//go:generate counterfeiter -o fakes/address_table.go --fake-name AddressTable . AddressTable
+type AddressTable interface {
+	Apply(changes []addresstable.Change) []int
+}
+
+// Route registers an IP under some hostnames. It is how routes are written in
+// the static routes file and sent to the route API.
+type Route struct {
+	Hostnames []string          `json:"hostnames" yaml:"hostnames"`
+	IP        string            `json:"ip" yaml:"ip"`
+	Port      uint16            `json:"port" yaml:"port"`
+	Tags      map[string]string `json:"tags" yaml:"tags"`
+}
+
+// Routes is the document read from the static routes file and sent to the
+// route API.
+type Routes struct {
+	Routes []Route `json:"routes" yaml:"routes"`
+}
+
+// validate rewrites the IP in its canonical form and checks that every
+// hostname is a valid DNS name under one of internalDomains.
+func (r *Route) validate(internalDomains []string) error {
+	ip := net.ParseIP(r.IP)
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("invalid ip %q", r.IP)
+	}
+	r.IP = ip.String()
+
+	if len(r.Hostnames) == 0 {
+		return fmt.Errorf("no hostnames for ip %s", r.IP)
+	}
+
+	for _, hostname := range r.Hostnames {
+		if !ValidHostname(hostname) {
+			return fmt.Errorf("invalid hostname %q", hostname)
+		}
+		if !InDomains(hostname, internalDomains) {
+			return fmt.Errorf("hostname %q is not under an internal domain", hostname)
+		}
+	}
+
+	return nil
+}
+
+func (r Route) change(source string, remove bool) addresstable.Change {
+	return addresstable.Change{
+		Remove:    remove,
+		Hostnames: r.Hostnames,
+		IP:        r.IP,
+		Metadata: addresstable.Metadata{
+			Port:   r.Port,
+			Tags:   r.Tags,
+			Source: source,
+		},
+	}
+}
+
+func validateRoutes(routes []Route, internalDomains []string) error {
+	for i := range routes {
+		if err := routes[i].validate(internalDomains); err != nil {
+			return fmt.Errorf("routes[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
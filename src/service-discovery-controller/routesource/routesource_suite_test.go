@@ -0,0 +1,13 @@
+package routesource_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRoutesource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Routesource Suite")
+}